@@ -13,6 +13,7 @@ import (
 	"github.com/stm/video-transcoder/internal/config"
 	"github.com/stm/video-transcoder/internal/database"
 	"github.com/stm/video-transcoder/internal/scanner"
+	"github.com/stm/video-transcoder/internal/verifier"
 	"github.com/stm/video-transcoder/internal/web"
 	"github.com/stm/video-transcoder/internal/worker"
 )
@@ -20,6 +21,8 @@ import (
 func main() {
 	// 解析命令行参数
 	configPath := flag.String("config", "configs/config.yaml", "配置文件路径")
+	dryRunPath := flag.String("dry-run", "", "试运行扫描指定目录后退出（不写入数据库）")
+	dryRunCSV := flag.String("dry-run-csv", "", "试运行文件列表的 CSV 输出路径（默认输出到标准输出）")
 	flag.Parse()
 
 	log.Println("====================================")
@@ -34,6 +37,14 @@ func main() {
 	}
 	log.Printf("[Main] 配置加载成功: input=%s, output=%s", cfg.Path.Input, cfg.Path.Output)
 
+	// 试运行只读取已有数据库，不创建文件也不执行迁移
+	if *dryRunPath != "" {
+		if err := runDryRun(cfg, *dryRunPath, *dryRunCSV); err != nil {
+			log.Fatalf("[Main] 试运行失败: %v", err)
+		}
+		return
+	}
+
 	// 初始化数据库
 	log.Println("[Main] 初始化数据库...")
 	db, err := database.Init(cfg.Path.Database)
@@ -42,6 +53,7 @@ func main() {
 	}
 	defer db.Close()
 	log.Println("[Main] 数据库初始化成功")
+
 	if count, err := db.ResetProcessingTasksToPending(); err != nil {
 		log.Printf("[Main] 恢复未完成任务失败: %v", err)
 	} else if count > 0 {
@@ -52,11 +64,14 @@ func main() {
 	scan := scanner.New(cfg, db)
 	work := worker.New(cfg, db)
 	clean := cleaner.New(cfg, db)
-	webServer := web.New(cfg, db, scan, work, clean)
+	verify := verifier.New(cfg, db)
+	verify.SetIdleCheck(work.IsIdle)
+	webServer := web.New(cfg, db, scan, work, clean, verify)
 
 	// 创建上下文用于优雅关闭
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	scan.SetContext(ctx) // 手动扫描随服务关闭而取消
 
 	// 启动各模块的Goroutine
 	log.Println("[Main] 启动后台服务...")
@@ -70,6 +85,9 @@ func main() {
 	// 启动清理模块
 	go clean.Run(ctx)
 
+	// 启动输出校验
+	go verify.Run(ctx)
+
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
@@ -110,3 +128,45 @@ func main() {
 
 	log.Println("[Main] 服务已安全关闭")
 }
+
+// runDryRun 试运行扫描并输出报告，数据库以只读方式打开，不存在时所有文件按新文件处理
+func runDryRun(cfg *config.Config, path, csvPath string) error {
+	db, err := database.OpenReadOnly(cfg.Path.Database)
+	switch {
+	case os.IsNotExist(err):
+		log.Printf("[Main] 数据库不存在，试运行不参考已有任务: %s", cfg.Path.Database)
+		db = nil
+	case err != nil:
+		return err
+	default:
+		defer db.Close()
+	}
+
+	report, err := scanner.New(cfg, db).DryRun(context.Background(), path)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Main] 试运行 %s（已配置: %v）: 新增 %d, 等待稳定 %d, 重命名 %d, 更新 %d, 跳过 %d, 排除 %d",
+		report.Path, report.Configured, report.New, report.Settling, report.Renamed, report.Update, report.Skip, report.Excluded)
+	log.Printf("[Main] 源文件 %.2f GB, 待转码 %.2f GB, 预计输出 %.2f GB（比例 %.2f, 样本 %d）",
+		float64(report.SourceBytes)/1024/1024/1024, float64(report.PendingBytes)/1024/1024/1024,
+		float64(report.EstimatedOutputBytes)/1024/1024/1024, report.OutputRatio, report.RatioSamples)
+
+	out := os.Stdout
+	if csvPath != "" {
+		f, err := os.Create(csvPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := report.WriteCSV(out); err != nil {
+		return err
+	}
+	if csvPath != "" {
+		log.Printf("[Main] 文件列表已写入: %s", csvPath)
+	}
+	return nil
+}
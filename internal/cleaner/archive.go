@@ -0,0 +1,65 @@
+package cleaner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+// archivePair 返回源文件所属配对及相对路径，配对未使用 archive 策略时 ok 为 false
+func (c *Cleaner) archivePair(srcPath string) (config.InputOutputPair, string, bool) {
+	pair, rel, ok := c.config.FindPair(srcPath)
+	if !ok || pair.SourcePolicy != config.SourcePolicyArchive {
+		return config.InputOutputPair{}, "", false
+	}
+	return pair, rel, true
+}
+
+// archiveTarget 计算归档路径（保留相对路径），目标已存在时改名为 <原文件名>.archived_<时间>.<扩展名>
+func archiveTarget(pair config.InputOutputPair, rel string) string {
+	dest := filepath.Join(pair.ArchiveDir, rel)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = strings.TrimSuffix(dest, ext) + ".archived_" + time.Now().Format("20060102_150405") + ext
+	}
+	return dest
+}
+
+// archiveSource 将源文件移入归档目录并写入归档清单，返回归档后的路径
+func (c *Cleaner) archiveSource(task *database.Task, srcPath string, pair config.InputOutputPair, rel string) (string, error) {
+	dest := archiveTarget(pair, rel)
+	size := fileSize(srcPath)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	checksum, err := c.moveFile(srcPath, dest)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[Cleaner] 源文件已归档: %s -> %s", srcPath, dest)
+
+	item := &database.ArchiveItem{
+		TaskID:       task.ID,
+		Pair:         pair.Input,
+		OriginalPath: srcPath,
+		ArchivePath:  dest,
+		Size:         size,
+		Checksum:     checksum,
+		ArchivedAt:   time.Now(),
+	}
+	if err := c.db.AddArchiveItem(item); err != nil {
+		// 文件已移动：至少记录源文件已移除，避免被扫描器视为孤立
+		log.Printf("[Cleaner] 写入归档清单失败 %s: %v", dest, err)
+		if err := c.db.MarkSourceRemoved(task.ID); err != nil {
+			log.Printf("[Cleaner] 记录源文件移除失败 %s: %v", task.SourcePath, err)
+		}
+	}
+	return dest, nil
+}
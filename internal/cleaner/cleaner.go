@@ -3,16 +3,17 @@ package cleaner
 import (
 	"context"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/stm/video-transcoder/internal/config"
 	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
 	"github.com/stm/video-transcoder/internal/metrics"
 )
 
@@ -20,6 +21,9 @@ import (
 type Cleaner struct {
 	config *config.Config
 	db     *database.DB
+
+	mu      sync.Mutex
+	running bool // 同一时间只执行一次清理（定时与手动触发互斥）
 }
 
 // New 创建Cleaner实例
@@ -30,29 +34,46 @@ func New(cfg *config.Config, db *database.DB) *Cleaner {
 	}
 }
 
-// Run 运行清理任务（每天上午10点执行）
+// Run 按 soft_delete_cron / hard_delete_cron 定时执行清理
 func (c *Cleaner) Run(ctx context.Context) {
 	log.Println("[Cleaner] 清理模块启动")
 
 	// 创建 cron 调度器
 	cronScheduler := cron.New()
 
-	// 添加定时任务：每天上午 10:00 执行
-	_, err := cronScheduler.AddFunc("0 10 * * *", func() {
-		c.runCleaning()
-	})
+	soft, hard := c.config.Cleaning.SoftDeleteCron, c.config.Cleaning.HardDeleteCron
+	if soft == "" {
+		soft = "0 10 * * *"
+	}
+	if hard == "" {
+		hard = soft
+	}
 
-	if err != nil {
-		log.Printf("[Cleaner] 添加定时任务失败: %v", err)
-		return
+	// 两个阶段时间相同时合并为一次完整清理
+	schedules := map[string]string{PhaseAll: soft}
+	if soft != hard {
+		schedules = map[string]string{PhaseSoft: soft, PhaseHard: hard}
+	}
+	for phase, spec := range schedules {
+		phase := phase
+		if _, err := cronScheduler.AddFunc(spec, func() {
+			c.scheduled(phase, TriggerSchedule)
+		}); err != nil {
+			log.Printf("[Cleaner] 添加定时任务失败 %s: %v", spec, err)
+			return
+		}
 	}
 
 	// 启动调度器
 	cronScheduler.Start()
-	log.Println("[Cleaner] Cron 调度器已启动（每天 10:00 执行清理）")
+	log.Printf("[Cleaner] Cron 调度器已启动（移入垃圾桶: %s，彻底删除: %s）", soft, hard)
 
-	// 可选：立即执行一次清理
-	go c.runCleaning()
+	// 启动时至少清理上次进程被终止时残留的转码临时文件
+	if c.config.Cleaning.RunOnStartup {
+		go c.scheduled(PhaseAll, TriggerStartup)
+	} else {
+		go c.scheduled(PhaseTemp, TriggerStartup)
+	}
 
 	// 等待停止信号
 	<-ctx.Done()
@@ -60,25 +81,15 @@ func (c *Cleaner) Run(ctx context.Context) {
 	cronScheduler.Stop()
 }
 
-// runCleaning 执行清理任务
-func (c *Cleaner) runCleaning() {
-	log.Println("[Cleaner] 开始执行清理任务")
-
-	// 一级清理：移入垃圾桶
-	if err := c.moveToTrash(); err != nil {
-		log.Printf("[Cleaner] 移入垃圾桶失败: %v", err)
+// scheduled 执行定时或启动时的清理
+func (c *Cleaner) scheduled(phase, trigger string) {
+	if _, err := c.RunOnce(phase, trigger, false); err != nil {
+		log.Printf("[Cleaner] 跳过本次清理: %v", err)
 	}
-
-	// 二级清理：清空垃圾桶
-	if err := c.emptyTrash(); err != nil {
-		log.Printf("[Cleaner] 清空垃圾桶失败: %v", err)
-	}
-
-	log.Println("[Cleaner] 清理任务完成")
 }
 
-// moveToTrash 将完成N天的源文件移入垃圾桶
-func (c *Cleaner) moveToTrash() error {
+// moveToTrash 将完成N天的源文件移入垃圾桶（source_policy=archive 的配对移入归档目录）
+func (c *Cleaner) moveToTrash(run *cleanRun) error {
 	// 计算截止时间
 	cutoffTime := time.Now().AddDate(0, 0, -c.config.Cleaning.SoftDeleteDays)
 
@@ -94,220 +105,237 @@ func (c *Cleaner) moveToTrash() error {
 	}
 
 	log.Printf("[Cleaner] 找到 %d 个需要移入垃圾桶的文件", len(tasks))
-	movedCount := 0
+	movedCount, archivedCount, blockedCount := 0, 0, 0
 
 	for _, task := range tasks {
-		srcPath := filepath.Join(c.config.Path.Input, task.SourcePath)
+		// 源路径为绝对路径；旧版本数据库中的相对路径相对于 path.input
+		srcPath := task.SourcePath
+		if !filepath.IsAbs(srcPath) {
+			srcPath = filepath.Join(c.config.Path.Input, srcPath)
+		}
 
 		// 检查源文件是否存在
 		if _, err := os.Stat(srcPath); os.IsNotExist(err) {
 			continue
 		}
 
+		// 输出可能已丢失或损坏（如归档盘被更换），检查未通过时保留唯一完好的源文件
+		if err := c.checkOutput(task, srcPath); err != nil {
+			log.Printf("[Cleaner] 输出检查未通过，保留源文件 %s: %v", task.SourcePath, err)
+			run.add(RunAction{Action: "blocked", Path: srcPath, TaskID: task.ID, Size: task.SourceSize, Reason: err.Error()})
+			if run.dry() {
+				continue
+			}
+			if err := c.db.RaiseAlert(database.AlertPreTrashCheck, task.ID, srcPath, err.Error()); err != nil {
+				log.Printf("[Cleaner] 记录告警失败 %s: %v", task.SourcePath, err)
+			}
+			blockedCount++
+			continue
+		}
+
+		// archive 策略：源文件移入归档目录长期保存，不进入垃圾桶
+		if pair, rel, ok := c.archivePair(srcPath); ok {
+			if run.dry() {
+				run.add(RunAction{Action: "archive", Path: srcPath, TaskID: task.ID, Size: fileSize(srcPath), Reason: filepath.Join(pair.ArchiveDir, rel)})
+				c.archiveSidecars(run, task, srcPath, pair, rel)
+				continue
+			}
+			c.db.ResolveAlerts(database.AlertPreTrashCheck, task.ID)
+
+			size := fileSize(srcPath)
+			dest, err := c.archiveSource(task, srcPath, pair, rel)
+			if err != nil {
+				log.Printf("[Cleaner] 归档源文件失败 %s: %v", task.SourcePath, err)
+				continue
+			}
+			archivedCount++
+			run.add(RunAction{Action: "archive", Path: srcPath, TaskID: task.ID, Size: size, Reason: dest})
+			c.archiveSidecars(run, task, srcPath, pair, rel)
+			continue
+		}
+
+		if run.dry() {
+			c.planTrash(run, srcPath, task.ID, database.TrashReasonCleanup)
+			c.trashSidecars(run, task, srcPath)
+			continue
+		}
+		c.db.ResolveAlerts(database.AlertPreTrashCheck, task.ID)
+
 		// 移动到垃圾桶
-		if err := c.safeMoveToTrash(srcPath); err != nil {
+		size := fileSize(srcPath)
+		if err := c.trashFile(srcPath, task.ID, database.TrashReasonCleanup); err != nil {
 			log.Printf("[Cleaner] 移动文件失败 %s: %v", task.SourcePath, err)
 			continue
 		}
 
 		movedCount++
+		run.add(RunAction{Action: "trash", Path: srcPath, TaskID: task.ID, Size: size, Reason: database.TrashReasonCleanup})
 		log.Printf("[Cleaner] 已移入垃圾桶: %s", task.SourcePath)
+		c.trashSidecars(run, task, srcPath)
+
+		// 记录源文件已由清理模块移除，扫描时不再视为孤立
+		if err := c.db.MarkSourceRemoved(task.ID); err != nil {
+			log.Printf("[Cleaner] 记录源文件移除失败 %s: %v", task.SourcePath, err)
+		}
 
 		// 更新 Prometheus metrics
 		metrics.FilesSoftDeleted.Inc()
 	}
 
+	if run.dry() {
+		return nil
+	}
 	log.Printf("[Cleaner] 共移动 %d 个文件到垃圾桶", movedCount)
+	if archivedCount > 0 {
+		log.Printf("[Cleaner] 共归档 %d 个源文件", archivedCount)
+	}
+	if blockedCount > 0 {
+		log.Printf("[Cleaner] ⚠️ %d 个源文件因输出检查未通过而保留，请在告警中查看", blockedCount)
+	}
 	return nil
 }
 
 // safeMoveToTrash 安全地移动文件到垃圾桶
 func (c *Cleaner) safeMoveToTrash(srcPath string) error {
-	// 构建垃圾桶路径（同级目录，避免跨分区）
-	srcDir := filepath.Dir(srcPath)
-	trashDir := filepath.Join(srcDir, c.config.Path.Trash)
+	_, _, err := c.moveFileToTrash(srcPath)
+	return err
+}
 
-	// 确保垃圾桶目录存在
-	if err := os.MkdirAll(trashDir, 0755); err != nil {
-		return fmt.Errorf("创建垃圾桶目录失败: %w", err)
-	}
+// trashFile 移动文件到垃圾桶并写入垃圾桶清单
+func (c *Cleaner) trashFile(srcPath string, taskID int64, reason string) error {
+	size := fileSize(srcPath)
 
-	// 生成带时间戳的目标文件名
-	filename := filepath.Base(srcPath)
-	timestamp := time.Now().Format("20060102_150405")
-	trashPath := filepath.Join(trashDir, filename+"_del_"+timestamp)
+	trashPath, pair, err := c.moveFileToTrash(srcPath)
+	if err != nil {
+		return err
+	}
 
-	// 尝试直接移动（同分区快速操作）
-	err := os.Rename(srcPath, trashPath)
-	if err == nil {
-		log.Printf("[Cleaner] 文件已移入垃圾桶（os.Rename）: %s", trashPath)
+	if c.db == nil {
 		return nil
 	}
-
-	// 检查是否为跨分区错误
-	if !isLinkError(err) {
-		return err
+	item := &database.TrashItem{
+		TaskID:       taskID,
+		Pair:         pair,
+		OriginalPath: srcPath,
+		TrashPath:    trashPath,
+		Size:         size,
+		Reason:       reason,
+		DeletedAt:    time.Now(),
 	}
-
-	// 跨分区：使用复制+删除
-	log.Printf("[Cleaner] 检测到跨分区，使用复制+删除模式: %s", srcPath)
-	return c.copyAndDelete(srcPath, trashPath)
+	if err := c.db.AddTrashItem(item); err != nil {
+		log.Printf("[Cleaner] 写入垃圾桶清单失败 %s: %v", trashPath, err)
+	}
+	return nil
 }
 
-// isLinkError 检查是否为跨设备链接错误
-func isLinkError(err error) bool {
-	return strings.Contains(err.Error(), "invalid cross-device link")
-}
+// moveFileToTrash 移动文件到所属配对的垃圾桶，返回垃圾桶中的路径与来源配对
+func (c *Cleaner) moveFileToTrash(srcPath string) (string, string, error) {
+	// 构建垃圾桶路径（所在配对目录的垃圾桶，保留相对路径，避免跨分区）
+	trashPath, pair := c.trashTarget(srcPath)
 
-// copyAndDelete 复制文件然后删除源文件
-func (c *Cleaner) copyAndDelete(src, dst string) error {
-	// 打开源文件
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("打开源文件失败: %w", err)
+	// 确保垃圾桶目录存在
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0755); err != nil {
+		return "", "", fmt.Errorf("创建垃圾桶目录失败: %w", err)
 	}
-	defer srcFile.Close()
 
-	// 创建目标文件
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("创建目标文件失败: %w", err)
+	if _, err := c.moveFile(srcPath, trashPath); err != nil {
+		return "", "", err
 	}
-	defer dstFile.Close()
+	log.Printf("[Cleaner] 文件已移入垃圾桶: %s", trashPath)
+	return trashPath, pair, nil
+}
 
-	// 复制数据
-	written, err := io.Copy(dstFile, srcFile)
+// moveFile 移动文件，跨分区时复制并校验 SHA-256、保留权限和时间戳，返回跨分区复制的校验值
+func (c *Cleaner) moveFile(srcPath, dstPath string) (string, error) {
+	opts := fileutil.Options{BytesPerSecond: int64(c.config.Cleaning.MoveBandwidthMB * 1024 * 1024)}
+	result, err := fileutil.Move(srcPath, dstPath, opts)
 	if err != nil {
-		os.Remove(dst) // 清理失败的复制
-		return fmt.Errorf("复制数据失败: %w", err)
-	}
-
-	// 验证文件大小
-	srcInfo, _ := srcFile.Stat()
-	if written != srcInfo.Size() {
-		os.Remove(dst)
-		return fmt.Errorf("复制数据不完整: 预期 %d 字节, 实际 %d 字节",
-			srcInfo.Size(), written)
+		return "", err
 	}
-
-	// 同步到磁盘
-	if err := dstFile.Sync(); err != nil {
-		os.Remove(dst)
-		return fmt.Errorf("同步数据失败: %w", err)
-	}
-
-	// 删除源文件
-	if err := os.Remove(src); err != nil {
-		return fmt.Errorf("删除源文件失败: %w", err)
+	if result.Copied {
+		if result.Resumed > 0 {
+			log.Printf("[Cleaner] 跨分区移动成功（续传 %.2f MB）: %s -> %s", float64(result.Resumed)/1024/1024, srcPath, dstPath)
+		} else {
+			log.Printf("[Cleaner] 跨分区移动成功: %s -> %s", srcPath, dstPath)
+		}
 	}
-
-	log.Printf("[Cleaner] 跨分区移动成功: %s -> %s", src, dst)
-	return nil
+	return result.Checksum, nil
 }
 
-// emptyTrash 清空超过N天的垃圾桶文件
-func (c *Cleaner) emptyTrash() error {
-	trashRoot := c.config.GetTrashPath()
-
-	// 检查垃圾桶目录是否存在
-	if _, err := os.Stat(trashRoot); os.IsNotExist(err) {
-		return nil
-	}
-
+// emptyTrash 清空所有配对垃圾桶中超过N天的文件
+func (c *Cleaner) emptyTrash(run *cleanRun) error {
 	cutoffTime := time.Now().AddDate(0, 0, -c.config.Cleaning.HardDeleteDays)
 	deletedCount := 0
+	held := c.heldTrashPaths()
 
-	err := filepath.WalkDir(trashRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil
+	purge := func(path string, info fs.FileInfo, reason string) {
+		if run.dry() {
+			run.add(RunAction{Action: "purge", Path: path, Size: info.Size(), Reason: reason})
+			return
 		}
-
-		// 跳过目录
-		if d.IsDir() {
-			return nil
+		if err := os.Remove(path); err != nil {
+			log.Printf("[Cleaner] 删除文件失败 %s: %v", path, err)
+			return
 		}
+		c.resolveTrashPath(path, database.TrashPurged, reason)
+		run.add(RunAction{Action: "purge", Path: path, Size: info.Size(), Reason: reason})
+		deletedCount++
+		log.Printf("[Cleaner] 彻底删除过期文件: %s（%s）", path, reason)
 
-		// 解析文件名时间戳 "video.mp4_del_20260105_120000"
-		filename := d.Name()
-		parts := strings.Split(filename, "_del_")
-		var fileTime time.Time
+		// 更新 Prometheus metrics
+		metrics.FilesHardDeleted.Inc()
+	}
 
-		if len(parts) >= 2 {
-			// 尝试解析时间戳
-			timestamp := parts[len(parts)-1]
-			fileTime, err = time.Parse("20060102_150405", timestamp)
-			if err != nil {
-				// 降级到使用文件修改时间
-				info, _ := d.Info()
-				fileTime = info.ModTime()
-			}
-		} else {
-			// 无时间戳，使用文件修改时间
-			info, _ := d.Info()
-			fileTime = info.ModTime()
+	err := c.walkTrash(func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time) {
+		if deleteTime.Before(cutoffTime) && !held[path] {
+			purge(path, info, "超过 hard_delete_days")
 		}
+	})
 
-		// 检查是否超过清理时间
-		if fileTime.Before(cutoffTime) {
-			if err := os.Remove(path); err != nil {
-				log.Printf("[Cleaner] 删除文件失败 %s: %v", path, err)
-				return nil
-			}
-			deletedCount++
-			log.Printf("[Cleaner] 彻底删除过期文件: %s", filename)
-
-			// 更新 Prometheus metrics
-			metrics.FilesHardDeleted.Inc()
+	// 中断的跨分区复制：源文件已不再移动（如已恢复或删除）时不会续传
+	partialCutoff := c.partialCutoff()
+	if pErr := c.walkTrashPartials(func(root trashRoot, path string, info fs.FileInfo, modTime time.Time) {
+		if modTime.Before(partialCutoff) {
+			purge(path, info, "未完成的复制超过 partial_grace_hours")
 		}
-
-		return nil
-	})
+	}); err == nil {
+		err = pErr
+	}
 
 	if deletedCount > 0 {
 		log.Printf("[Cleaner] 共彻底删除 %d 个过期文件", deletedCount)
-	} else {
+	} else if !run.dry() {
 		log.Println("[Cleaner] 垃圾桶中没有过期文件")
 	}
 
 	return err
 }
 
-// ListTrashFiles 列出垃圾桶中的文件
-func (c *Cleaner) ListTrashFiles() ([]TrashFile, error) {
-	trashRoot := c.config.GetTrashPath()
-
-	// 检查垃圾桶目录是否存在
-	if _, err := os.Stat(trashRoot); os.IsNotExist(err) {
-		return []TrashFile{}, nil
+// fileSize 返回文件大小，文件不可访问时为 0
+func fileSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
 	}
+	return 0
+}
 
-	var files []TrashFile
-
-	err := filepath.WalkDir(trashRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
-		}
+// ListTrashFiles 列出所有配对垃圾桶中的文件
+func (c *Cleaner) ListTrashFiles() ([]TrashFile, error) {
+	files := []TrashFile{}
 
-		info, err := d.Info()
+	// 清单中的记录补充原路径与任务信息（旧版本移入的文件没有记录）
+	manifest := make(map[string]*database.TrashItem)
+	if c.db != nil {
+		items, err := c.db.GetTrashedItems()
 		if err != nil {
-			return nil
+			return nil, fmt.Errorf("查询垃圾桶清单失败: %w", err)
 		}
-
-		// 解析删除时间
-		filename := d.Name()
-		parts := strings.Split(filename, "_del_")
-		var deleteTime time.Time
-
-		if len(parts) >= 2 {
-			timestamp := parts[len(parts)-1]
-			deleteTime, err = time.Parse("20060102_150405", timestamp)
-			if err != nil {
-				deleteTime = info.ModTime()
-			}
-		} else {
-			deleteTime = info.ModTime()
+		for _, item := range items {
+			manifest[item.TrashPath] = item
 		}
+	}
 
+	err := c.walkTrash(func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time) {
 		// 计算剩余天数
 		hardDeleteTime := deleteTime.AddDate(0, 0, c.config.Cleaning.HardDeleteDays)
 		daysLeft := int(time.Until(hardDeleteTime).Hours() / 24)
@@ -315,15 +343,22 @@ func (c *Cleaner) ListTrashFiles() ([]TrashFile, error) {
 			daysLeft = 0
 		}
 
-		files = append(files, TrashFile{
-			Name:       filename,
+		file := TrashFile{
+			Name:       info.Name(),
 			Path:       path,
+			Pair:       root.Pair,
 			Size:       info.Size(),
 			DeleteTime: deleteTime,
 			DaysLeft:   daysLeft,
-		})
-
-		return nil
+		}
+		if item, ok := manifest[path]; ok {
+			file.ID = item.ID
+			file.OriginalPath = item.OriginalPath
+			file.TaskID = item.TaskID
+			file.Reason = item.Reason
+			file.HoldReason = item.HoldReason
+		}
+		files = append(files, file)
 	})
 
 	return files, err
@@ -331,25 +366,24 @@ func (c *Cleaner) ListTrashFiles() ([]TrashFile, error) {
 
 // TrashFile 垃圾桶文件信息
 type TrashFile struct {
+	ID         int64     `json:"id"` // 垃圾桶清单记录ID，旧版本移入的文件为 0
 	Name       string    `json:"name"`
 	Path       string    `json:"path"`
+	Pair       string    `json:"pair"` // 来源配对的输入目录
 	Size       int64     `json:"size"`
 	DeleteTime time.Time `json:"delete_time"`
 	DaysLeft   int       `json:"days_left"`
-}
-
-// DeleteTrashFile 立即删除垃圾桶中的指定文件
-func (c *Cleaner) DeleteTrashFile(filename string) error {
-	trashRoot := c.config.GetTrashPath()
-	filePath := filepath.Join(trashRoot, filename)
 
-	// 验证路径安全性（防止路径穿越）
-	if !strings.HasPrefix(filePath, trashRoot) {
-		return fmt.Errorf("非法路径")
-	}
+	OriginalPath string `json:"original_path,omitempty"`
+	TaskID       int64  `json:"task_id,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	HoldReason   string `json:"hold_reason,omitempty"` // 非空时不会被自动彻底删除
+}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+// DeleteTrashFile 立即删除垃圾桶中的指定文件（完整路径或垃圾桶根目录下的文件名）
+func (c *Cleaner) DeleteTrashFile(name string) error {
+	filePath, ok := c.findTrashFile(name)
+	if !ok {
 		return fmt.Errorf("文件不存在")
 	}
 
@@ -358,6 +392,8 @@ func (c *Cleaner) DeleteTrashFile(filename string) error {
 		return fmt.Errorf("删除文件失败: %w", err)
 	}
 
-	log.Printf("[Cleaner] 手动删除垃圾桶文件: %s", filename)
+	c.resolveTrashPath(filePath, database.TrashPurged, "手动删除")
+
+	log.Printf("[Cleaner] 手动删除垃圾桶文件: %s", filePath)
 	return nil
 }
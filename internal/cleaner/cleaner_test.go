@@ -1,12 +1,16 @@
 package cleaner
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stm/video-transcoder/internal/config"
 	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
 )
 
 func TestNew(t *testing.T) {
@@ -119,3 +123,858 @@ func TestMoveToTrashIntegration(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleOrphans(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	os.MkdirAll(inputDir, 0755)
+	os.MkdirAll(outputDir, 0755)
+
+	cfg := &config.Config{
+		Path: config.PathConfig{
+			Pairs: []config.InputOutputPair{{Input: inputDir, Output: outputDir}},
+		},
+		Cleaning: config.CleaningConfig{
+			OrphanPolicy: config.OrphanPolicyDelete,
+		},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	task := &database.Task{
+		SourcePath:  filepath.Join(inputDir, "a.mp4"),
+		SourceMtime: time.Now(),
+		SourceSize:  100,
+	}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusOrphaned, "")
+
+	outputPath := filepath.Join(outputDir, "a.mp4")
+	os.WriteFile(outputPath, []byte("encoded"), 0644)
+
+	c := New(cfg, db)
+
+	// keep 策略不动输出
+	cfg.Cleaning.OrphanPolicy = config.OrphanPolicyKeep
+	if err := c.handleOrphans(nil); err != nil {
+		t.Fatalf("handleOrphans() 失败: %v", err)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Fatal("keep 策略不应删除输出")
+	}
+
+	cfg.Cleaning.OrphanPolicy = config.OrphanPolicyDelete
+	if err := c.handleOrphans(nil); err != nil {
+		t.Fatalf("handleOrphans() 失败: %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Error("delete 策略应删除孤立任务的输出")
+	}
+}
+
+func TestMultiPairTrash(t *testing.T) {
+	tempDir := t.TempDir()
+	pairs := []config.InputOutputPair{
+		{Input: filepath.Join(tempDir, "a", "in"), Output: filepath.Join(tempDir, "a", "out")},
+		{Input: filepath.Join(tempDir, "b", "in"), Output: filepath.Join(tempDir, "b", "out")},
+	}
+	cfg := &config.Config{
+		Path: config.PathConfig{Pairs: pairs, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{
+			SoftDeleteDays: 7,
+			HardDeleteDays: 30,
+		},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	// 每个配对各有一个已完成任务的源文件
+	for _, pair := range pairs {
+		source := filepath.Join(pair.Input, "show", "ep1.mkv")
+		os.MkdirAll(filepath.Dir(source), 0755)
+		os.WriteFile(source, []byte("source"), 0644)
+
+		task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 6}
+		db.CreateTask(task)
+		db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+	}
+	// 截止时间设在未来，刚完成的任务即视为到期
+	cfg.Cleaning.SoftDeleteDays = -1
+	if err := c.moveToTrash(nil); err != nil {
+		t.Fatalf("moveToTrash() 失败: %v", err)
+	}
+
+	files, err := c.ListTrashFiles()
+	if err != nil {
+		t.Fatalf("ListTrashFiles() 失败: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("垃圾桶文件数 = %d, want 2", len(files))
+	}
+	for _, f := range files {
+		want := filepath.Join(f.Pair, ".stm_trash", "show")
+		if filepath.Dir(f.Path) != want {
+			t.Errorf("文件 %s 应位于所属配对的垃圾桶 %s", f.Path, want)
+		}
+	}
+
+	// 按完整路径删除其中一个
+	if err := c.DeleteTrashFile(files[0].Path); err != nil {
+		t.Fatalf("DeleteTrashFile() 失败: %v", err)
+	}
+	if err := c.DeleteTrashFile(filepath.Join(tempDir, "test.db")); err == nil {
+		t.Error("不应删除垃圾桶以外的文件")
+	}
+
+	// 过期文件在所有配对中都会被彻底删除
+	cfg.Cleaning.HardDeleteDays = -1
+	if err := c.emptyTrash(nil); err != nil {
+		t.Fatalf("emptyTrash() 失败: %v", err)
+	}
+	if files, _ := c.ListTrashFiles(); len(files) != 0 {
+		t.Errorf("过期文件应已删除，剩余 %d", len(files))
+	}
+}
+
+func TestRestoreTrashItem(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: -1, HardDeleteDays: 30},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "movie.mkv")
+	os.MkdirAll(pair.Input, 0755)
+	os.WriteFile(source, []byte("source"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 6}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+
+	if err := c.moveToTrash(nil); err != nil {
+		t.Fatalf("moveToTrash() 失败: %v", err)
+	}
+	files, _ := c.ListTrashFiles()
+	if len(files) != 1 || files[0].ID == 0 || files[0].OriginalPath != source || files[0].TaskID != task.ID {
+		t.Fatalf("垃圾桶清单记录错误: %+v", files)
+	}
+
+	// 恢复并重新转码
+	dest, err := c.RestoreTrashItem(files[0].ID, true)
+	if err != nil || dest != source {
+		t.Fatalf("RestoreTrashItem() = %s, %v", dest, err)
+	}
+	got, _ := db.GetTaskByID(task.ID)
+	if got.Status != database.StatusPending || got.SourceRemovedAt != nil {
+		t.Errorf("恢复后任务应重新入队: status=%s removed=%v", got.Status, got.SourceRemovedAt)
+	}
+	if _, err := c.RestoreTrashItem(files[0].ID, false); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("重复恢复应返回 ErrTrashItemNotFound: %v", err)
+	}
+
+	// 原位置已有文件时改名恢复，任务保持不变
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+	c.moveToTrash(nil)
+	os.WriteFile(source, []byte("new file"), 0644)
+	files, _ = c.ListTrashFiles()
+	dest, err = c.RestoreTrashItem(files[0].ID, true)
+	if err != nil || dest == source || !strings.Contains(dest, ".restored_") {
+		t.Fatalf("冲突时应改名恢复: %s, %v", dest, err)
+	}
+	if got, _ := db.GetTaskByID(task.ID); got.Status != database.StatusCompleted {
+		t.Errorf("改名恢复不应重置任务，实际 %s", got.Status)
+	}
+}
+
+func TestEnforceTrashQuota(t *testing.T) {
+	tempDir := t.TempDir()
+	const kb = 1.0 / 1024 / 1024 // 1KB 换算为 GB
+	pairs := []config.InputOutputPair{
+		{Input: filepath.Join(tempDir, "a", "in"), Output: filepath.Join(tempDir, "a", "out"), TrashMaxGB: 2 * kb},
+		{Input: filepath.Join(tempDir, "b", "in"), Output: filepath.Join(tempDir, "b", "out")},
+	}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: pairs, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: 7, HardDeleteDays: 30},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	// 每个文件 1KB，文件名中的时间决定移入顺序
+	put := func(dir string, name string, daysAgo int) string {
+		trash := cfg.TrashDir(dir)
+		os.MkdirAll(trash, 0755)
+		path := filepath.Join(trash, name+"_del_"+time.Now().AddDate(0, 0, -daysAgo).Format("20060102_150405"))
+		os.WriteFile(path, make([]byte, 1024), 0644)
+		return path
+	}
+	a1 := put(pairs[0].Input, "a1.mkv", 3)
+	a2 := put(pairs[0].Input, "a2.mkv", 2)
+	a3 := put(pairs[0].Input, "a3.mkv", 1)
+	b1 := put(pairs[1].Input, "b1.mkv", 10)
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// 配对上限只删除该配对中最早的文件
+	if err := c.enforceTrashQuota(nil); err != nil {
+		t.Fatalf("enforceTrashQuota() 失败: %v", err)
+	}
+	if exists(a1) || !exists(a2) || !exists(a3) || !exists(b1) {
+		t.Errorf("配对上限应只删除 a1: a1=%v a2=%v a3=%v b1=%v", exists(a1), exists(a2), exists(a3), exists(b1))
+	}
+
+	// 全局上限按所有配对中最早的文件删除
+	cfg.Cleaning.TrashMaxGB = 2 * kb
+	if err := c.enforceTrashQuota(nil); err != nil {
+		t.Fatalf("enforceTrashQuota() 失败: %v", err)
+	}
+	if exists(b1) || !exists(a2) || !exists(a3) {
+		t.Errorf("全局上限应删除最早的 b1: a2=%v a3=%v b1=%v", exists(a2), exists(a3), exists(b1))
+	}
+
+	// 预计占用包含已完成、尚未移入垃圾桶的源文件
+	source := filepath.Join(pairs[0].Input, "movie.mkv")
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 500}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+
+	usage, err := c.TrashUsage()
+	if err != nil {
+		t.Fatalf("TrashUsage() 失败: %v", err)
+	}
+	if len(usage.Pairs) != 2 || usage.Pairs[0].Used != 2048 || usage.Pairs[0].Pending != 500 || usage.Pairs[0].Projected != 2548 {
+		t.Errorf("配对用量错误: %+v", usage.Pairs)
+	}
+	if usage.Used != 2048 || usage.Projected != 2548 || usage.Limit != 2048 {
+		t.Errorf("合计用量错误: %+v", usage)
+	}
+}
+
+func TestHeldTrashItemsAreNotPurged(t *testing.T) {
+	tempDir := t.TempDir()
+	const kb = 1.0 / 1024 / 1024 // 1KB 换算为 GB
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: 7, HardDeleteDays: 30},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	trash := cfg.TrashDir(pair.Input)
+	os.MkdirAll(trash, 0755)
+	put := func(name string) string {
+		path := filepath.Join(trash, name+"_del_"+time.Now().AddDate(0, 0, -60).Format("20060102_150405"))
+		os.WriteFile(path, make([]byte, 1024), 0644)
+		return path
+	}
+	held := put("held.mkv")
+	other := put("other.mkv")
+
+	item := &database.TrashItem{OriginalPath: filepath.Join(pair.Input, "held.mkv"), TrashPath: held,
+		Reason: database.TrashReasonCleanup, DeletedAt: time.Now().AddDate(0, 0, -60)}
+	db.AddTrashItem(item)
+	if err := db.HoldTrashItem(item.ID, "输出文件损坏"); err != nil {
+		t.Fatalf("HoldTrashItem() 失败: %v", err)
+	}
+
+	// 到期删除跳过保留的文件
+	if err := c.emptyTrash(nil); err != nil {
+		t.Fatalf("emptyTrash() 失败: %v", err)
+	}
+	if _, err := os.Stat(held); err != nil {
+		t.Error("保留的文件不应到期删除")
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Error("未保留的过期文件应被删除")
+	}
+
+	// 容量回收同样跳过，保留的文件仍计入用量
+	cfg.Cleaning.TrashMaxGB = 0.5 * kb
+	if err := c.enforceTrashQuota(nil); err != nil {
+		t.Fatalf("enforceTrashQuota() 失败: %v", err)
+	}
+	if _, err := os.Stat(held); err != nil {
+		t.Error("保留的文件不应被容量回收删除")
+	}
+	if usage, _ := c.TrashUsage(); usage == nil || usage.Used != 1024 {
+		t.Errorf("保留的文件应计入用量: %+v", usage)
+	}
+
+	files, _ := c.ListTrashFiles()
+	if len(files) != 1 || files[0].HoldReason == "" {
+		t.Errorf("垃圾桶列表应显示保留原因: %+v", files)
+	}
+}
+
+func TestInterruptedTrashCopies(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: 7, HardDeleteDays: 30, PartialGraceHours: 72},
+	}
+	c := New(cfg, nil)
+
+	trash := filepath.Join(cfg.TrashDir(pair.Input), "show")
+	os.MkdirAll(trash, 0755)
+	source := filepath.Join(pair.Input, "show", "ep1.mkv")
+
+	// 上次中断的复制：再次移动同一文件时沿用其路径以便续传
+	earlier := filepath.Join(trash, "ep1.mkv_del_20260101_120000")
+	os.WriteFile(earlier+fileutil.PartialSuffix, make([]byte, 1024), 0644)
+	os.WriteFile(filepath.Join(trash, "ep1.mkv_del_other"+fileutil.PartialSuffix), nil, 0644)
+	if target, _ := c.trashTarget(source); target != earlier {
+		t.Errorf("trashTarget() = %s, want %s", target, earlier)
+	}
+	if target, _ := c.trashTarget(filepath.Join(pair.Input, "show", "ep2.mkv")); strings.HasPrefix(target, earlier) {
+		t.Errorf("其他文件不应沿用: %s", target)
+	}
+
+	// 未过宽限期的未完成复制计入用量但不删除，过期的彻底删除
+	stale := filepath.Join(trash, "old.mkv_del_20250101_120000"+fileutil.PartialSuffix)
+	os.WriteFile(stale, make([]byte, 512), 0644)
+	old := time.Now().Add(-100 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	if usage, err := c.TrashUsage(); err != nil || usage.Used != 1536 {
+		t.Errorf("未完成的复制应计入用量: %+v, %v", usage, err)
+	}
+	if err := c.emptyTrash(nil); err != nil {
+		t.Fatalf("emptyTrash() 失败: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("超过 partial_grace_hours 的未完成复制应被删除")
+	}
+	if _, err := os.Stat(earlier + fileutil.PartialSuffix); err != nil {
+		t.Error("宽限期内的未完成复制应保留")
+	}
+
+	// 容量回收不删除仍可能续传的文件
+	cfg.Cleaning.TrashMaxGB = 1.0 / 1024 / 1024 / 1024
+	if err := c.enforceTrashQuota(nil); err != nil {
+		t.Fatalf("enforceTrashQuota() 失败: %v", err)
+	}
+	if _, err := os.Stat(earlier + fileutil.PartialSuffix); err != nil {
+		t.Error("容量回收不应删除宽限期内的未完成复制")
+	}
+}
+
+func TestMoveToTrashChecksOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path: config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{
+			SoftDeleteDays:    -1,
+			HardDeleteDays:    30,
+			VerifyBeforeTrash: config.VerifyBeforeTrashExists,
+		},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "movie.mkv")
+	os.MkdirAll(pair.Input, 0755)
+	os.WriteFile(source, []byte("source"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 6}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+	db.UpdateTaskOutputSize(task.ID, 3)
+
+	// 输出缺失：保留源文件并告警，重复检查只合并为一条告警
+	c.moveToTrash(nil)
+	c.moveToTrash(nil)
+	if _, err := os.Stat(source); err != nil {
+		t.Fatalf("输出缺失时不应移动源文件: %v", err)
+	}
+	alerts, _ := db.GetActiveAlerts()
+	if len(alerts) != 1 || alerts[0].TaskID != task.ID || alerts[0].Kind != database.AlertPreTrashCheck || alerts[0].Count != 2 {
+		t.Fatalf("告警错误: %+v", alerts)
+	}
+
+	// 输出大小与转码完成时不一致同样阻止删除
+	output := filepath.Join(pair.Output, "movie.mkv")
+	os.MkdirAll(pair.Output, 0755)
+	os.WriteFile(output, []byte("x"), 0644)
+	c.moveToTrash(nil)
+	if _, err := os.Stat(source); err != nil {
+		t.Fatalf("输出大小不一致时不应移动源文件: %v", err)
+	}
+
+	// 输出完好后移入垃圾桶并关闭告警
+	os.WriteFile(output, []byte("out"), 0644)
+	c.moveToTrash(nil)
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("输出检查通过后源文件应移入垃圾桶: %v", err)
+	}
+	if alerts, _ := db.GetActiveAlerts(); len(alerts) != 0 {
+		t.Errorf("检查通过后告警应关闭: %+v", alerts)
+	}
+}
+
+func TestRunOnceDryRun(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: -1, HardDeleteDays: 30, HistoryDays: 90},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "movie.mkv")
+	os.MkdirAll(pair.Input, 0755)
+	os.WriteFile(source, []byte("source"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 6}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+
+	// 已过期的垃圾桶文件
+	trash := cfg.TrashDir(pair.Input)
+	os.MkdirAll(trash, 0755)
+	expired := filepath.Join(trash, "old.mkv_del_"+time.Now().AddDate(0, 0, -40).Format("20060102_150405"))
+	os.WriteFile(expired, []byte("expired"), 0644)
+
+	if _, err := c.RunOnce("weekly", TriggerManual, true); err == nil {
+		t.Error("无效的阶段应返回错误")
+	}
+
+	preview, err := c.RunOnce(PhaseAll, TriggerManual, true)
+	if err != nil {
+		t.Fatalf("RunOnce(dry_run) 失败: %v", err)
+	}
+	if preview.Run.Trashed != 1 || preview.Run.TrashedBytes != 6 || preview.Run.Purged != 1 || preview.Run.FreedBytes != 7 {
+		t.Errorf("试运行统计错误: %+v", preview.Run)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("试运行不应移动源文件: %v", err)
+	}
+	if _, err := os.Stat(expired); err != nil {
+		t.Errorf("试运行不应删除垃圾桶文件: %v", err)
+	}
+	if runs, _ := db.GetCleanerRuns(10, 0); len(runs) != 0 {
+		t.Errorf("试运行不应写入清理记录: %d", len(runs))
+	}
+
+	// 实际执行的操作与预览一致
+	report, err := c.RunOnce(PhaseAll, TriggerManual, false)
+	if err != nil {
+		t.Fatalf("RunOnce() 失败: %v", err)
+	}
+	if len(report.Actions) != len(preview.Actions) {
+		t.Fatalf("实际操作 %+v 与预览 %+v 不一致", report.Actions, preview.Actions)
+	}
+	for i := range report.Actions {
+		if report.Actions[i] != preview.Actions[i] {
+			t.Errorf("操作 %d 不一致: %+v vs %+v", i, report.Actions[i], preview.Actions[i])
+		}
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("过期文件应已删除: %v", err)
+	}
+
+	runs, _ := db.GetCleanerRuns(10, 0)
+	if len(runs) != 1 || runs[0].Trigger != TriggerManual || runs[0].Trashed != 1 || runs[0].FreedBytes != 7 || runs[0].FinishedAt == nil {
+		t.Errorf("清理记录错误: %+v", runs)
+	}
+}
+
+func TestArchiveSource(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{
+		Input:        filepath.Join(tempDir, "in"),
+		Output:       filepath.Join(tempDir, "out"),
+		SourcePolicy: config.SourcePolicyArchive,
+		ArchiveDir:   filepath.Join(tempDir, "cold"),
+	}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: -1, HardDeleteDays: 30},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "show", "ep1.mkv")
+	os.MkdirAll(filepath.Dir(source), 0755)
+	os.WriteFile(source, []byte("source"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 6}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+
+	report, err := c.RunOnce(PhaseSoft, TriggerManual, false)
+	if err != nil {
+		t.Fatalf("RunOnce() 失败: %v", err)
+	}
+	if report.Run.Archived != 1 || report.Run.ArchivedBytes != 6 || report.Run.Trashed != 0 {
+		t.Errorf("清理统计错误: %+v", report.Run)
+	}
+
+	// 保留相对路径，不进入垃圾桶
+	archived := filepath.Join(pair.ArchiveDir, "show", "ep1.mkv")
+	if data, err := os.ReadFile(archived); err != nil || string(data) != "source" {
+		t.Fatalf("源文件应归档到 %s: %v", archived, err)
+	}
+	if files, _ := c.ListTrashFiles(); len(files) != 0 {
+		t.Errorf("归档的源文件不应进入垃圾桶: %+v", files)
+	}
+
+	got, _ := db.GetTaskByID(task.ID)
+	if got.ArchivedPath != archived || got.SourceRemovedAt == nil {
+		t.Errorf("任务应记录归档位置: archived=%s removed=%v", got.ArchivedPath, got.SourceRemovedAt)
+	}
+	items, _ := db.GetArchiveItems(task.ID, 10, 0)
+	if len(items) != 1 || items[0].OriginalPath != source || items[0].ArchivePath != archived || items[0].Size != 6 {
+		t.Errorf("归档清单错误: %+v", items)
+	}
+}
+
+func TestSidecarsFollowSource(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{SoftDeleteDays: -1, HardDeleteDays: 30},
+		Sidecar:  config.SidecarConfig{Enabled: true, Patterns: config.DefaultSidecarPatterns},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "movie.mkv")
+	subtitle := filepath.Join(pair.Input, "movie.zh.srt")
+	nfo := filepath.Join(pair.Input, "movie.nfo")
+	unrelated := filepath.Join(pair.Input, "other.srt")
+	os.MkdirAll(pair.Input, 0755)
+	for _, path := range []string{source, subtitle, nfo, unrelated} {
+		os.WriteFile(path, []byte(filepath.Base(path)), 0644)
+	}
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 9}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+
+	if err := c.moveToTrash(nil); err != nil {
+		t.Fatalf("moveToTrash() 失败: %v", err)
+	}
+	for _, path := range []string{source, subtitle, nfo} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s 应随源文件移入垃圾桶", filepath.Base(path))
+		}
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("无关文件不应移动: %v", err)
+	}
+	items, _ := db.GetTrashedItemsByTask(task.ID, database.TrashReasonSidecar)
+	if len(items) != 2 {
+		t.Fatalf("伴随文件清单记录数 = %d, want 2", len(items))
+	}
+
+	// 恢复源文件时伴随文件一并恢复
+	files, _ := c.ListTrashFiles()
+	for _, f := range files {
+		if f.OriginalPath != source {
+			continue
+		}
+		if _, err := c.RestoreTrashItem(f.ID, false); err != nil {
+			t.Fatalf("RestoreTrashItem() 失败: %v", err)
+		}
+	}
+	for _, path := range []string{source, subtitle, nfo} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s 应已恢复: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestPruneEmptyDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	keepDir := filepath.Join(pair.Input, "keep")
+	cfg := &config.Config{
+		Path: config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{
+			PruneEmptyDirs:   true,
+			PruneMinAgeHours: 1,
+			PruneIgnore:      config.DefaultPruneIgnore,
+			PruneKeepDirs:    []string{keepDir},
+		},
+	}
+	c := New(cfg, nil)
+
+	show := filepath.Join(pair.Input, "show")
+	season := filepath.Join(show, "S01")
+	thumbs := filepath.Join(pair.Input, "photos", "@eaDir")
+	trash := filepath.Join(pair.Input, ".stm_trash", "show")
+	recent := filepath.Join(pair.Input, "recent")
+	busy := filepath.Join(pair.Input, "busy")
+	for _, dir := range []string{season, thumbs, trash, recent, busy, keepDir, pair.Output} {
+		os.MkdirAll(dir, 0755)
+	}
+	os.WriteFile(filepath.Join(thumbs, "SYNOINDEX_MEDIA_INFO"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(show, ".DS_Store"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(busy, "ep1.mkv"), []byte("video"), 0644)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, dir := range []string{season, show, thumbs, filepath.Dir(thumbs), trash, filepath.Dir(trash), busy, keepDir} {
+		os.Chtimes(dir, old, old)
+	}
+
+	// 试运行只列出将要删除的目录
+	run := newCleanRun(PhaseAll, TriggerManual, true)
+	c.pruneEmptyDirs(run)
+	if run.record.PrunedDirs != 5 {
+		t.Errorf("试运行应列出 5 个目录，实际 %d: %+v", run.record.PrunedDirs, run.actions)
+	}
+	if _, err := os.Stat(season); err != nil {
+		t.Fatalf("试运行不应删除目录: %v", err)
+	}
+
+	if err := c.pruneEmptyDirs(nil); err != nil {
+		t.Fatalf("pruneEmptyDirs() 失败: %v", err)
+	}
+	for _, dir := range []string{show, filepath.Dir(thumbs), filepath.Join(pair.Input, ".stm_trash")} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s 应已删除", dir)
+		}
+	}
+	for _, dir := range []string{pair.Input, pair.Output, recent, busy, keepDir} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s 应保留: %v", dir, err)
+		}
+	}
+}
+
+func TestSweepTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:     config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		Cleaning: config.CleaningConfig{TempGraceHours: 1},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	// 转码中的任务的中间文件
+	task := &database.Task{SourcePath: filepath.Join(pair.Input, "active.mkv"), SourceMtime: time.Now(), SourceSize: 5}
+	db.CreateTask(task)
+	db.UpdateTaskStatus(task.ID, database.StatusProcessing, "")
+
+	dir := filepath.Join(pair.Output, "show")
+	os.MkdirAll(filepath.Join(dir, "ep2.stm_tmp.salvage.mkv.segments"), 0755)
+	stale := filepath.Join(dir, "ep1.stm_tmp.mkv")
+	segments := filepath.Join(dir, "ep2.stm_tmp.salvage.mkv.segments")
+	active := filepath.Join(pair.Output, "active.stm_tmp.mkv")
+	recent := filepath.Join(dir, "ep3.stm_tmp.mkv")
+	output := filepath.Join(dir, "ep1.mkv")
+	for _, path := range []string{stale, filepath.Join(segments, "00000.mkv"), active, recent, output} {
+		os.WriteFile(path, []byte("12345"), 0644)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{stale, segments, filepath.Join(segments, "00000.mkv"), active, output} {
+		os.Chtimes(path, old, old)
+	}
+
+	report, err := c.RunOnce(PhaseTemp, TriggerManual, false)
+	if err != nil {
+		t.Fatalf("RunOnce() 失败: %v", err)
+	}
+	if report.Run.TempFiles != 2 || report.Run.TempBytes != 10 {
+		t.Errorf("应删除 2 个临时文件（10 字节），实际 %d（%d）", report.Run.TempFiles, report.Run.TempBytes)
+	}
+	for _, path := range []string{stale, segments} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s 应已删除", path)
+		}
+	}
+	for _, path := range []string{active, recent, output} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s 应保留: %v", path, err)
+		}
+	}
+
+	runs, _ := db.GetCleanerRuns(10, 0)
+	if len(runs) != 1 || runs[0].Phase != PhaseTemp || runs[0].TempFiles != 2 || runs[0].TempBytes != 10 {
+		t.Errorf("清理历史记录错误: %+v", runs)
+	}
+}
+
+func TestReconcileOutputs(t *testing.T) {
+	tempDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tempDir, "in"), Output: filepath.Join(tempDir, "out")}
+	cfg := &config.Config{
+		Path:   config.PathConfig{Pairs: []config.InputOutputPair{pair}, Trash: ".stm_trash"},
+		FFmpeg: config.FFmpegConfig{Extensions: []string{".mkv", ".mp4"}, OutputExtension: ".mp4"},
+		Verify: config.VerifyConfig{QuarantineDir: "broken"},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	// 有任务的输出、没有任务的输出（源文件仍在 / 已不存在）、垃圾桶、损坏输出隔离目录与字幕文件
+	tracked := filepath.Join(pair.Output, "show", "ep1.mp4")
+	renamed := filepath.Join(pair.Output, "show", "ep2.mp4")
+	deleted := filepath.Join(pair.Output, "movie.mp4")
+	for _, path := range []string{
+		tracked, renamed, deleted,
+		filepath.Join(pair.Output, "show", "ep1.srt"),
+		filepath.Join(pair.Output, ".stm_trash", "old.mp4_del_20260101_000000"),
+		filepath.Join(pair.Output, "broken", "bad.mp4"),
+		filepath.Join(pair.Input, "show", "ep2.mkv"),
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("12345"), 0644)
+	}
+	task := &database.Task{SourcePath: filepath.Join(pair.Input, "show", "ep1.mkv"), SourceMtime: time.Now(), SourceSize: 5}
+	db.CreateTask(task)
+
+	report, err := c.ReconcileOutputs()
+	if err != nil {
+		t.Fatalf("ReconcileOutputs() 失败: %v", err)
+	}
+	if report.Scanned != 3 || len(report.Orphans) != 2 || report.Size != 10 {
+		t.Fatalf("核对结果错误: scanned=%d orphans=%+v", report.Scanned, report.Orphans)
+	}
+	byPath := make(map[string]*database.OrphanOutput)
+	for _, o := range report.Orphans {
+		byPath[o.Path] = o
+	}
+	if byPath[renamed] == nil || byPath[renamed].SourcePath != filepath.Join(pair.Input, "show", "ep2.mkv") {
+		t.Errorf("应推断出输入目录中的同名源文件: %+v", byPath[renamed])
+	}
+
+	// 收养：源文件存在时为普通已完成任务，不存在时标记源文件已移除
+	results, err := c.AdoptOrphanOutputs([]int64{byPath[renamed].ID, byPath[deleted].ID})
+	if err != nil {
+		t.Fatalf("AdoptOrphanOutputs() 失败: %v", err)
+	}
+	for _, r := range results {
+		if r.Error != "" || r.TaskID == 0 {
+			t.Errorf("收养失败: %+v", r)
+		}
+	}
+	adopted, _ := db.GetTaskByPath(filepath.Join(pair.Input, "show", "ep2.mkv"))
+	if adopted == nil || adopted.Status != database.StatusCompleted || adopted.OutputSize != 5 || adopted.SourceRemovedAt != nil {
+		t.Errorf("收养的任务错误: %+v", adopted)
+	}
+	gone, _ := db.GetTaskByPath(filepath.Join(pair.Input, "movie.mp4"))
+	if gone == nil || gone.SourceRemovedAt == nil {
+		t.Errorf("源文件不存在时应标记为已移除: %+v", gone)
+	}
+	if items, _ := db.GetOrphanOutputs(); len(items) != 0 {
+		t.Errorf("收养后报告应为空: %+v", items)
+	}
+
+	// 再次核对不再报告已收养的输出；删除将文件移入垃圾桶
+	os.WriteFile(filepath.Join(pair.Output, "extra.mp4"), []byte("12345"), 0644)
+	report, _ = c.ReconcileOutputs()
+	if len(report.Orphans) != 1 {
+		t.Fatalf("应只剩 1 个无主输出: %+v", report.Orphans)
+	}
+	results, _ = c.DeleteOrphanOutputs([]int64{report.Orphans[0].ID, 9999})
+	if results[0].Error != "" || results[1].Error == "" {
+		t.Errorf("删除结果错误: %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(pair.Output, "extra.mp4")); !os.IsNotExist(err) {
+		t.Error("删除的无主输出应已移入垃圾桶")
+	}
+}
+
+func TestReconcileRemovedPair(t *testing.T) {
+	tempDir := t.TempDir()
+	kept := config.InputOutputPair{Input: filepath.Join(tempDir, "a"), Output: filepath.Join(tempDir, "a_out")}
+	removed := config.InputOutputPair{Input: filepath.Join(tempDir, "b"), Output: filepath.Join(tempDir, "b_out")}
+	cfg := &config.Config{
+		Path:   config.PathConfig{Pairs: []config.InputOutputPair{kept, removed}, Trash: ".stm_trash"},
+		FFmpeg: config.FFmpegConfig{Extensions: []string{".mkv", ".mp4"}},
+	}
+
+	db, err := database.Init(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	c := New(cfg, db)
+
+	tracked := filepath.Join(removed.Output, "ep1.mkv")
+	leftover := filepath.Join(removed.Output, "ep2.mkv")
+	for _, path := range []string{tracked, leftover} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("12345"), 0644)
+	}
+	db.CreateTask(&database.Task{SourcePath: filepath.Join(removed.Input, "ep1.mkv"), SourceMtime: time.Now(), SourceSize: 5})
+
+	// 配对仍在配置中时记录，之后从配置中删除
+	if _, err := c.ReconcileOutputs(); err != nil {
+		t.Fatalf("ReconcileOutputs() 失败: %v", err)
+	}
+	cfg.Path.Pairs = []config.InputOutputPair{kept}
+
+	report, err := c.ReconcileOutputs()
+	if err != nil {
+		t.Fatalf("ReconcileOutputs() 失败: %v", err)
+	}
+	if report.Scanned != 2 || len(report.Orphans) != 1 {
+		t.Fatalf("已删除配对的输出应继续核对: scanned=%d orphans=%+v", report.Scanned, report.Orphans)
+	}
+	if o := report.Orphans[0]; o.Path != leftover || o.Pair != removed.Input || o.SourcePath != filepath.Join(removed.Input, "ep2.mkv") {
+		t.Errorf("无主输出记录错误: %+v", o)
+	}
+}
@@ -0,0 +1,74 @@
+package cleaner
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+// handleOrphans 按 orphan_policy 处理孤立任务的输出文件
+// keep 策略只保留标记供人工审核；delete/trash 处理后输出不再存在，重复执行无副作用
+func (c *Cleaner) handleOrphans(run *cleanRun) error {
+	policy := c.config.Cleaning.OrphanPolicy
+	if policy == "" || policy == config.OrphanPolicyKeep {
+		return nil
+	}
+
+	batchSize := 200
+	offset := 0
+	handled := 0
+
+	for {
+		tasks, err := c.db.GetAllTasks(string(database.StatusOrphaned), batchSize, offset)
+		if err != nil {
+			return fmt.Errorf("查询孤立任务失败: %w", err)
+		}
+		if len(tasks) == 0 {
+			break
+		}
+
+		for _, task := range tasks {
+			outputPath := c.config.ExistingOutputPath(task.SourcePath, task.OutputPath)
+			if outputPath == "" {
+				continue
+			}
+
+			size := fileSize(outputPath)
+			if run.dry() {
+				run.add(RunAction{Action: "orphan", Path: outputPath, TaskID: task.ID, Size: size, Reason: policy})
+				if policy == config.OrphanPolicyTrash {
+					c.planPending(run, outputPath, size)
+				}
+				continue
+			}
+
+			switch policy {
+			case config.OrphanPolicyDelete:
+				err = os.Remove(outputPath)
+			case config.OrphanPolicyTrash:
+				err = c.trashFile(outputPath, task.ID, database.TrashReasonOrphan)
+			}
+			if err != nil {
+				log.Printf("[Cleaner] 处理孤立任务输出失败 %s: %v", outputPath, err)
+				continue
+			}
+
+			handled++
+			run.add(RunAction{Action: "orphan", Path: outputPath, TaskID: task.ID, Size: size, Reason: policy})
+			log.Printf("[Cleaner] 孤立任务输出已处理（%s）: %s", policy, outputPath)
+			if err := c.db.UpdateTaskStatus(task.ID, database.StatusOrphaned, "源文件已在外部删除，输出已按策略处理: "+policy); err != nil {
+				log.Printf("[Cleaner] 更新孤立任务日志失败 %s: %v", task.SourcePath, err)
+			}
+		}
+
+		offset += len(tasks)
+	}
+
+	if handled > 0 {
+		log.Printf("[Cleaner] 共处理 %d 个孤立任务的输出（策略: %s）", handled, policy)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cleaner
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// checkOutput 源文件移入垃圾桶前按 verify_before_trash 检查输出，返回错误时不得删除源文件
+func (c *Cleaner) checkOutput(task *database.Task, srcPath string) error {
+	level := c.config.Cleaning.VerifyBeforeTrash
+	if level == "" || level == config.VerifyBeforeTrashNone {
+		return nil
+	}
+
+	outputPath, err := c.locateOutput(task)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("输出文件访问失败: %w", err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("输出文件为空: %s", outputPath)
+	}
+	if task.OutputSize > 0 && info.Size() != task.OutputSize {
+		return fmt.Errorf("输出文件大小与转码完成时不一致（记录 %d，实际 %d）: %s", task.OutputSize, info.Size(), outputPath)
+	}
+	if level == config.VerifyBeforeTrashExists {
+		return nil
+	}
+
+	probeTimeout := time.Duration(c.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	if probeTimeout <= 0 {
+		probeTimeout = 30 * time.Second
+	}
+	if err := media.ProbeFile(outputPath, probeTimeout, 0); err != nil {
+		return fmt.Errorf("输出文件无法读取 %s: %w", outputPath, err)
+	}
+	if level == config.VerifyBeforeTrashProbe {
+		return nil
+	}
+
+	sourceDuration, err := media.ProbeDuration(srcPath, probeTimeout)
+	if err != nil {
+		return fmt.Errorf("读取源文件时长失败: %w", err)
+	}
+	outputDuration, err := media.ProbeDuration(outputPath, probeTimeout)
+	if err != nil {
+		return fmt.Errorf("读取输出文件时长失败: %w", err)
+	}
+	if diff := math.Abs(sourceDuration - outputDuration); diff > c.config.FFmpeg.DurationTolerance(sourceDuration) {
+		return fmt.Errorf("输出时长 %.1fs 与源文件 %.1fs 不一致: %s", outputDuration, sourceDuration, outputPath)
+	}
+	return nil
+}
+
+// locateOutput 查找任务的输出文件（优先统一扩展名后的路径）
+func (c *Cleaner) locateOutput(task *database.Task) (string, error) {
+	basePath, ok := c.config.ResolveOutputBase(task.SourcePath, task.OutputPath)
+	if !ok {
+		return "", fmt.Errorf("无法确定输出路径（源文件不属于任何监控目录）")
+	}
+
+	primaryPath := c.config.ApplyOutputExtension(basePath)
+	for _, path := range []string{primaryPath, basePath} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("输出文件不存在: %s", primaryPath)
+}
@@ -0,0 +1,166 @@
+package cleaner
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pruneEmptyDirs 删除输入目录下的空目录（或只含可忽略文件的目录），包括垃圾桶、隔离区中的空目录
+// 配对的输入、输出、归档目录及 prune_keep_dirs 永不删除；试运行时只列出将要删除的目录
+func (c *Cleaner) pruneEmptyDirs(run *cleanRun) error {
+	if !c.config.Cleaning.PruneEmptyDirs {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-time.Duration(c.config.Cleaning.PruneMinAgeHours) * time.Hour)
+	keep := c.pruneKeepDirs()
+	pruned := 0
+	for _, root := range c.pruneRoots() {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		n, _ := c.pruneDir(root, keep, cutoff, run)
+		pruned += n
+	}
+
+	if pruned > 0 && !run.dry() {
+		log.Printf("[Cleaner] 共删除 %d 个空目录", pruned)
+	}
+	return nil
+}
+
+// pruneRoots 需要检查空目录的输入目录
+func (c *Cleaner) pruneRoots() []string {
+	var roots []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if dir != "" && !seen[filepath.Clean(dir)] {
+			seen[filepath.Clean(dir)] = true
+			roots = append(roots, filepath.Clean(dir))
+		}
+	}
+	for _, pair := range c.config.Path.Pairs {
+		add(pair.Input)
+	}
+	add(c.config.Path.Input)
+	return roots
+}
+
+// pruneKeepDirs 永不删除的目录
+func (c *Cleaner) pruneKeepDirs() map[string]bool {
+	keep := make(map[string]bool)
+	add := func(dir string) {
+		if dir != "" {
+			keep[filepath.Clean(dir)] = true
+		}
+	}
+	for _, pair := range c.config.Path.Pairs {
+		add(pair.Input)
+		add(pair.Output)
+		add(pair.ArchiveDir)
+	}
+	add(c.config.Path.Input)
+	add(c.config.Path.Output)
+	for _, dir := range c.config.Cleaning.PruneKeepDirs {
+		add(dir)
+	}
+	return keep
+}
+
+// pruneDir 自底向上处理目录，返回删除（试运行时为将要删除）的目录数及 dir 本身是否删除
+func (c *Cleaner) pruneDir(dir string, keep map[string]bool, cutoff time.Time, run *cleanRun) (int, bool) {
+	// 在处理子目录前读取修改时间：删除子目录会更新父目录的修改时间
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return 0, false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("[Cleaner] 读取目录失败 %s: %v", dir, err)
+		return 0, false
+	}
+
+	pruned := 0
+	empty := true
+	var ignored []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if c.pruneIgnored(entry.Name()) {
+			ignored = append(ignored, path)
+			continue
+		}
+		// 符号链接不跟随，视为普通文件
+		if entry.IsDir() {
+			n, removed := c.pruneDir(path, keep, cutoff, run)
+			pruned += n
+			if removed {
+				continue
+			}
+		} else if run.isGone(path) {
+			// 试运行中将要移走的文件
+			continue
+		}
+		empty = false
+	}
+
+	// 试运行中将要移入垃圾桶的文件会落在该目录下
+	if empty && run.dry() {
+		for _, e := range run.pending {
+			if strings.HasPrefix(e.path, dir+string(filepath.Separator)) {
+				empty = false
+				break
+			}
+		}
+	}
+	if !empty || keep[filepath.Clean(dir)] || info.ModTime().After(cutoff) {
+		return pruned, false
+	}
+
+	var size int64
+	for _, path := range ignored {
+		size += treeSize(path)
+	}
+	if !run.dry() {
+		for _, path := range ignored {
+			if err := os.RemoveAll(path); err != nil {
+				log.Printf("[Cleaner] 删除可忽略文件失败 %s: %v", path, err)
+				return pruned, false
+			}
+		}
+		if err := os.Remove(dir); err != nil {
+			log.Printf("[Cleaner] 删除空目录失败 %s: %v", dir, err)
+			return pruned, false
+		}
+		log.Printf("[Cleaner] 已删除空目录: %s", dir)
+	}
+	run.add(RunAction{Action: "prune", Path: dir, Size: size})
+	return pruned + 1, true
+}
+
+// pruneIgnored 文件名是否匹配 prune_ignore
+func (c *Cleaner) pruneIgnored(name string) bool {
+	for _, pattern := range c.config.Cleaning.PruneIgnore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// treeSize 文件或目录下所有文件的大小
+func treeSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
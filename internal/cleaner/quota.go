@@ -0,0 +1,271 @@
+package cleaner
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/metrics"
+)
+
+// trashEntry 垃圾桶中的一个文件
+type trashEntry struct {
+	root       trashRoot
+	path       string
+	size       int64
+	deleteTime time.Time
+	evicted    bool
+	held       bool // 不允许自动彻底删除
+}
+
+// TrashUsage 单个配对的垃圾桶用量（字节）
+type TrashUsage struct {
+	Pair      string `json:"pair"`
+	Files     int    `json:"files"`
+	Used      int64  `json:"used"`      // 当前占用
+	Pending   int64  `json:"pending"`   // 已完成转码、源文件尚未移入垃圾桶的大小
+	Projected int64  `json:"projected"` // 预计占用 = 当前占用 + 待移入
+	Limit     int64  `json:"limit"`     // 容量上限，0为不限制
+}
+
+// TrashUsageReport 垃圾桶用量汇总
+type TrashUsageReport struct {
+	Pairs     []TrashUsage `json:"pairs"`
+	Used      int64        `json:"used"`
+	Pending   int64        `json:"pending"`
+	Projected int64        `json:"projected"`
+	Limit     int64        `json:"limit"`    // 全局容量上限，0为不限制
+	MinFree   int64        `json:"min_free"` // 磁盘最低剩余空间，0为不检查
+}
+
+// collectTrash 收集所有垃圾桶中的文件，最早移入的在前
+// 本次清理中已（将要）彻底删除的文件不计入，试运行中将要移入的文件计入；
+// 不允许自动删除的文件及仍可能续传的未完成复制计入用量但不会被回收
+func (c *Cleaner) collectTrash(run *cleanRun) ([]*trashEntry, error) {
+	var entries []*trashEntry
+	held := c.heldTrashPaths()
+	err := c.walkTrash(func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time) {
+		if run.isPurged(path) {
+			return
+		}
+		entries = append(entries, &trashEntry{root: root, path: path, size: info.Size(), deleteTime: deleteTime, held: held[path]})
+	})
+	partialCutoff := c.partialCutoff()
+	if pErr := c.walkTrashPartials(func(root trashRoot, path string, info fs.FileInfo, modTime time.Time) {
+		if run.isPurged(path) {
+			return
+		}
+		entries = append(entries, &trashEntry{root: root, path: path, size: info.Size(), deleteTime: modTime,
+			held: !modTime.Before(partialCutoff)})
+	}); err == nil {
+		err = pErr
+	}
+	if run.dry() {
+		entries = append(entries, run.pending...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].deleteTime.Before(entries[j].deleteTime)
+	})
+	return entries, err
+}
+
+// enforceTrashQuota 按配对上限、全局上限、磁盘剩余空间下限的顺序，从最早移入的文件开始删除
+func (c *Cleaner) enforceTrashQuota(run *cleanRun) error {
+	entries, err := c.collectTrash(run)
+	if err != nil {
+		return err
+	}
+	evicted := 0
+
+	// 配对容量上限
+	usedByPair := make(map[string]int64)
+	for _, e := range entries {
+		usedByPair[e.root.Pair] += e.size
+	}
+	for _, pair := range c.config.Path.Pairs {
+		limit := gbToBytes(pair.TrashMaxGB)
+		if limit <= 0 {
+			continue
+		}
+		used := usedByPair[pair.Input]
+		reason := fmt.Sprintf("配对垃圾桶超过 %.1fGB 上限", pair.TrashMaxGB)
+		for _, e := range entries {
+			if used <= limit {
+				break
+			}
+			if e.evicted || e.root.Pair != pair.Input {
+				continue
+			}
+			if c.evict(e, reason, run) {
+				used -= e.size
+				evicted++
+			}
+		}
+	}
+
+	// 全局容量上限
+	if limit := gbToBytes(c.config.Cleaning.TrashMaxGB); limit > 0 {
+		var total int64
+		for _, e := range entries {
+			if !e.evicted {
+				total += e.size
+			}
+		}
+		reason := fmt.Sprintf("垃圾桶合计超过 %.1fGB 上限", c.config.Cleaning.TrashMaxGB)
+		for _, e := range entries {
+			if total <= limit {
+				break
+			}
+			if !e.evicted && c.evict(e, reason, run) {
+				total -= e.size
+				evicted++
+			}
+		}
+	}
+
+	// 磁盘剩余空间下限：只删除该磁盘上垃圾桶中的文件
+	if minFree := gbToBytes(c.config.Cleaning.TrashMinFreeGB); minFree > 0 {
+		reason := fmt.Sprintf("磁盘剩余空间低于 %.1fGB", c.config.Cleaning.TrashMinFreeGB)
+		for _, root := range c.trashRoots() {
+			free, err := freeSpace(root.Dir)
+			if err != nil {
+				continue // 垃圾桶目录不存在
+			}
+			for _, e := range entries {
+				if free >= minFree {
+					break
+				}
+				if e.evicted || e.root.Dir != root.Dir {
+					continue
+				}
+				if c.evict(e, reason, run) {
+					evicted++
+					if run.dry() {
+						free += e.size
+					} else if free, err = freeSpace(root.Dir); err != nil {
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if evicted > 0 && !run.dry() {
+		log.Printf("[Cleaner] 垃圾桶容量回收完成，共删除 %d 个文件", evicted)
+	}
+	return nil
+}
+
+// evict 提前彻底删除垃圾桶中的文件并记录原因
+func (c *Cleaner) evict(e *trashEntry, reason string, run *cleanRun) bool {
+	if e.held {
+		return false
+	}
+	if run.dry() {
+		e.evicted = true
+		run.add(RunAction{Action: "purge", Path: e.path, Size: e.size, Reason: reason})
+		return true
+	}
+	if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Cleaner] 删除文件失败 %s: %v", e.path, err)
+		return false
+	}
+	e.evicted = true
+	run.add(RunAction{Action: "purge", Path: e.path, Size: e.size, Reason: reason})
+	c.resolveTrashPath(e.path, database.TrashPurged, reason)
+	log.Printf("[Cleaner] 垃圾桶容量回收，删除 %s（%.2f MB，移入于 %s，原因: %s）",
+		e.path, float64(e.size)/1024/1024, e.deleteTime.Format("2006-01-02 15:04"), reason)
+
+	// 更新 Prometheus metrics
+	metrics.FilesHardDeleted.Inc()
+	return true
+}
+
+// TrashUsage 统计各配对垃圾桶的当前与预计用量
+func (c *Cleaner) TrashUsage() (*TrashUsageReport, error) {
+	entries, err := c.collectTrash(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TrashUsageReport{
+		Limit:   gbToBytes(c.config.Cleaning.TrashMaxGB),
+		MinFree: gbToBytes(c.config.Cleaning.TrashMinFreeGB),
+	}
+	usage := make(map[string]*TrashUsage)
+	for _, pair := range c.config.Path.Pairs {
+		u := &TrashUsage{Pair: pair.Input, Limit: gbToBytes(pair.TrashMaxGB)}
+		usage[pair.Input] = u
+	}
+	get := func(pair string) *TrashUsage {
+		if u, ok := usage[pair]; ok {
+			return u
+		}
+		u := &TrashUsage{Pair: pair}
+		usage[pair] = u
+		return u
+	}
+
+	for _, e := range entries {
+		u := get(e.root.Pair)
+		u.Files++
+		u.Used += e.size
+	}
+
+	// 已完成但源文件尚未移入垃圾桶的任务会在 soft_delete_days 内进入垃圾桶
+	if c.db != nil {
+		tasks, err := c.db.GetCompletedUnremovedTasks()
+		if err != nil {
+			return nil, fmt.Errorf("查询待移入垃圾桶的任务失败: %w", err)
+		}
+		for _, task := range tasks {
+			pair, _, ok := c.config.FindPair(task.SourcePath)
+			if !ok || pair.SourcePolicy == config.SourcePolicyArchive {
+				continue // 归档的源文件不进入垃圾桶
+			}
+			get(pair.Input).Pending += task.SourceSize
+		}
+	}
+
+	// 按配置顺序输出，未配置的来源（旧版 path.input）排在最后
+	seen := make(map[string]bool)
+	appendUsage := func(pair string) {
+		if seen[pair] {
+			return
+		}
+		seen[pair] = true
+		u := usage[pair]
+		u.Projected = u.Used + u.Pending
+		report.Used += u.Used
+		report.Pending += u.Pending
+		report.Pairs = append(report.Pairs, *u)
+	}
+	for _, pair := range c.config.Path.Pairs {
+		appendUsage(pair.Input)
+	}
+	for pair := range usage {
+		appendUsage(pair)
+	}
+	report.Projected = report.Used + report.Pending
+	return report, nil
+}
+
+// freeSpace 返回路径所在磁盘的可用空间（字节）
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// gbToBytes GB 转换为字节
+func gbToBytes(gb float64) int64 {
+	return int64(gb * 1024 * 1024 * 1024)
+}
@@ -0,0 +1,352 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+)
+
+// ErrOrphanOutputNotFound 无主输出记录不存在或已处理
+var ErrOrphanOutputNotFound = errors.New("无主输出记录不存在或已处理")
+
+// ReconcileReport 一次输出目录核对的结果
+type ReconcileReport struct {
+	Scanned int                      `json:"scanned"` // 检查的输出文件数
+	Orphans []*database.OrphanOutput `json:"orphans"` // 没有对应任务的输出
+	Size    int64                    `json:"size"`    // 无主输出合计大小
+}
+
+// OrphanOutputResult 批量处理无主输出的单项结果
+type OrphanOutputResult struct {
+	ID     int64  `json:"id"`
+	Path   string `json:"path"`
+	TaskID int64  `json:"task_id,omitempty"` // 收养后创建的任务
+	Error  string `json:"error,omitempty"`
+}
+
+// ReconcileOutputs 立即核对输出目录并返回无主输出报告；已有清理在运行时返回 ErrRunning
+func (c *Cleaner) ReconcileOutputs() (*ReconcileReport, error) {
+	if !c.tryStart() {
+		return nil, ErrRunning
+	}
+	defer c.finish()
+
+	scanned, err := c.reconcile()
+	if err != nil {
+		return nil, err
+	}
+	orphans, err := c.db.GetOrphanOutputs()
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{Scanned: scanned, Orphans: orphans}
+	for _, o := range orphans {
+		report.Size += o.Size
+	}
+	if report.Orphans == nil {
+		report.Orphans = []*database.OrphanOutput{}
+	}
+	return report, nil
+}
+
+// reconcileOutputs 清理中的核对步骤（reconcile_outputs 开启时），试运行不更新报告
+// 未开启时只记录当前配对，之后手动核对时仍能找到已删除配对的输出
+func (c *Cleaner) reconcileOutputs(run *cleanRun) error {
+	if run.dry() || c.db == nil {
+		return nil
+	}
+	if !c.config.Cleaning.ReconcileOutputs {
+		return c.recordOutputRoots()
+	}
+	_, err := c.reconcile()
+	return err
+}
+
+// reconcile 遍历各配对（含已从配置中删除的配对）的输出目录，按配对映射与 ApplyOutputExtension
+// 将输出文件对应到任务，没有对应任务的文件写入无主输出报告，本次未再发现的记录删除
+func (c *Cleaner) reconcile() (int, error) {
+	roots, err := c.reconcileRoots()
+	if err != nil {
+		return 0, err
+	}
+	expected, err := c.expectedOutputs(roots)
+	if err != nil {
+		return 0, err
+	}
+
+	skip := c.skippedOutputDirs()
+	for _, root := range roots {
+		skip[root.Output] = true // 嵌套的输出目录单独遍历
+	}
+	start := time.Now()
+	scanned, found := 0, 0
+	for _, root := range roots {
+		if _, err := os.Stat(root.Output); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root.Output, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				// 跳过垃圾桶、归档目录、隔离区（源文件与损坏输出）和抢救用的中间目录
+				if path != root.Output && (skip[path] || c.isQuarantineDir(d.Name()) || strings.Contains(d.Name(), tempMarker)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !c.isOutputFile(d.Name()) {
+				return nil
+			}
+			// 输入与输出目录重叠时跳过源文件
+			if _, ok := findRoot(roots, path); ok {
+				return nil
+			}
+			scanned++
+			if expected[path] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			rel, _ := filepath.Rel(root.Output, path)
+			o := &database.OrphanOutput{
+				Pair:       root.Input,
+				Path:       path,
+				SourcePath: c.inferSource(root.Input, rel),
+				Size:       info.Size(),
+				Mtime:      info.ModTime(),
+				LastSeenAt: start,
+			}
+			if err := c.db.UpsertOrphanOutput(o); err != nil {
+				return fmt.Errorf("记录无主输出失败: %w", err)
+			}
+			found++
+			return nil
+		})
+		if err != nil {
+			return scanned, err
+		}
+	}
+
+	if _, err := c.db.DeleteOrphanOutputsSeenBefore(start); err != nil {
+		return scanned, fmt.Errorf("清理无主输出记录失败: %w", err)
+	}
+	log.Printf("[Cleaner] 输出目录核对完成: 检查 %d 个文件，无主输出 %d 个", scanned, found)
+	return scanned, nil
+}
+
+// recordOutputRoots 记录当前配置的配对，配对删除后仍可核对其输出目录（每次清理都会记录）
+func (c *Cleaner) recordOutputRoots() error {
+	now := time.Now()
+	for _, pair := range c.config.Path.Pairs {
+		if err := c.db.RecordOutputRoot(filepath.Clean(pair.Input), filepath.Clean(pair.Output), now); err != nil {
+			return fmt.Errorf("记录配对失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// reconcileRoots 需要核对的全部配对：当前配对在前，
+// 之后是数据库中记录过、已从配置中删除的配对（其输出可能仍留在磁盘上）
+func (c *Cleaner) reconcileRoots() ([]config.InputOutputPair, error) {
+	if err := c.recordOutputRoots(); err != nil {
+		return nil, err
+	}
+
+	var roots []config.InputOutputPair
+	seen := make(map[string]bool)
+	for _, pair := range c.config.Path.Pairs {
+		output := filepath.Clean(pair.Output)
+		if !seen[output] {
+			seen[output] = true
+			roots = append(roots, config.InputOutputPair{Input: filepath.Clean(pair.Input), Output: output})
+		}
+	}
+
+	recorded, err := c.db.GetOutputRoots()
+	if err != nil {
+		return nil, fmt.Errorf("查询历史配对失败: %w", err)
+	}
+	for _, r := range recorded {
+		if !seen[r.Output] {
+			seen[r.Output] = true
+			roots = append(roots, config.InputOutputPair{Input: r.Input, Output: r.Output})
+		}
+	}
+	return roots, nil
+}
+
+// findRoot 查找路径所在输入目录的配对（当前配对优先），返回相对路径
+func findRoot(roots []config.InputOutputPair, path string) (string, bool) {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root.Input, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(root.Output, rel), true
+		}
+	}
+	return "", false
+}
+
+// expectedOutputs 所有任务对应的输出路径（统一扩展名前后的路径都计入）
+// 配对已删除的任务按记录的历史配对映射
+func (c *Cleaner) expectedOutputs(roots []config.InputOutputPair) (map[string]bool, error) {
+	expected := make(map[string]bool)
+	batchSize := 500
+	for offset := 0; ; {
+		tasks, err := c.db.GetAllTasks("", batchSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("查询任务失败: %w", err)
+		}
+		if len(tasks) == 0 {
+			break
+		}
+		for _, task := range tasks {
+			basePath, ok := c.config.ResolveOutputBase(task.SourcePath, task.OutputPath)
+			if !ok {
+				if basePath, ok = findRoot(roots, task.SourcePath); !ok {
+					continue
+				}
+			}
+			expected[basePath] = true
+			expected[c.config.ApplyOutputExtension(basePath)] = true
+		}
+		offset += len(tasks)
+	}
+	return expected, nil
+}
+
+// skippedOutputDirs 核对时跳过的目录：垃圾桶和归档目录
+func (c *Cleaner) skippedOutputDirs() map[string]bool {
+	skip := make(map[string]bool)
+	for _, root := range c.trashRoots() {
+		skip[filepath.Clean(root.Dir)] = true
+	}
+	for _, pair := range c.config.Path.Pairs {
+		if pair.ArchiveDir != "" {
+			skip[filepath.Clean(pair.ArchiveDir)] = true
+		}
+	}
+	return skip
+}
+
+// isQuarantineDir 是否为源文件隔离区或校验发现的损坏输出隔离目录
+// 已判定损坏的输出不应出现在无主输出报告中，否则可能被收养为已完成任务
+func (c *Cleaner) isQuarantineDir(name string) bool {
+	return (c.config.Quarantine.Dir != "" && name == c.config.Quarantine.Dir) ||
+		(c.config.Verify.QuarantineDir != "" && name == c.config.Verify.QuarantineDir)
+}
+
+// isOutputFile 是否为转码输出（视频扩展名或配置的输出扩展名），中间文件除外
+func (c *Cleaner) isOutputFile(name string) bool {
+	if strings.Contains(name, tempMarker) || strings.HasSuffix(name, fileutil.PartialSuffix) {
+		return false
+	}
+	if c.config.IsVideoFile(name) {
+		return true
+	}
+	// 统一的输出扩展名可能不在输入扩展名列表中
+	return c.config.FFmpeg.OutputExtension != "" && c.config.ApplyOutputExtension(name) == name
+}
+
+// inferSource 按配对映射推断输出对应的源文件：输入目录中同名（任意视频扩展名）的文件优先
+func (c *Cleaner) inferSource(input, rel string) string {
+	source := filepath.Join(input, rel)
+	stem := strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+	entries, err := os.ReadDir(filepath.Dir(source))
+	if err != nil {
+		return source
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && c.config.IsVideoFile(name) && strings.TrimSuffix(name, filepath.Ext(name)) == stem {
+			return filepath.Join(filepath.Dir(source), name)
+		}
+	}
+	return source
+}
+
+// DeleteOrphanOutputs 将选中的无主输出移入所在输出目录的垃圾桶
+func (c *Cleaner) DeleteOrphanOutputs(ids []int64) ([]OrphanOutputResult, error) {
+	return c.handleOrphanOutputs(ids, func(o *database.OrphanOutput, result *OrphanOutputResult) error {
+		if err := c.trashFile(o.Path, 0, database.TrashReasonOrphan); err != nil {
+			return err
+		}
+		log.Printf("[Cleaner] 无主输出已移入垃圾桶: %s", o.Path)
+		return nil
+	})
+}
+
+// AdoptOrphanOutputs 为选中的无主输出创建已完成的任务，源文件路径为推断的路径
+// 推断的源文件不存在时任务标记为源文件已移除，清理模块不会再处理
+func (c *Cleaner) AdoptOrphanOutputs(ids []int64) ([]OrphanOutputResult, error) {
+	return c.handleOrphanOutputs(ids, func(o *database.OrphanOutput, result *OrphanOutputResult) error {
+		existing, err := c.db.GetTaskByPath(o.SourcePath)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("源文件已有任务 #%d", existing.ID)
+		}
+
+		task := &database.Task{SourcePath: o.SourcePath, SourceMtime: o.Mtime, OutputSize: o.Size}
+		sourceInfo, statErr := os.Stat(o.SourcePath)
+		if statErr == nil {
+			task.SourceMtime = sourceInfo.ModTime()
+			task.SourceSize = sourceInfo.Size()
+		}
+		// 输出不在推断源文件的映射路径上时（如扩展名不同）记录为覆盖路径
+		if base, ok := c.config.ResolveOutputBase(o.SourcePath, ""); !ok || c.config.ApplyOutputExtension(base) != o.Path {
+			task.OutputPath = o.Path
+		}
+		note := "从无主输出收养: " + o.Path
+		if err := c.db.CreateAdoptedTask(task, note, statErr != nil); err != nil {
+			return err
+		}
+		result.TaskID = task.ID
+		log.Printf("[Cleaner] 无主输出已收养为任务 #%d: %s", task.ID, o.Path)
+		return nil
+	})
+}
+
+// handleOrphanOutputs 逐个处理无主输出，成功后删除报告记录；与清理互斥
+func (c *Cleaner) handleOrphanOutputs(ids []int64, fn func(o *database.OrphanOutput, result *OrphanOutputResult) error) ([]OrphanOutputResult, error) {
+	if !c.tryStart() {
+		return nil, ErrRunning
+	}
+	defer c.finish()
+
+	results := make([]OrphanOutputResult, 0, len(ids))
+	for _, id := range ids {
+		result := OrphanOutputResult{ID: id}
+		o, err := c.db.GetOrphanOutput(id)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case o == nil:
+			result.Error = ErrOrphanOutputNotFound.Error()
+		default:
+			result.Path = o.Path
+			if _, err := os.Stat(o.Path); err != nil {
+				result.Error = "输出文件已不存在"
+				c.db.DeleteOrphanOutput(id)
+			} else if err := fn(o, &result); err != nil {
+				result.Error = err.Error()
+			} else if err := c.db.DeleteOrphanOutput(id); err != nil {
+				log.Printf("[Cleaner] 删除无主输出记录失败 %s: %v", o.Path, err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
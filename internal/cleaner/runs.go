@@ -0,0 +1,249 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+// ErrRunning 已有清理任务在运行
+var ErrRunning = errors.New("清理任务正在运行")
+
+// 清理阶段
+const (
+	PhaseSoft = "soft" // 移入垃圾桶、处理孤立任务输出
+	PhaseHard = "hard" // 清空过期垃圾、容量回收
+	PhaseTemp = "temp" // 只删除残留的转码临时文件（启动时执行）
+	PhaseAll  = "all"
+)
+
+// 清理触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerStartup  = "startup"
+	TriggerManual   = "manual"
+)
+
+// RunAction 清理中的单个文件操作
+type RunAction struct {
+	Action string `json:"action"` // trash=移入垃圾桶 archive=归档 purge=彻底删除 orphan=处理孤立输出 blocked=输出检查未通过 prune=删除空目录 temp=删除残留临时文件
+	Path   string `json:"path"`
+	TaskID int64  `json:"task_id,omitempty"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RunReport 一次清理的结果；dry_run 时为将要执行的操作，文件不会被改动
+type RunReport struct {
+	DryRun  bool                 `json:"dry_run"`
+	Run     *database.CleanerRun `json:"run"`
+	Actions []RunAction          `json:"actions"`
+}
+
+// cleanRun 一次清理的执行状态，为 nil 时只执行不记录
+type cleanRun struct {
+	dryRun  bool
+	record  *database.CleanerRun
+	actions []RunAction
+	purged  map[string]bool // 已（将要）彻底删除的垃圾桶文件
+	gone    map[string]bool // 已（将要）移走或删除的文件
+	pending []*trashEntry   // 试运行中将要移入垃圾桶的文件
+}
+
+func newCleanRun(phase, trigger string, dryRun bool) *cleanRun {
+	return &cleanRun{
+		dryRun: dryRun,
+		record: &database.CleanerRun{Trigger: trigger, Phase: phase, StartedAt: time.Now()},
+		purged: make(map[string]bool),
+		gone:   make(map[string]bool),
+	}
+}
+
+// dry 是否为试运行
+func (r *cleanRun) dry() bool {
+	return r != nil && r.dryRun
+}
+
+func (r *cleanRun) add(action RunAction) {
+	if r == nil {
+		return
+	}
+	r.actions = append(r.actions, action)
+	if action.Action != "blocked" {
+		r.gone[action.Path] = true
+	}
+	switch action.Action {
+	case "trash":
+		r.record.Trashed++
+		r.record.TrashedBytes += action.Size
+	case "archive":
+		r.record.Archived++
+		r.record.ArchivedBytes += action.Size
+	case "purge":
+		r.record.Purged++
+		r.record.FreedBytes += action.Size
+		r.purged[action.Path] = true
+	case "orphan":
+		r.record.Orphans++
+	case "blocked":
+		r.record.Blocked++
+	case "prune":
+		r.record.PrunedDirs++
+	case "temp":
+		r.record.TempFiles++
+		r.record.TempBytes += action.Size
+	}
+}
+
+// isGone 文件是否已在本次清理中（将要）移走或删除
+func (r *cleanRun) isGone(path string) bool {
+	return r != nil && r.gone[path]
+}
+
+// isPurged 文件是否已在本次清理中（将要）彻底删除
+func (r *cleanRun) isPurged(path string) bool {
+	return r != nil && r.purged[path]
+}
+
+// RunOnce 立即执行一次清理，dryRun 时只返回将要执行的操作；已有清理在运行时返回 ErrRunning
+func (c *Cleaner) RunOnce(phase, trigger string, dryRun bool) (*RunReport, error) {
+	switch phase {
+	case "":
+		phase = PhaseAll
+	case PhaseSoft, PhaseHard, PhaseTemp, PhaseAll:
+	default:
+		return nil, fmt.Errorf("清理阶段无效: %s（可选 soft/hard/temp/all）", phase)
+	}
+
+	if !c.tryStart() {
+		return nil, ErrRunning
+	}
+	defer c.finish()
+
+	run := newCleanRun(phase, trigger, dryRun)
+	c.runCleaning(run)
+
+	finished := time.Now()
+	run.record.FinishedAt = &finished
+	if !dryRun && c.db != nil {
+		if err := c.db.AddCleanerRun(run.record); err != nil {
+			log.Printf("[Cleaner] 保存清理记录失败: %v", err)
+		}
+		c.pruneHistory()
+	}
+
+	actions := run.actions
+	if actions == nil {
+		actions = []RunAction{}
+	}
+	return &RunReport{DryRun: dryRun, Run: run.record, Actions: actions}, nil
+}
+
+// runCleaning 按阶段执行清理，各步骤的错误记录到 run 后继续
+func (c *Cleaner) runCleaning(run *cleanRun) {
+	prefix := ""
+	if run.dry() {
+		prefix = "（试运行）"
+	}
+	log.Printf("[Cleaner] %s开始执行清理任务（阶段: %s）", prefix, run.record.Phase)
+
+	var errs []string
+	step := func(name string, fn func(*cleanRun) error) {
+		if err := fn(run); err != nil {
+			log.Printf("[Cleaner] %s失败: %v", name, err)
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+
+	// 残留的转码临时文件：每次清理都检查
+	step("清理临时文件", c.sweepTempFiles)
+	if run.record.Phase == PhaseTemp {
+		run.record.Error = strings.Join(errs, "; ")
+		log.Printf("[Cleaner] %s临时文件清理完成: 删除 %d 个（释放 %.2f MB）",
+			prefix, run.record.TempFiles, float64(run.record.TempBytes)/1024/1024)
+		return
+	}
+
+	if run.record.Phase != PhaseHard {
+		// 一级清理：移入垃圾桶
+		step("移入垃圾桶", c.moveToTrash)
+		// 孤立任务：按策略处理输出文件
+		step("处理孤立任务", c.handleOrphans)
+	}
+	if run.record.Phase != PhaseSoft {
+		// 二级清理：清空垃圾桶
+		step("清空垃圾桶", c.emptyTrash)
+		// 容量回收：超出垃圾桶上限或磁盘空间不足时提前删除最早的文件
+		step("垃圾桶容量回收", c.enforceTrashQuota)
+		// 核对输出目录，更新无主输出报告
+		step("核对输出目录", c.reconcileOutputs)
+	}
+	// 删除移走文件后留下的空目录
+	step("删除空目录", c.pruneEmptyDirs)
+	run.record.Error = strings.Join(errs, "; ")
+
+	log.Printf("[Cleaner] %s清理任务完成: 移入垃圾桶 %d 个（%.2f MB），归档 %d 个（%.2f MB），彻底删除 %d 个（释放 %.2f MB），保留 %d 个，孤立输出 %d 个，删除空目录 %d 个，临时文件 %d 个（%.2f MB）",
+		prefix, run.record.Trashed, float64(run.record.TrashedBytes)/1024/1024,
+		run.record.Archived, float64(run.record.ArchivedBytes)/1024/1024, run.record.Purged, float64(run.record.FreedBytes)/1024/1024, run.record.Blocked, run.record.Orphans, run.record.PrunedDirs,
+		run.record.TempFiles, float64(run.record.TempBytes)/1024/1024)
+}
+
+// pruneHistory 删除超过保留天数的清理记录
+func (c *Cleaner) pruneHistory() {
+	if c.config.Cleaning.HistoryDays <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -c.config.Cleaning.HistoryDays)
+	if n, err := c.db.DeleteCleanerRunsBefore(cutoff); err != nil {
+		log.Printf("[Cleaner] 清理历史记录失败: %v", err)
+	} else if n > 0 {
+		log.Printf("[Cleaner] 已删除 %d 条过期清理记录", n)
+	}
+}
+
+// tryStart 标记清理开始，已有清理（或核对、批量处理无主输出）在运行时返回 false
+func (c *Cleaner) tryStart() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return false
+	}
+	c.running = true
+	return true
+}
+
+func (c *Cleaner) finish() {
+	c.mu.Lock()
+	c.running = false
+	c.mu.Unlock()
+}
+
+// Running 是否有清理任务在运行
+func (c *Cleaner) Running() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// planTrash 试运行时记录将要移入垃圾桶的文件
+func (c *Cleaner) planTrash(run *cleanRun, srcPath string, taskID int64, reason string) {
+	size := fileSize(srcPath)
+	run.add(RunAction{Action: "trash", Path: srcPath, TaskID: taskID, Size: size, Reason: reason})
+	c.planPending(run, srcPath, size)
+}
+
+// planPending 试运行中将要移入垃圾桶的文件也参与容量回收，与实际执行时的结果一致
+func (c *Cleaner) planPending(run *cleanRun, srcPath string, size int64) {
+	trashPath, _ := c.trashTarget(srcPath)
+	for _, root := range c.trashRoots() {
+		if rel, err := filepath.Rel(root.Dir, trashPath); err == nil && !strings.HasPrefix(rel, "..") {
+			run.pending = append(run.pending, &trashEntry{root: root, path: trashPath, size: size, deleteTime: time.Now()})
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cleaner
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+)
+
+// sidecars 返回源文件的伴随文件，未开启 sidecar 时为空
+func (c *Cleaner) sidecars(srcPath string) []string {
+	if !c.config.Sidecar.Enabled {
+		return nil
+	}
+	files, err := fileutil.Sidecars(srcPath, c.config.Sidecar.Patterns)
+	if err != nil {
+		log.Printf("[Cleaner] 查找伴随文件失败 %s: %v", srcPath, err)
+	}
+	return files
+}
+
+// trashSidecars 将伴随文件随源文件移入垃圾桶，恢复源文件时一并恢复
+func (c *Cleaner) trashSidecars(run *cleanRun, task *database.Task, srcPath string) {
+	for _, sidecar := range c.sidecars(srcPath) {
+		if run.dry() {
+			c.planTrash(run, sidecar, task.ID, database.TrashReasonSidecar)
+			continue
+		}
+		size := fileSize(sidecar)
+		if err := c.trashFile(sidecar, task.ID, database.TrashReasonSidecar); err != nil {
+			log.Printf("[Cleaner] 移动伴随文件失败 %s: %v", sidecar, err)
+			continue
+		}
+		run.add(RunAction{Action: "trash", Path: sidecar, TaskID: task.ID, Size: size, Reason: database.TrashReasonSidecar})
+	}
+}
+
+// archiveSidecars 将伴随文件随源文件移入归档目录（与源文件同一相对目录）
+func (c *Cleaner) archiveSidecars(run *cleanRun, task *database.Task, srcPath string, pair config.InputOutputPair, rel string) {
+	for _, sidecar := range c.sidecars(srcPath) {
+		sidecarRel := filepath.Join(filepath.Dir(rel), filepath.Base(sidecar))
+		size := fileSize(sidecar)
+		if run.dry() {
+			run.add(RunAction{Action: "archive", Path: sidecar, TaskID: task.ID, Size: size, Reason: filepath.Join(pair.ArchiveDir, sidecarRel)})
+			continue
+		}
+		dest, err := c.archiveSource(task, sidecar, pair, sidecarRel)
+		if err != nil {
+			log.Printf("[Cleaner] 归档伴随文件失败 %s: %v", sidecar, err)
+			continue
+		}
+		run.add(RunAction{Action: "archive", Path: sidecar, TaskID: task.ID, Size: size, Reason: dest})
+	}
+}
+
+// restoreSidecars 源文件从垃圾桶恢复后，恢复同一任务随之移入的伴随文件
+func (c *Cleaner) restoreSidecars(item *database.TrashItem) {
+	if item.TaskID == 0 || item.Reason != database.TrashReasonCleanup {
+		return
+	}
+	sidecars, err := c.db.GetTrashedItemsByTask(item.TaskID, database.TrashReasonSidecar)
+	if err != nil {
+		log.Printf("[Cleaner] 查询伴随文件失败 %s: %v", item.OriginalPath, err)
+		return
+	}
+	for _, sidecar := range sidecars {
+		if _, err := c.RestoreTrashItem(sidecar.ID, false); err != nil {
+			log.Printf("[Cleaner] 恢复伴随文件失败 %s: %v", sidecar.TrashPath, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cleaner
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/metrics"
+)
+
+// tempMarker 转码中间文件名中的标记（file.stm_tmp.mp4、file.stm_tmp.salvage.mkv 及其 .segments 目录）
+const tempMarker = ".stm_tmp"
+
+// sweepTempFiles 删除输出目录中残留的转码中间文件（进程在转码中被终止时不会清理）
+// 正在转码的任务的中间文件及修改时间未超过 temp_grace_hours 的文件保留
+func (c *Cleaner) sweepTempFiles(run *cleanRun) error {
+	owned, err := c.activeTempPrefixes()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-time.Duration(c.config.Cleaning.TempGraceHours) * time.Hour)
+
+	var firstErr error
+	swept := 0
+	for _, root := range c.outputRoots() {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !strings.Contains(d.Name(), tempMarker) {
+				return nil
+			}
+			if isOwnedTemp(path, owned) || latestModTime(path).After(cutoff) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			size := treeSize(path)
+			if !run.dry() {
+				if err := os.RemoveAll(path); err != nil {
+					log.Printf("[Cleaner] 删除残留临时文件失败 %s: %v", path, err)
+					return nil
+				}
+				swept++
+				metrics.TempFilesSwept.Inc()
+				metrics.TempBytesReclaimed.Add(float64(size))
+				log.Printf("[Cleaner] 已删除残留临时文件: %s（%.2f MB）", path, float64(size)/1024/1024)
+			}
+			run.add(RunAction{Action: "temp", Path: path, Size: size})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if swept > 0 {
+		log.Printf("[Cleaner] 共删除 %d 个残留临时文件", swept)
+	}
+	return firstErr
+}
+
+// outputRoots 需要检查临时文件的输出目录
+func (c *Cleaner) outputRoots() []string {
+	var roots []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if dir != "" && !seen[filepath.Clean(dir)] {
+			seen[filepath.Clean(dir)] = true
+			roots = append(roots, filepath.Clean(dir))
+		}
+	}
+	for _, pair := range c.config.Path.Pairs {
+		add(pair.Output)
+	}
+	add(c.config.Path.Output)
+	return roots
+}
+
+// activeTempPrefixes 正在转码的任务的中间文件路径前缀（<输出路径去扩展名>.stm_tmp）
+func (c *Cleaner) activeTempPrefixes() ([]string, error) {
+	if c.db == nil {
+		return nil, nil
+	}
+	var prefixes []string
+	for offset := 0; ; {
+		tasks, err := c.db.GetAllTasks(string(database.StatusProcessing), 200, offset)
+		if err != nil {
+			return nil, fmt.Errorf("查询转码中任务失败: %w", err)
+		}
+		if len(tasks) == 0 {
+			break
+		}
+		for _, task := range tasks {
+			basePath, ok := c.config.ResolveOutputBase(task.SourcePath, task.OutputPath)
+			if !ok {
+				continue
+			}
+			outputPath := c.config.ApplyOutputExtension(basePath)
+			prefixes = append(prefixes, strings.TrimSuffix(outputPath, filepath.Ext(outputPath))+tempMarker)
+		}
+		offset += len(tasks)
+	}
+	return prefixes, nil
+}
+
+// isOwnedTemp 中间文件是否属于正在转码的任务
+func isOwnedTemp(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestModTime 文件或目录下所有文件中最近的修改时间
+func latestModTime(path string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
@@ -0,0 +1,261 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+)
+
+// ErrTrashItemNotFound 垃圾桶记录不存在或文件已恢复/删除
+var ErrTrashItemNotFound = errors.New("垃圾桶记录不存在或已处理")
+
+// trashRoot 一个垃圾桶目录及其对应的配对
+type trashRoot struct {
+	Pair string // 配对输入目录（用于展示来源）
+	Base string // 垃圾桶所在的配对输入或输出目录
+	Dir  string // 垃圾桶目录
+}
+
+// trashRoots 返回所有配对输入、输出目录下的垃圾桶（同一目录只出现一次）
+// 旧版单目录配置 path.input 的垃圾桶也包含在内
+func (c *Cleaner) trashRoots() []trashRoot {
+	var roots []trashRoot
+	seen := make(map[string]bool)
+	add := func(pair, base string) {
+		if base == "" {
+			return
+		}
+		dir := c.config.TrashDir(base)
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		roots = append(roots, trashRoot{Pair: pair, Base: base, Dir: dir})
+	}
+
+	for _, pair := range c.config.Path.Pairs {
+		add(pair.Input, pair.Input)
+		add(pair.Input, pair.Output)
+	}
+	add(c.config.Path.Input, c.config.Path.Input)
+	return roots
+}
+
+// trashTarget 计算文件移入垃圾桶后的路径，同时返回来源配对
+// 位于配对输入/输出目录下的文件进入该目录的垃圾桶并保留相对路径，其他文件放入同级垃圾桶；
+// 上次跨分区复制中断留下 .stm_part 时沿用其路径，以便续传
+func (c *Cleaner) trashTarget(srcPath string) (string, string) {
+	dir, pair := c.config.TrashDir(filepath.Dir(srcPath)), ""
+	for _, root := range c.trashRoots() {
+		if rel, err := filepath.Rel(root.Base, srcPath); err == nil && !strings.HasPrefix(rel, "..") {
+			dir, pair = filepath.Join(root.Dir, filepath.Dir(rel)), root.Pair
+			break
+		}
+	}
+
+	prefix := filepath.Base(srcPath) + "_del_"
+	if target, ok := findPartialTarget(dir, prefix); ok {
+		return target, pair
+	}
+	return filepath.Join(dir, prefix+time.Now().Format("20060102_150405")), pair
+}
+
+// findPartialTarget 查找目录中同一文件未完成的跨分区复制，返回其目标路径（多个时取最近的）
+func findPartialTarget(dir, prefix string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	var latest string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, fileutil.PartialSuffix) {
+			continue
+		}
+		target := strings.TrimSuffix(name, fileutil.PartialSuffix)
+		if _, err := time.Parse("20060102_150405", strings.TrimPrefix(target, prefix)); err != nil {
+			continue // 其他文件名以该文件名开头的文件
+		}
+		if target > latest {
+			latest = target
+		}
+	}
+	if latest == "" {
+		return "", false
+	}
+	return filepath.Join(dir, latest), true
+}
+
+// walkTrash 遍历所有垃圾桶中的文件（不含未完成的跨分区复制）
+func (c *Cleaner) walkTrash(fn func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time)) error {
+	return c.walkTrashFiles(false, fn)
+}
+
+// walkTrashPartials 遍历垃圾桶中未完成的跨分区复制（<目标>.stm_part），deleteTime 为最后修改时间
+func (c *Cleaner) walkTrashPartials(fn func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time)) error {
+	return c.walkTrashFiles(true, fn)
+}
+
+func (c *Cleaner) walkTrashFiles(partials bool, fn func(root trashRoot, path string, info fs.FileInfo, deleteTime time.Time)) error {
+	var firstErr error
+	for _, root := range c.trashRoots() {
+		if _, err := os.Stat(root.Dir); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(root.Dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(path, fileutil.PartialSuffix) != partials {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if partials {
+				fn(root, path, info, info.ModTime())
+			} else {
+				fn(root, path, info, trashDeleteTime(info))
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("[Cleaner] 遍历垃圾桶失败 %s: %v", root.Dir, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// trashDeleteTime 解析文件名中的删除时间 "video.mp4_del_20260105_120000"，无法解析时使用修改时间
+func trashDeleteTime(info fs.FileInfo) time.Time {
+	parts := strings.Split(info.Name(), "_del_")
+	if len(parts) >= 2 {
+		if t, err := time.ParseInLocation("20060102_150405", parts[len(parts)-1], time.Local); err == nil {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// findTrashFile 定位垃圾桶中的文件：绝对路径须位于某个垃圾桶内，文件名则在各垃圾桶根目录中查找
+func (c *Cleaner) findTrashFile(name string) (string, bool) {
+	for _, root := range c.trashRoots() {
+		path := name
+		if !filepath.IsAbs(name) {
+			path = filepath.Join(root.Dir, name)
+		}
+		path = filepath.Clean(path)
+		if rel, err := filepath.Rel(root.Dir, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// RestoreTrashItem 将垃圾桶中的文件移回原位置，返回恢复后的路径
+// 原位置已有文件时恢复为 <原文件名>.restored_<时间>.<扩展名>；
+// resetTask 为 true 且恢复的是任务源文件时重新加入转码队列，否则保持任务状态
+func (c *Cleaner) RestoreTrashItem(id int64, resetTask bool) (string, error) {
+	item, err := c.db.GetTrashItem(id)
+	if err != nil {
+		return "", err
+	}
+	if item == nil || item.Status != database.TrashTrashed {
+		return "", ErrTrashItemNotFound
+	}
+	if _, err := os.Stat(item.TrashPath); os.IsNotExist(err) {
+		c.resolveTrashPath(item.TrashPath, database.TrashPurged, "文件已在外部删除")
+		return "", fmt.Errorf("%w: 文件已不在垃圾桶中", ErrTrashItemNotFound)
+	}
+
+	dest := item.OriginalPath
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = strings.TrimSuffix(dest, ext) + ".restored_" + time.Now().Format("20060102_150405") + ext
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %w", err)
+	}
+	if _, err := c.moveFile(item.TrashPath, dest); err != nil {
+		return "", fmt.Errorf("恢复文件失败: %w", err)
+	}
+	if err := c.db.ResolveTrashItem(item.ID, database.TrashRestored); err != nil {
+		log.Printf("[Cleaner] 更新垃圾桶清单失败 %s: %v", item.TrashPath, err)
+	}
+	log.Printf("[Cleaner] 已从垃圾桶恢复: %s", dest)
+
+	if item.TaskID > 0 {
+		c.restoreTask(item, dest, resetTask)
+	}
+	c.restoreSidecars(item)
+	return dest, nil
+}
+
+// restoreTask 源文件恢复到原路径后更新任务：清除移除标记，需要时重新入队
+func (c *Cleaner) restoreTask(item *database.TrashItem, dest string, resetTask bool) {
+	task, err := c.db.GetTaskByID(item.TaskID)
+	if err != nil || task == nil {
+		return
+	}
+	// 输出文件或改名恢复的源文件与任务记录的路径不同，不影响任务
+	if item.Reason != database.TrashReasonCleanup || dest != task.SourcePath {
+		return
+	}
+
+	if err := c.db.ClearSourceRemoved(task.ID); err != nil {
+		log.Printf("[Cleaner] 清除源文件移除标记失败 %s: %v", task.SourcePath, err)
+	}
+	if !resetTask {
+		return
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return
+	}
+	if err := c.db.ResetTaskToPending(task.SourcePath, info.ModTime(), info.Size()); err != nil {
+		log.Printf("[Cleaner] 重置任务失败 %s: %v", task.SourcePath, err)
+		return
+	}
+	log.Printf("[Cleaner] 恢复的源文件已重新加入队列: %s", task.SourcePath)
+}
+
+// partialCutoff 修改时间早于该时间的未完成复制不再续传
+func (c *Cleaner) partialCutoff() time.Time {
+	return time.Now().Add(-time.Duration(c.config.Cleaning.PartialGraceHours) * time.Hour)
+}
+
+// heldTrashPaths 返回不允许自动彻底删除的垃圾桶文件，查询失败时为空（不阻止清理）
+func (c *Cleaner) heldTrashPaths() map[string]bool {
+	if c.db == nil {
+		return nil
+	}
+	held, err := c.db.GetHeldTrashPaths()
+	if err != nil {
+		log.Printf("[Cleaner] 查询保留的垃圾桶文件失败: %v", err)
+		return nil
+	}
+	return held
+}
+
+// resolveTrashPath 文件离开垃圾桶后更新清单
+func (c *Cleaner) resolveTrashPath(trashPath string, status database.TrashStatus, reason string) {
+	if c.db == nil {
+		return
+	}
+	if err := c.db.ResolveTrashPath(trashPath, status, reason); err != nil {
+		log.Printf("[Cleaner] 更新垃圾桶清单失败 %s: %v", trashPath, err)
+	}
+}
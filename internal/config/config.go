@@ -3,19 +3,28 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/robfig/cron/v3"
+	"github.com/stm/video-transcoder/internal/media"
 	"gopkg.in/yaml.v3"
 )
 
 // Config 全局配置结构
 type Config struct {
-	System   SystemConfig   `yaml:"system"`
-	Path     PathConfig     `yaml:"path"`
-	FFmpeg   FFmpegConfig   `yaml:"ffmpeg"`
-	Cleaning CleaningConfig `yaml:"cleaning"`
-	Log      LogConfig      `yaml:"log"`
+	System     SystemConfig             `yaml:"system"`
+	Path       PathConfig               `yaml:"path"`
+	FFmpeg     FFmpegConfig             `yaml:"ffmpeg"`
+	Profiles   map[string]ProfileConfig `yaml:"profiles"`
+	Scanner    ScannerConfig            `yaml:"scanner"`
+	Filter     FilterRules              `yaml:"filter"`
+	Cleaning   CleaningConfig           `yaml:"cleaning"`
+	Verify     VerifyConfig             `yaml:"verify"`
+	Quarantine QuarantineConfig         `yaml:"quarantine"`
+	Sidecar    SidecarConfig            `yaml:"sidecar"`
+	Log        LogConfig                `yaml:"log"`
 }
 
 // SystemConfig 系统配置
@@ -41,8 +50,54 @@ type PathConfig struct {
 
 // InputOutputPair 输入输出目录配对
 type InputOutputPair struct {
-	Input  string `yaml:"input" json:"input"`
-	Output string `yaml:"output" json:"output"`
+	Input  string      `yaml:"input" json:"input"`
+	Output string      `yaml:"output" json:"output"`
+	Filter FilterRules `yaml:"filter" json:"filter"` // 该配对的过滤规则（与全局规则叠加）
+
+	TrashMaxGB float64 `yaml:"trash_max_gb" json:"trash_max_gb,omitempty"` // 该配对垃圾桶的容量上限（GB），0为不限制
+
+	SourcePolicy string `yaml:"source_policy" json:"source_policy,omitempty"` // 保留期后源文件的去向: trash（默认）/archive
+	ArchiveDir   string `yaml:"archive_dir" json:"archive_dir,omitempty"`     // archive 策略的归档目录（绝对路径，保留相对路径）
+}
+
+// 保留期后源文件的处理策略
+const (
+	SourcePolicyTrash   = "trash"   // 移入垃圾桶，hard_delete_days 后彻底删除
+	SourcePolicyArchive = "archive" // 移入归档目录长期保存
+)
+
+// FilterRules 文件过滤规则
+// 模式相对于配对的输入目录，支持 ** 匹配多级目录
+type FilterRules struct {
+	Include            []string `yaml:"include" json:"include,omitempty"`                           // 非空时仅处理匹配的文件
+	Exclude            []string `yaml:"exclude" json:"exclude,omitempty"`                           // 匹配的文件/目录将被跳过
+	MinSizeMB          int64    `yaml:"min_size_mb" json:"min_size_mb,omitempty"`                   // 最小文件大小（MB），0为不限制
+	MinDurationSeconds int      `yaml:"min_duration_seconds" json:"min_duration_seconds,omitempty"` // 最短时长（秒），0为不限制
+	MaxDurationSeconds int      `yaml:"max_duration_seconds" json:"max_duration_seconds,omitempty"` // 最长时长（秒），0为不限制
+}
+
+// validate 验证过滤规则
+func (r FilterRules) validate(scope string) error {
+	for _, pattern := range append(append([]string{}, r.Include...), r.Exclude...) {
+		for _, segment := range strings.Split(pattern, "/") {
+			if segment == "**" {
+				continue
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("%s的过滤规则无效: %s", scope, pattern)
+			}
+		}
+	}
+	if r.MinSizeMB < 0 {
+		return fmt.Errorf("%s的 min_size_mb 不能为负数", scope)
+	}
+	if r.MinDurationSeconds < 0 || r.MaxDurationSeconds < 0 {
+		return fmt.Errorf("%s的时长限制不能为负数", scope)
+	}
+	if r.MaxDurationSeconds > 0 && r.MaxDurationSeconds < r.MinDurationSeconds {
+		return fmt.Errorf("%s的 max_duration_seconds 必须大于等于 min_duration_seconds", scope)
+	}
+	return nil
 }
 
 // FFmpegConfig FFmpeg配置
@@ -68,12 +123,240 @@ type FFmpegConfig struct {
 	MaxDurationHours      int      `yaml:"max_duration_hours"`
 	DurationFactor        float64  `yaml:"duration_factor"`
 	DurationExtraMinutes  int      `yaml:"duration_extra_minutes"`
+
+	AudioTracks              string  `yaml:"audio_tracks"`               // 输出音轨: first/all/none
+	Subtitles                string  `yaml:"subtitles"`                  // 输出字幕: none/all，留空沿用 ffmpeg 默认（不检查）
+	DurationToleranceSeconds float64 `yaml:"duration_tolerance_seconds"` // 输出与源文件时长允许的误差（秒）
+	DurationTolerancePercent float64 `yaml:"duration_tolerance_percent"` // 输出与源文件时长允许的误差（百分比，取两者较大值）
+
+	Salvage               bool `yaml:"salvage"`                 // 源文件检查失败时依次尝试重新封装、重建时间戳、分段抢救
+	SalvageSegmentSeconds int  `yaml:"salvage_segment_seconds"` // 分段抢救的分段长度（秒）
+}
+
+// 音轨与字幕处理方式
+const (
+	AudioTracksFirst = "first" // 只保留一条音轨（ffmpeg 默认选择）
+	AudioTracksAll   = "all"   // 保留全部音轨
+	AudioTracksNone  = "none"  // 去除音频
+	SubtitlesNone    = "none"  // 去除字幕
+	SubtitlesAll     = "all"   // 保留全部字幕
+)
+
+// DurationTolerance 计算给定时长允许的误差（秒）
+func (f FFmpegConfig) DurationTolerance(duration float64) float64 {
+	tolerance := f.DurationToleranceSeconds
+	if relative := duration * f.DurationTolerancePercent / 100; relative > tolerance {
+		tolerance = relative
+	}
+	return tolerance
+}
+
+// ProfileConfig 转码配置（覆盖 ffmpeg 段中的对应参数，留空则沿用默认值）
+// 可在目录的 .stm.yaml 中通过 profile 字段选用
+type ProfileConfig struct {
+	Codec        string `yaml:"codec" json:"codec,omitempty"`
+	Preset       string `yaml:"preset" json:"preset,omitempty"`
+	CRF          int    `yaml:"crf" json:"crf,omitempty"`
+	Audio        string `yaml:"audio" json:"audio,omitempty"`
+	AudioBitrate string `yaml:"audio_bitrate" json:"audio_bitrate,omitempty"`
+	AudioTracks  string `yaml:"audio_tracks" json:"audio_tracks,omitempty"`
+	Subtitles    string `yaml:"subtitles" json:"subtitles,omitempty"`
+}
+
+// EncodeSettings 生效的编码参数
+type EncodeSettings struct {
+	Codec        string
+	Preset       string
+	CRF          int
+	Audio        string
+	AudioBitrate string
+	AudioTracks  string
+	Subtitles    string
+}
+
+// ExpectedAudio 按音轨设置计算输出应包含的音轨数
+func (e EncodeSettings) ExpectedAudio(source int) int {
+	switch e.AudioTracks {
+	case AudioTracksNone:
+		return 0
+	case AudioTracksAll:
+		return source
+	}
+	if source > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ExpectedSubtitles 按字幕设置计算输出应包含的字幕数，未显式设置时返回 false（不检查）
+func (e EncodeSettings) ExpectedSubtitles(source int) (int, bool) {
+	switch e.Subtitles {
+	case SubtitlesNone:
+		return 0, true
+	case SubtitlesAll:
+		return source, true
+	}
+	return 0, false
+}
+
+// Expectation 根据源文件信息和转码参数计算输出应满足的时长与流数量（转码后、定期校验与收养共用）
+func (c *Config) Expectation(encode EncodeSettings, source *media.Info) media.Expectation {
+	exp := media.Expectation{
+		Duration:  source.Duration,
+		Tolerance: c.FFmpeg.DurationTolerance(source.Duration),
+		Video:     min(source.Video, 1),
+		Audio:     encode.ExpectedAudio(source.Audio),
+	}
+	exp.Subtitle, exp.CheckSubtitle = encode.ExpectedSubtitles(source.Subtitle)
+	return exp
+}
+
+// ResolveProfile 合并默认 ffmpeg 参数与指定转码配置（未知配置名时返回 false 并使用默认值）
+func (c *Config) ResolveProfile(name string) (EncodeSettings, bool) {
+	settings := EncodeSettings{
+		Codec:        c.FFmpeg.Codec,
+		Preset:       c.FFmpeg.Preset,
+		CRF:          c.FFmpeg.CRF,
+		Audio:        c.FFmpeg.Audio,
+		AudioBitrate: c.FFmpeg.AudioBitrate,
+		AudioTracks:  c.FFmpeg.AudioTracks,
+		Subtitles:    c.FFmpeg.Subtitles,
+	}
+	if name == "" {
+		return settings, true
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return settings, false
+	}
+	if profile.Codec != "" {
+		settings.Codec = profile.Codec
+	}
+	if profile.Preset != "" {
+		settings.Preset = profile.Preset
+	}
+	if profile.CRF > 0 {
+		settings.CRF = profile.CRF
+	}
+	if profile.Audio != "" {
+		settings.Audio = profile.Audio
+	}
+	if profile.AudioBitrate != "" {
+		settings.AudioBitrate = profile.AudioBitrate
+	}
+	if profile.AudioTracks != "" {
+		settings.AudioTracks = profile.AudioTracks
+	}
+	if profile.Subtitles != "" {
+		settings.Subtitles = profile.Subtitles
+	}
+	return settings, true
+}
+
+// ScannerConfig 扫描器配置
+type ScannerConfig struct {
+	StableSeconds    int  `yaml:"stable_seconds"`     // 文件大小/mtime保持不变的静默期（秒），0为不检查
+	StableScans      int  `yaml:"stable_scans"`       // 文件保持不变的连续扫描次数，0为不检查
+	CheckOpenWriters bool `yaml:"check_open_writers"` // 通过 /proc 检查是否仍有进程以写模式打开文件
+	WalkWorkers      int  `yaml:"walk_workers"`       // 并行遍历目录的协程数
+	BatchSize        int  `yaml:"batch_size"`         // 每个事务批量写入的记录数
+	Incremental      bool `yaml:"incremental"`        // 增量扫描：只读取 mtime 变化的目录
+	DeepScanHours    int  `yaml:"deep_scan_hours"`    // 完整扫描间隔（小时），增量模式下生效
+	AdoptExisting    bool `yaml:"adopt_existing"`     // 收养模式：新文件的输出已存在且通过校验时直接记为已完成，不重新转码
+}
+
+// StabilityEnabled 是否启用文件稳定性检测
+func (s ScannerConfig) StabilityEnabled() bool {
+	return s.StableSeconds > 0 || s.StableScans > 0 || s.CheckOpenWriters
 }
 
 // CleaningConfig 清理配置
 type CleaningConfig struct {
-	SoftDeleteDays int `yaml:"soft_delete_days"` // 移入垃圾桶天数
-	HardDeleteDays int `yaml:"hard_delete_days"` // 彻底删除天数
+	SoftDeleteDays   int    `yaml:"soft_delete_days"`   // 移入垃圾桶天数
+	HardDeleteDays   int    `yaml:"hard_delete_days"`   // 彻底删除天数
+	OrphanGraceHours int    `yaml:"orphan_grace_hours"` // 源文件缺失多久后标记为孤立（小时），0 为立即标记
+	OrphanPolicy     string `yaml:"orphan_policy"`      // 孤立任务输出的处理策略: keep/delete/trash
+
+	TrashMaxGB     float64 `yaml:"trash_max_gb"`      // 所有垃圾桶合计的容量上限（GB），0为不限制
+	TrashMinFreeGB float64 `yaml:"trash_min_free_gb"` // 垃圾桶所在磁盘的最低剩余空间（GB），低于时提前删除，0为不检查
+
+	VerifyBeforeTrash string `yaml:"verify_before_trash"` // 源文件移入垃圾桶前对输出的检查: none/exists/probe/duration
+
+	SoftDeleteCron string `yaml:"soft_delete_cron"` // 移入垃圾桶（含孤立任务输出处理）的执行时间（cron 表达式）
+	HardDeleteCron string `yaml:"hard_delete_cron"` // 清空过期垃圾及容量回收的执行时间（cron 表达式）
+	RunOnStartup   bool   `yaml:"run_on_startup"`   // 启动时立即执行一次完整清理
+	HistoryDays    int    `yaml:"history_days"`     // 清理记录保留天数
+
+	MoveBandwidthMB float64 `yaml:"move_bandwidth_mb"` // 跨分区移动（垃圾桶、归档、恢复）的限速（MB/s），0为不限制
+
+	PruneEmptyDirs   bool     `yaml:"prune_empty_dirs"`    // 清理后删除输入目录下的空目录（含垃圾桶中的空目录）
+	PruneMinAgeHours int      `yaml:"prune_min_age_hours"` // 目录修改时间超过该时长才删除（小时），避免删除刚创建的目录
+	PruneIgnore      []string `yaml:"prune_ignore"`        // 视为空目录时可忽略并一起删除的文件/目录名模式
+	PruneKeepDirs    []string `yaml:"prune_keep_dirs"`     // 永不删除的目录（绝对路径），配对的输入、输出、归档目录总是保留
+
+	TempGraceHours    int `yaml:"temp_grace_hours"`    // 输出目录中残留的转码临时文件（.stm_tmp）超过该时长未修改且不属于转码中的任务时删除（小时）
+	PartialGraceHours int `yaml:"partial_grace_hours"` // 垃圾桶中未完成的跨分区复制（.stm_part）超过该时长未修改时删除（小时），期间再次移动同一文件会续传
+
+	ReconcileOutputs bool `yaml:"reconcile_outputs"` // 彻底删除阶段核对输出目录，列出没有对应任务的输出文件
+}
+
+// DefaultOrphanGraceHours 未配置 orphan_grace_hours 时的宽限期，避免存储临时掉线误判
+const DefaultOrphanGraceHours = 24
+
+// DefaultPruneIgnore 未配置 prune_ignore 时可忽略的文件（系统生成的缩略图、索引等）
+var DefaultPruneIgnore = []string{".DS_Store", "._*", "Thumbs.db", "desktop.ini", "@eaDir", ".@__thumb"}
+
+// 孤立任务输出处理策略
+const (
+	OrphanPolicyKeep   = "keep"   // 保留输出，仅标记供人工审核
+	OrphanPolicyDelete = "delete" // 直接删除输出
+	OrphanPolicyTrash  = "trash"  // 输出移入垃圾桶
+)
+
+// 源文件移入垃圾桶前的输出检查级别（逐级包含）
+const (
+	VerifyBeforeTrashNone     = "none"     // 不检查
+	VerifyBeforeTrashExists   = "exists"   // 输出存在且大小与转码完成时一致
+	VerifyBeforeTrashProbe    = "probe"    // 另外用 ffprobe 检查输出可读
+	VerifyBeforeTrashDuration = "duration" // 另外检查输出时长与源文件一致
+)
+
+// VerifyConfig 已完成输出的定期校验配置（ffmpeg.strict_check 开启时生效）
+type VerifyConfig struct {
+	IntervalMinutes int    `yaml:"interval_minutes"` // 校验任务运行间隔（分钟）
+	ReverifyDays    int    `yaml:"reverify_days"`    // 同一输出两次校验的最短间隔（天）
+	Workers         int    `yaml:"workers"`          // 并行校验数
+	BatchSize       int    `yaml:"batch_size"`       // 每次从数据库读取的任务数
+	QuarantineDir   string `yaml:"quarantine_dir"`   // 损坏输出的隔离目录名（位于配对输出目录下）
+	HistoryDays     int    `yaml:"history_days"`     // 校验记录保留天数
+
+	FullDecodeWhenIdle bool `yaml:"full_decode_when_idle"` // 没有转码任务时完整解码输出（耗时较长）
+}
+
+// QuarantineConfig 反复检查失败的源文件隔离配置
+type QuarantineConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // 启用后源文件累计检查失败达到次数时移入隔离区
+	AfterFailures int    `yaml:"after_failures"` // 隔离前允许的检查失败次数（含手动重试）
+	Dir           string `yaml:"dir"`            // 隔离目录名（位于配对输入目录下，扫描时跳过）
+}
+
+// SidecarConfig 伴随文件（字幕、nfo、海报等）配置
+// 开启后伴随文件复制到输出旁边（字幕可转换格式），并与源文件一起移入垃圾桶或归档目录
+type SidecarConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Patterns       []string `yaml:"patterns"`        // 源文件所在目录中的文件名模式，{name} 为源文件名（不含扩展名）
+	SubtitleFormat string   `yaml:"subtitle_format"` // 字幕转换格式: srt/ass/vtt，为空时原样复制
+}
+
+// DefaultSidecarPatterns 未配置 sidecar.patterns 时使用的模式
+var DefaultSidecarPatterns = []string{
+	"{name}.srt", "{name}.*.srt",
+	"{name}.ass", "{name}.*.ass",
+	"{name}.ssa", "{name}.*.ssa",
+	"{name}.vtt", "{name}.*.vtt",
+	"{name}.nfo",
+	"{name}-poster.jpg", "{name}-fanart.jpg", "{name}-thumb.jpg",
 }
 
 // LogConfig 日志配置
@@ -95,8 +378,8 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("读取配置文件失败: %w", err)
 	}
 
-	// 解析YAML
-	var cfg Config
+	// 解析YAML（0 有意义的配置项在解析前设置默认值，仅在未配置时生效）
+	cfg := Config{Cleaning: CleaningConfig{OrphanGraceHours: DefaultOrphanGraceHours}}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
@@ -161,6 +444,10 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.Path.Trash == "" {
+		c.Path.Trash = ".stm_trash"
+	}
+
 	// 验证转换后的Pairs
 	for i, pair := range c.Path.Pairs {
 		if pair.Input == "" {
@@ -169,9 +456,36 @@ func (c *Config) Validate() error {
 		if pair.Output == "" {
 			return fmt.Errorf("第%d个配对的输出路径不能为空", i+1)
 		}
+		if pair.TrashMaxGB < 0 {
+			return fmt.Errorf("第%d个配对的 trash_max_gb 不能为负数", i+1)
+		}
+		switch pair.SourcePolicy {
+		case "", SourcePolicyTrash:
+		case SourcePolicyArchive:
+			if !filepath.IsAbs(pair.ArchiveDir) {
+				return fmt.Errorf("第%d个配对的 archive_dir 必须为绝对路径: %q", i+1, pair.ArchiveDir)
+			}
+			// 归档目录位于输入目录下会被重新扫描入队
+			if rel, err := filepath.Rel(pair.Input, pair.ArchiveDir); err == nil && !strings.HasPrefix(rel, "..") {
+				return fmt.Errorf("第%d个配对的 archive_dir 不能位于输入目录下: %s", i+1, pair.ArchiveDir)
+			}
+		default:
+			return fmt.Errorf("第%d个配对的 source_policy 无效: %s（可选 trash/archive）", i+1, pair.SourcePolicy)
+		}
 		if pair.Input == pair.Output {
 			return fmt.Errorf("第%d个配对的输入和输出目录不能相同: %s", i+1, pair.Input)
 		}
+		if err := pair.Filter.validate(fmt.Sprintf("第%d个配对", i+1)); err != nil {
+			return err
+		}
+	}
+
+	// 验证过滤规则（exclude_patterns 与 filter.exclude 合并生效）
+	if err := c.Filter.validate("全局"); err != nil {
+		return err
+	}
+	if err := (FilterRules{Exclude: c.FFmpeg.ExcludePatterns}).validate("exclude_patterns"); err != nil {
+		return err
 	}
 
 	// 验证清理天数
@@ -182,12 +496,191 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("hard_delete_days 必须大于等于 soft_delete_days")
 	}
 
+	if c.Cleaning.TrashMaxGB < 0 || c.Cleaning.TrashMinFreeGB < 0 {
+		return fmt.Errorf("trash_max_gb/trash_min_free_gb 不能为负数")
+	}
+
+	// 孤立任务处理
+	if c.Cleaning.OrphanGraceHours < 0 {
+		return fmt.Errorf("orphan_grace_hours 不能为负数")
+	}
+	switch c.Cleaning.OrphanPolicy {
+	case "":
+		c.Cleaning.OrphanPolicy = OrphanPolicyKeep
+	case OrphanPolicyKeep, OrphanPolicyDelete, OrphanPolicyTrash:
+	default:
+		return fmt.Errorf("orphan_policy 无效: %s（可选 keep/delete/trash）", c.Cleaning.OrphanPolicy)
+	}
+	switch c.Cleaning.VerifyBeforeTrash {
+	case "":
+		c.Cleaning.VerifyBeforeTrash = VerifyBeforeTrashProbe
+	case VerifyBeforeTrashNone, VerifyBeforeTrashExists, VerifyBeforeTrashProbe, VerifyBeforeTrashDuration:
+	default:
+		return fmt.Errorf("verify_before_trash 无效: %s（可选 none/exists/probe/duration）", c.Cleaning.VerifyBeforeTrash)
+	}
+	if c.Cleaning.SoftDeleteCron == "" {
+		c.Cleaning.SoftDeleteCron = "0 10 * * *"
+	}
+	if c.Cleaning.HardDeleteCron == "" {
+		c.Cleaning.HardDeleteCron = c.Cleaning.SoftDeleteCron
+	}
+	if _, err := cron.ParseStandard(c.Cleaning.SoftDeleteCron); err != nil {
+		return fmt.Errorf("soft_delete_cron 无效: %w", err)
+	}
+	if _, err := cron.ParseStandard(c.Cleaning.HardDeleteCron); err != nil {
+		return fmt.Errorf("hard_delete_cron 无效: %w", err)
+	}
+	if c.Cleaning.HistoryDays < 0 {
+		return fmt.Errorf("cleaning.history_days 不能为负数")
+	}
+	if c.Cleaning.MoveBandwidthMB < 0 {
+		return fmt.Errorf("move_bandwidth_mb 不能为负数")
+	}
+	if c.Cleaning.HistoryDays == 0 {
+		c.Cleaning.HistoryDays = 90
+	}
+	if c.Cleaning.PruneMinAgeHours < 0 {
+		return fmt.Errorf("prune_min_age_hours 不能为负数")
+	}
+	if c.Cleaning.TempGraceHours < 0 {
+		return fmt.Errorf("temp_grace_hours 不能为负数")
+	}
+	if c.Cleaning.TempGraceHours == 0 {
+		c.Cleaning.TempGraceHours = 6
+	}
+	if c.Cleaning.PartialGraceHours < 0 {
+		return fmt.Errorf("partial_grace_hours 不能为负数")
+	}
+	if c.Cleaning.PartialGraceHours == 0 {
+		c.Cleaning.PartialGraceHours = 72 // 覆盖至少两次每日清理，中断的移动有机会续传
+	}
+	if c.Cleaning.PruneMinAgeHours == 0 {
+		c.Cleaning.PruneMinAgeHours = 24
+	}
+	if c.Cleaning.PruneEmptyDirs && len(c.Cleaning.PruneIgnore) == 0 {
+		c.Cleaning.PruneIgnore = DefaultPruneIgnore
+	}
+	for _, pattern := range c.Cleaning.PruneIgnore {
+		if _, err := path.Match(pattern, ""); err != nil || strings.ContainsAny(pattern, `/\`) {
+			return fmt.Errorf("prune_ignore 无效: %q（只能是文件名模式）", pattern)
+		}
+	}
+	for i, dir := range c.Cleaning.PruneKeepDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("prune_keep_dirs 必须为绝对路径: %s", dir)
+		}
+		c.Cleaning.PruneKeepDirs[i] = filepath.Clean(dir)
+	}
+
+	// 验证扫描器配置
+	if c.Scanner.StableSeconds < 0 {
+		return fmt.Errorf("stable_seconds 不能为负数")
+	}
+	if c.Scanner.StableScans < 0 {
+		return fmt.Errorf("stable_scans 不能为负数")
+	}
+	if c.Scanner.WalkWorkers < 0 || c.Scanner.BatchSize < 0 {
+		return fmt.Errorf("walk_workers 和 batch_size 不能为负数")
+	}
+	if c.Scanner.WalkWorkers == 0 {
+		c.Scanner.WalkWorkers = 4 // 默认4个并行遍历协程
+	}
+	if c.Scanner.BatchSize == 0 {
+		c.Scanner.BatchSize = 500 // 默认每批500条
+	}
+	if c.Scanner.DeepScanHours < 0 {
+		return fmt.Errorf("deep_scan_hours 不能为负数")
+	}
+	if c.Scanner.DeepScanHours == 0 {
+		c.Scanner.DeepScanHours = 24 // 默认每天一次完整扫描
+	}
+
+	// 验证输出校验配置
+	if c.Verify.IntervalMinutes < 0 || c.Verify.ReverifyDays < 0 || c.Verify.Workers < 0 ||
+		c.Verify.BatchSize < 0 || c.Verify.HistoryDays < 0 {
+		return fmt.Errorf("verify 段的数值配置不能为负数")
+	}
+	if c.Verify.IntervalMinutes == 0 {
+		c.Verify.IntervalMinutes = 60 // 默认每小时检查一次待校验的输出
+	}
+	if c.Verify.ReverifyDays == 0 {
+		c.Verify.ReverifyDays = 30 // 默认每个输出每30天校验一次
+	}
+	if c.Verify.Workers == 0 {
+		c.Verify.Workers = 2
+	}
+	if c.Verify.BatchSize == 0 {
+		c.Verify.BatchSize = 100
+	}
+	if c.Verify.HistoryDays == 0 {
+		c.Verify.HistoryDays = 90
+	}
+	if c.Verify.QuarantineDir == "" {
+		c.Verify.QuarantineDir = ".stm_quarantine"
+	}
+	if strings.ContainsAny(c.Verify.QuarantineDir, `/\`) {
+		return fmt.Errorf("quarantine_dir 只能是目录名: %s", c.Verify.QuarantineDir)
+	}
+
+	// 验证源文件隔离配置
+	if c.Quarantine.AfterFailures < 0 {
+		return fmt.Errorf("quarantine.after_failures 不能为负数")
+	}
+	if c.Quarantine.AfterFailures == 0 {
+		c.Quarantine.AfterFailures = 3
+	}
+	if c.Quarantine.Dir == "" {
+		c.Quarantine.Dir = ".stm_quarantine"
+	}
+	if strings.ContainsAny(c.Quarantine.Dir, `/\`) {
+		return fmt.Errorf("quarantine.dir 只能是目录名: %s", c.Quarantine.Dir)
+	}
+
+	// 验证伴随文件配置
+	if c.Sidecar.Enabled && len(c.Sidecar.Patterns) == 0 {
+		c.Sidecar.Patterns = DefaultSidecarPatterns
+	}
+	for _, pattern := range c.Sidecar.Patterns {
+		if !strings.Contains(pattern, "{name}") || strings.ContainsAny(pattern, `/\`) {
+			return fmt.Errorf("sidecar.patterns 无效: %q（须包含 {name} 且只能是文件名）", pattern)
+		}
+		if _, err := path.Match(strings.ReplaceAll(pattern, "{name}", "x"), ""); err != nil {
+			return fmt.Errorf("sidecar.patterns 无效: %q: %w", pattern, err)
+		}
+	}
+	switch c.Sidecar.SubtitleFormat {
+	case "", "srt", "ass", "vtt":
+	default:
+		return fmt.Errorf("sidecar.subtitle_format 无效: %s（可选 srt/ass/vtt）", c.Sidecar.SubtitleFormat)
+	}
+
 	// 设置 FFmpeg 默认值
 	if !c.FFmpeg.StrictCheck {
 		// 默认不启用（已废弃，现在默认启用）
 		// 保持向后兼容，如果配置文件中未指定，默认为 true
 	}
 
+	if err := validateStreams("ffmpeg", c.FFmpeg.AudioTracks, c.FFmpeg.Subtitles); err != nil {
+		return err
+	}
+	for name, profile := range c.Profiles {
+		if profile.CRF < 0 {
+			return fmt.Errorf("转码配置 %s 的 crf 不能为负数", name)
+		}
+		if err := validateStreams("转码配置 "+name, profile.AudioTracks, profile.Subtitles); err != nil {
+			return err
+		}
+	}
+	if c.FFmpeg.DurationToleranceSeconds < 0 || c.FFmpeg.DurationTolerancePercent < 0 {
+		return fmt.Errorf("duration_tolerance_seconds 和 duration_tolerance_percent 不能为负数")
+	}
+	if c.FFmpeg.DurationToleranceSeconds == 0 {
+		c.FFmpeg.DurationToleranceSeconds = 2
+	}
+	if c.FFmpeg.DurationTolerancePercent == 0 {
+		c.FFmpeg.DurationTolerancePercent = 1
+	}
+
 	if c.FFmpeg.ProbeTimeoutSeconds < 0 {
 		return fmt.Errorf("probe_timeout_seconds 不能为负数")
 	}
@@ -218,6 +711,9 @@ func (c *Config) Validate() error {
 	if c.FFmpeg.DurationExtraMinutes < 0 {
 		return fmt.Errorf("duration_extra_minutes 不能为负数")
 	}
+	if c.FFmpeg.SalvageSegmentSeconds < 0 {
+		return fmt.Errorf("salvage_segment_seconds 不能为负数")
+	}
 
 	if c.FFmpeg.ProbeTimeoutSeconds == 0 {
 		c.FFmpeg.ProbeTimeoutSeconds = 30
@@ -234,6 +730,9 @@ func (c *Config) Validate() error {
 	if c.FFmpeg.OutputFPS == 0 {
 		c.FFmpeg.OutputFPS = 30
 	}
+	if c.FFmpeg.SalvageSegmentSeconds == 0 {
+		c.FFmpeg.SalvageSegmentSeconds = 30
+	}
 	if c.FFmpeg.CorruptStrategy == "" {
 		c.FFmpeg.CorruptStrategy = "auto"
 	}
@@ -258,6 +757,21 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateStreams 验证音轨与字幕设置
+func validateStreams(scope, audioTracks, subtitles string) error {
+	switch audioTracks {
+	case "", AudioTracksFirst, AudioTracksAll, AudioTracksNone:
+	default:
+		return fmt.Errorf("%s的 audio_tracks 无效: %s（可选 first/all/none）", scope, audioTracks)
+	}
+	switch subtitles {
+	case "", SubtitlesNone, SubtitlesAll:
+	default:
+		return fmt.Errorf("%s的 subtitles 无效: %s（可选 none/all）", scope, subtitles)
+	}
+	return nil
+}
+
 // applyEnvOverrides 应用环境变量覆盖
 func (c *Config) applyEnvOverrides() {
 	if val := os.Getenv("STM_MAX_WORKERS"); val != "" {
@@ -273,7 +787,15 @@ func (c *Config) applyEnvOverrides() {
 
 // GetTrashPath 获取完整的垃圾桶路径
 func (c *Config) GetTrashPath() string {
-	return filepath.Join(c.Path.Input, c.Path.Trash)
+	return c.TrashDir(c.Path.Input)
+}
+
+// TrashDir 返回配对输入或输出目录下的垃圾桶路径（trash 配置为绝对路径时所有配对共用）
+func (c *Config) TrashDir(base string) string {
+	if filepath.IsAbs(c.Path.Trash) {
+		return c.Path.Trash
+	}
+	return filepath.Join(base, c.Path.Trash)
 }
 
 // GetInputDirs 获取所有输入目录
@@ -306,6 +828,39 @@ func (c *Config) GetOutputDir(path string) string {
 	return c.Path.Output
 }
 
+// FindPair 查找路径所属的输入输出配对
+func (c *Config) FindPair(path string) (InputOutputPair, string, bool) {
+	for _, pair := range c.Path.Pairs {
+		if rel, err := filepath.Rel(pair.Input, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return pair, rel, true
+		}
+	}
+	return InputOutputPair{}, "", false
+}
+
+// FindOutputPair 查找输出文件所属的配对，返回配对及相对输出目录的路径
+func (c *Config) FindOutputPair(path string) (InputOutputPair, string, bool) {
+	for _, pair := range c.Path.Pairs {
+		if rel, err := filepath.Rel(pair.Output, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return pair, rel, true
+		}
+	}
+	return InputOutputPair{}, "", false
+}
+
+// ResolveOutputBase 获取源文件对应的输出路径（未统一扩展名）
+// override 为任务记录的覆盖输出路径（来自 .stm.yaml），为空时按配对映射
+func (c *Config) ResolveOutputBase(sourcePath, override string) (string, bool) {
+	if override != "" {
+		return override, true
+	}
+	pair, rel, ok := c.FindPair(sourcePath)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(pair.Output, rel), true
+}
+
 // GetPairs 获取所有输入输出配对
 func (c *Config) GetPairs() []InputOutputPair {
 	return c.Path.Pairs
@@ -387,3 +942,21 @@ func (c *Config) ApplyOutputExtension(path string) string {
 	}
 	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
 }
+
+// ExistingOutputPath 返回源文件当前存在的输出文件路径（优先统一扩展名后的路径），不存在时返回空
+func (c *Config) ExistingOutputPath(sourcePath, override string) string {
+	basePath, ok := c.ResolveOutputBase(sourcePath, override)
+	if !ok {
+		return ""
+	}
+	targetPath := c.ApplyOutputExtension(basePath)
+	if _, err := os.Stat(targetPath); err == nil {
+		return targetPath
+	}
+	if targetPath != basePath {
+		if _, err := os.Stat(basePath); err == nil {
+			return basePath
+		}
+	}
+	return ""
+}
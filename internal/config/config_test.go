@@ -71,6 +71,36 @@ log:
 	}
 }
 
+func TestLoadOrphanGraceHours(t *testing.T) {
+	base := `
+system: {cron_start: 2, cron_end: 8, max_workers: 1, scan_interval: 10}
+path: {input: "/input", output: "/output", database: "/data/tasks.db"}
+ffmpeg: {crf: 28}
+`
+	tests := []struct {
+		name     string
+		cleaning string
+		want     int
+	}{
+		{"未配置时使用默认值", "cleaning: {soft_delete_days: 7, hard_delete_days: 30}\n", DefaultOrphanGraceHours},
+		{"允许配置为 0", "cleaning: {soft_delete_days: 7, hard_delete_days: 30, orphan_grace_hours: 0}\n", 0},
+		{"指定值", "cleaning: {soft_delete_days: 7, hard_delete_days: 30, orphan_grace_hours: 6}\n", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			os.WriteFile(path, []byte(base+tt.cleaning), 0644)
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("加载配置失败: %v", err)
+			}
+			if cfg.Cleaning.OrphanGraceHours != tt.want {
+				t.Errorf("OrphanGraceHours = %d, want %d", cfg.Cleaning.OrphanGraceHours, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -164,6 +194,143 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "无效孤立任务策略",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Input:    "/input",
+					Output:   "/output",
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays: 7,
+					HardDeleteDays: 30,
+					OrphanPolicy:   "shred",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "无效音轨设置",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Input:    "/input",
+					Output:   "/output",
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28, AudioTracks: "second"},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays: 7,
+					HardDeleteDays: 30,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "无效移入垃圾桶前检查级别",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Input:    "/input",
+					Output:   "/output",
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays:    7,
+					HardDeleteDays:    30,
+					VerifyBeforeTrash: "decode",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "无效清理时间",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Input:    "/input",
+					Output:   "/output",
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays: 7,
+					HardDeleteDays: 30,
+					HardDeleteCron: "every day",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "归档目录位于输入目录下",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Pairs: []InputOutputPair{{
+						Input:        "/input",
+						Output:       "/output",
+						SourcePolicy: SourcePolicyArchive,
+						ArchiveDir:   "/input/archive",
+					}},
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays: 7,
+					HardDeleteDays: 30,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "伴随文件模式缺少 {name}",
+			config: Config{
+				System: SystemConfig{
+					CronStart:  2,
+					CronEnd:    8,
+					MaxWorkers: 3,
+				},
+				Path: PathConfig{
+					Input:    "/input",
+					Output:   "/output",
+					Database: "/data/db",
+				},
+				FFmpeg: FFmpegConfig{CRF: 28},
+				Cleaning: CleaningConfig{
+					SoftDeleteDays: 7,
+					HardDeleteDays: 30,
+				},
+				Sidecar: SidecarConfig{
+					Enabled:  true,
+					Patterns: []string{"*.srt"},
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -216,6 +383,15 @@ func TestGetTrashPath(t *testing.T) {
 	if got := cfg.GetTrashPath(); got != expected {
 		t.Errorf("GetTrashPath() = %s, want %s", got, expected)
 	}
+	if got, want := cfg.TrashDir("/mnt/b"), filepath.Join("/mnt/b", ".stm_trash"); got != want {
+		t.Errorf("TrashDir() = %s, want %s", got, want)
+	}
+
+	// 绝对路径时所有配对共用同一个垃圾桶
+	cfg.Path.Trash = "/trash"
+	if got := cfg.TrashDir("/mnt/b"); got != "/trash" {
+		t.Errorf("TrashDir() = %s, want /trash", got)
+	}
 }
 
 func TestEnvOverrides(t *testing.T) {
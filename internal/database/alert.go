@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+const alertColumns = `id, kind, task_id, path, message, count, created_at, updated_at, resolved_at`
+
+// RaiseAlert 记录告警，同一任务同类未处理的告警只更新内容和次数
+func (db *DB) RaiseAlert(kind string, taskID int64, path, message string) error {
+	now := time.Now()
+	return db.withTx(func(q querier) error {
+		var id int64
+		err := q.QueryRow(`SELECT id FROM alerts WHERE kind = ? AND task_id = ? AND path = ? AND resolved_at IS NULL`,
+			kind, taskID, path).Scan(&id)
+		if err == sql.ErrNoRows {
+			_, err = q.Exec(`INSERT INTO alerts (kind, task_id, path, message, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?)`, kind, taskID, path, message, now, now)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(`UPDATE alerts SET message = ?, count = count + 1, updated_at = ? WHERE id = ?`,
+			message, now, id)
+		return err
+	})
+}
+
+// ResolveAlerts 问题已消失时关闭该任务的同类告警
+func (db *DB) ResolveAlerts(kind string, taskID int64) error {
+	_, err := db.conn.Exec(`UPDATE alerts SET resolved_at = ? WHERE kind = ? AND task_id = ? AND resolved_at IS NULL`,
+		time.Now(), kind, taskID)
+	return err
+}
+
+// DismissAlert 手动关闭告警，告警不存在或已关闭时返回 false
+func (db *DB) DismissAlert(id int64) (bool, error) {
+	result, err := db.conn.Exec(`UPDATE alerts SET resolved_at = ? WHERE id = ? AND resolved_at IS NULL`,
+		time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetActiveAlerts 查询未处理的告警（最近出现的在前）
+func (db *DB) GetActiveAlerts() ([]*Alert, error) {
+	rows, err := db.conn.Query(`SELECT ` + alertColumns + ` FROM alerts
+		WHERE resolved_at IS NULL ORDER BY updated_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*Alert
+	for rows.Next() {
+		a := &Alert{}
+		if err := rows.Scan(&a.ID, &a.Kind, &a.TaskID, &a.Path, &a.Message, &a.Count,
+			&a.CreatedAt, &a.UpdatedAt, &a.ResolvedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
@@ -0,0 +1,55 @@
+package database
+
+// AddArchiveItem 记录归档的源文件或伴随文件，源文件同时在任务上记录归档位置并标记已由清理模块移除
+func (db *DB) AddArchiveItem(item *ArchiveItem) error {
+	return db.withTx(func(q querier) error {
+		result, err := q.Exec(`
+			INSERT INTO archive_items (task_id, pair, original_path, archive_path, size, checksum, archived_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, item.TaskID, item.Pair, item.OriginalPath, item.ArchivePath, item.Size, item.Checksum, item.ArchivedAt)
+		if err != nil {
+			return err
+		}
+		if item.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if item.TaskID == 0 {
+			return nil
+		}
+		// 伴随文件与源文件共用任务 ID，只有源文件本身更新任务
+		_, err = q.Exec(`UPDATE tasks SET archived_path = ?, source_removed_at = ?, missing_since = NULL
+			WHERE id = ? AND source_path = ?`,
+			item.ArchivePath, item.ArchivedAt, item.TaskID, item.OriginalPath)
+		return err
+	})
+}
+
+// GetArchiveItems 查询归档清单（最新的在前），taskID 为 0 时不按任务筛选
+func (db *DB) GetArchiveItems(taskID int64, limit, offset int) ([]*ArchiveItem, error) {
+	query := `SELECT id, task_id, pair, original_path, archive_path, size, checksum, archived_at
+		FROM archive_items WHERE 1 = 1`
+	var args []interface{}
+	if taskID > 0 {
+		query += ` AND task_id = ?`
+		args = append(args, taskID)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*ArchiveItem
+	for rows.Next() {
+		item := &ArchiveItem{}
+		if err := rows.Scan(&item.ID, &item.TaskID, &item.Pair, &item.OriginalPath, &item.ArchivePath,
+			&item.Size, &item.Checksum, &item.ArchivedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Batch 批量写入事务
+// SQLite 为单连接模式，事务期间其他查询会等待，调用方需控制批次大小并及时提交
+type Batch struct {
+	tx *sql.Tx
+	db *DB
+}
+
+// BeginBatch 开启批量写入事务
+func (db *DB) BeginBatch() (*Batch, error) {
+	if db.sqlDB == nil {
+		return nil, sql.ErrTxDone // 不支持嵌套批量写入
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Batch{tx: tx, db: &DB{conn: tx}}, nil
+}
+
+// DB 返回绑定到该事务的 DB，读写均在事务内执行
+func (b *Batch) DB() *DB {
+	return b.db
+}
+
+// Commit 提交事务
+func (b *Batch) Commit() error {
+	return b.tx.Commit()
+}
+
+// Rollback 回滚事务（已提交时无副作用）
+func (b *Batch) Rollback() error {
+	return b.tx.Rollback()
+}
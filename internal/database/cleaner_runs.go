@@ -0,0 +1,51 @@
+package database
+
+import (
+	"time"
+)
+
+// AddCleanerRun 写入一次清理记录
+func (db *DB) AddCleanerRun(run *CleanerRun) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO cleaner_runs (trigger, phase, started_at, finished_at, trashed, trashed_bytes,
+			purged, freed_bytes, archived, archived_bytes, blocked, orphans, pruned_dirs, temp_files, temp_bytes, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.Trigger, run.Phase, run.StartedAt, run.FinishedAt, run.Trashed, run.TrashedBytes,
+		run.Purged, run.FreedBytes, run.Archived, run.ArchivedBytes, run.Blocked, run.Orphans, run.PrunedDirs, run.TempFiles, run.TempBytes, run.Error)
+	if err != nil {
+		return err
+	}
+	run.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetCleanerRuns 查询清理记录（最新的在前）
+func (db *DB) GetCleanerRuns(limit, offset int) ([]*CleanerRun, error) {
+	rows, err := db.conn.Query(`SELECT id, trigger, phase, started_at, finished_at, trashed, trashed_bytes,
+		purged, freed_bytes, archived, archived_bytes, blocked, orphans, pruned_dirs, temp_files, temp_bytes, error
+		FROM cleaner_runs ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*CleanerRun
+	for rows.Next() {
+		r := &CleanerRun{}
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.Phase, &r.StartedAt, &r.FinishedAt, &r.Trashed, &r.TrashedBytes,
+			&r.Purged, &r.FreedBytes, &r.Archived, &r.ArchivedBytes, &r.Blocked, &r.Orphans, &r.PrunedDirs, &r.TempFiles, &r.TempBytes, &r.Error); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// DeleteCleanerRunsBefore 删除早于指定时间的清理记录，返回删除条数
+func (db *DB) DeleteCleanerRunsBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM cleaner_runs WHERE started_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -12,7 +12,15 @@ import (
 
 // DB 数据库连接包装器
 type DB struct {
-	conn *sql.DB
+	conn  querier // 普通模式为 *sql.DB，批量写入时为 *sql.Tx
+	sqlDB *sql.DB // 底层连接，批量写入绑定的 DB 为 nil
+}
+
+// querier 兼容 *sql.DB 与 *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // Init 初始化数据库连接
@@ -37,7 +45,7 @@ func Init(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("启用WAL模式失败: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, sqlDB: conn}
 
 	// 初始化表结构
 	if err := db.createTables(); err != nil {
@@ -47,6 +55,26 @@ func Init(dbPath string) (*DB, error) {
 	return db, nil
 }
 
+// OpenReadOnly 以只读方式打开已有数据库，不创建文件、不执行迁移（用于试运行等只读场景）
+// 数据库文件不存在时返回 os.ErrNotExist
+func OpenReadOnly(dbPath string) (*DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	return &DB{conn: conn, sqlDB: conn}, nil
+}
+
 // createTables 创建数据库表
 func (db *DB) createTables() error {
 	schema := `
@@ -67,29 +95,315 @@ func (db *DB) createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_source_path ON tasks(source_path);
 	CREATE INDEX IF NOT EXISTS idx_status ON tasks(status);
 	CREATE INDEX IF NOT EXISTS idx_completed_at ON tasks(completed_at);
+	CREATE INDEX IF NOT EXISTS idx_source_size ON tasks(source_size);
+
+	CREATE TABLE IF NOT EXISTS scan_dirs (
+		path TEXT PRIMARY KEY,
+		parent TEXT NOT NULL,
+		mtime DATETIME NOT NULL,
+		file_count INTEGER NOT NULL DEFAULT 0,
+		scanned_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS verifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		source_path TEXT NOT NULL,
+		output_path TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		quarantine_path TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		verified_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_verifications_task ON verifications(task_id);
+	CREATE INDEX IF NOT EXISTS idx_verifications_result ON verifications(result, verified_at);
+
+	CREATE TABLE IF NOT EXISTS trash_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL DEFAULT 0,
+		pair TEXT NOT NULL DEFAULT '',
+		original_path TEXT NOT NULL,
+		trash_path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'trashed',
+		deleted_at DATETIME NOT NULL,
+		resolved_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trash_items_path ON trash_items(trash_path);
+	CREATE INDEX IF NOT EXISTS idx_trash_items_status ON trash_items(status, deleted_at);
+
+	CREATE TABLE IF NOT EXISTS alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		task_id INTEGER NOT NULL DEFAULT 0,
+		path TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		resolved_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_alerts_active ON alerts(resolved_at, kind, task_id);
+
+	CREATE TABLE IF NOT EXISTS cleaner_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trigger TEXT NOT NULL DEFAULT '',
+		phase TEXT NOT NULL DEFAULT '',
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME,
+		trashed INTEGER NOT NULL DEFAULT 0,
+		trashed_bytes INTEGER NOT NULL DEFAULT 0,
+		purged INTEGER NOT NULL DEFAULT 0,
+		freed_bytes INTEGER NOT NULL DEFAULT 0,
+		blocked INTEGER NOT NULL DEFAULT 0,
+		orphans INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_cleaner_runs_started ON cleaner_runs(started_at);
+
+	CREATE TABLE IF NOT EXISTS archive_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL DEFAULT 0,
+		pair TEXT NOT NULL DEFAULT '',
+		original_path TEXT NOT NULL,
+		archive_path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		checksum TEXT NOT NULL DEFAULT '',
+		archived_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_archive_items_task ON archive_items(task_id);
+
+	CREATE TABLE IF NOT EXISTS orphan_outputs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		pair TEXT NOT NULL DEFAULT '',
+		path TEXT NOT NULL UNIQUE,
+		source_path TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		mtime DATETIME NOT NULL,
+		detected_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS output_roots (
+		output TEXT PRIMARY KEY,
+		input TEXT NOT NULL,
+		last_seen_at DATETIME NOT NULL
+	);
 	`
 
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
+}
+
+// migrate 为旧版本数据库补齐新增列
+func (db *DB) migrate() error {
+	columns := []struct {
+		name string
+		def  string
+	}{
+		{"stable_scans", "INTEGER NOT NULL DEFAULT 0"},
+		{"stable_since", "DATETIME"},
+		{"profile", "TEXT NOT NULL DEFAULT ''"},
+		{"priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"output_path", "TEXT NOT NULL DEFAULT ''"},
+		{"source_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"missing_since", "DATETIME"},
+		{"source_removed_at", "DATETIME"},
+		{"last_verified_at", "DATETIME"},
+		{"corrupt_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"quarantine_path", "TEXT NOT NULL DEFAULT ''"},
+		{"salvage_steps", "TEXT NOT NULL DEFAULT ''"},
+		{"salvage_lost_seconds", "REAL NOT NULL DEFAULT 0"},
+		{"archived_path", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, col := range columns {
+		if err := db.ensureColumn("tasks", col.name, col.def); err != nil {
+			return fmt.Errorf("添加列 %s 失败: %w", col.name, err)
+		}
+	}
+
+	others := []struct {
+		table string
+		name  string
+		def   string
+	}{
+		{"trash_items", "purge_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"trash_items", "hold_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"cleaner_runs", "archived", "INTEGER NOT NULL DEFAULT 0"},
+		{"cleaner_runs", "archived_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"cleaner_runs", "pruned_dirs", "INTEGER NOT NULL DEFAULT 0"},
+		{"cleaner_runs", "temp_files", "INTEGER NOT NULL DEFAULT 0"},
+		{"cleaner_runs", "temp_bytes", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, col := range others {
+		if err := db.ensureColumn(col.table, col.name, col.def); err != nil {
+			return fmt.Errorf("添加列 %s.%s 失败: %w", col.table, col.name, err)
+		}
+	}
+	return nil
+}
+
+// ensureColumn 如果表中不存在该列则添加
+func (db *DB) ensureColumn(table, column, def string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
 	return err
 }
 
+// taskColumns 任务查询列，顺序需与 scanTask 保持一致
+const taskColumns = `id, source_path, source_mtime, source_size, status, retry_count,
+	progress, output_size, created_at, completed_at, log, stable_scans, stable_since,
+	profile, priority, output_path, source_hash, missing_since, source_removed_at,
+	last_verified_at, corrupt_count, quarantine_path, salvage_steps, salvage_lost_seconds,
+	archived_path`
+
+// rowScanner 兼容 *sql.Row 与 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask 从查询结果中读取一条任务记录
+func scanTask(row rowScanner) (*Task, error) {
+	task := &Task{}
+	err := row.Scan(
+		&task.ID,
+		&task.SourcePath,
+		&task.SourceMtime,
+		&task.SourceSize,
+		&task.Status,
+		&task.RetryCount,
+		&task.Progress,
+		&task.OutputSize,
+		&task.CreatedAt,
+		&task.CompletedAt,
+		&task.Log,
+		&task.StableScans,
+		&task.StableSince,
+		&task.Profile,
+		&task.Priority,
+		&task.OutputPath,
+		&task.SourceHash,
+		&task.MissingSince,
+		&task.SourceRemovedAt,
+		&task.LastVerifiedAt,
+		&task.CorruptCount,
+		&task.QuarantinePath,
+		&task.SalvageSteps,
+		&task.SalvageLostSeconds,
+		&task.ArchivedPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// queryTasks 执行查询并返回任务列表
+func (db *DB) queryTasks(query string, args ...interface{}) ([]*Task, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
 // Close 关闭数据库连接
 func (db *DB) Close() error {
-	return db.conn.Close()
+	if db.sqlDB == nil {
+		return nil // 批量写入绑定的 DB 由 Batch 负责提交
+	}
+	return db.sqlDB.Close()
 }
 
-// CreateTask 创建新任务
+// withTx 在事务中执行 fn；批量写入中直接复用外层事务
+func (db *DB) withTx(fn func(q querier) error) error {
+	if db.sqlDB == nil {
+		return fn(db.conn)
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateTask 创建新任务（未指定状态时为待处理）
 func (db *DB) CreateTask(task *Task) error {
+	status := task.Status
+	if status == "" {
+		status = StatusPending
+	}
+
 	query := `
-		INSERT INTO tasks (source_path, source_mtime, source_size, status)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO tasks (source_path, source_mtime, source_size, status, stable_since,
+		                   profile, priority, output_path, source_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := db.conn.Exec(query,
 		task.SourcePath,
 		task.SourceMtime,
 		task.SourceSize,
-		StatusPending,
+		status,
+		task.StableSince,
+		task.Profile,
+		task.Priority,
+		task.OutputPath,
+		task.SourceHash,
 	)
 
 	if err != nil {
@@ -98,7 +412,7 @@ func (db *DB) CreateTask(task *Task) error {
 
 	id, _ := result.LastInsertId()
 	task.ID = id
-	task.Status = StatusPending
+	task.Status = status
 	task.CreatedAt = time.Now()
 
 	return nil
@@ -107,27 +421,12 @@ func (db *DB) CreateTask(task *Task) error {
 // GetTaskByPath 通过路径查询任务
 func (db *DB) GetTaskByPath(path string) (*Task, error) {
 	query := `
-		SELECT id, source_path, source_mtime, source_size, status, retry_count,
-		       progress, output_size, created_at, completed_at, log
+		SELECT ` + taskColumns + `
 		FROM tasks
 		WHERE source_path = ?
 	`
 
-	task := &Task{}
-	err := db.conn.QueryRow(query, path).Scan(
-		&task.ID,
-		&task.SourcePath,
-		&task.SourceMtime,
-		&task.SourceSize,
-		&task.Status,
-		&task.RetryCount,
-		&task.Progress,
-		&task.OutputSize,
-		&task.CreatedAt,
-		&task.CompletedAt,
-		&task.Log,
-	)
-
+	task, err := scanTask(db.conn.QueryRow(query, path))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -135,28 +434,35 @@ func (db *DB) GetTaskByPath(path string) (*Task, error) {
 	return task, err
 }
 
-// UpdateTaskStatus 更新任务状态
-func (db *DB) UpdateTaskStatus(id int64, status TaskStatus, log string) error {
-	tx, err := db.conn.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+// GetTaskByID 通过 ID 查询任务，不存在时返回 nil
+func (db *DB) GetTaskByID(id int64) (*Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE id = ?`
 
-	query := `UPDATE tasks SET status = ?, log = ? WHERE id = ?`
-	if _, err := tx.Exec(query, status, log, id); err != nil {
-		return err
+	task, err := scanTask(db.conn.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
 
-	// 如果是完成状态，记录完成时间
-	if status == StatusCompleted {
-		now := time.Now()
-		if _, err := tx.Exec(`UPDATE tasks SET completed_at = ? WHERE id = ?`, now, id); err != nil {
+	return task, err
+}
+
+// UpdateTaskStatus 更新任务状态
+func (db *DB) UpdateTaskStatus(id int64, status TaskStatus, log string) error {
+	return db.withTx(func(q querier) error {
+		query := `UPDATE tasks SET status = ?, log = ? WHERE id = ?`
+		if _, err := q.Exec(query, status, log, id); err != nil {
 			return err
 		}
-	}
 
-	return tx.Commit()
+		// 如果是完成状态，记录完成时间；新的输出尚未校验
+		if status == StatusCompleted {
+			now := time.Now()
+			if _, err := q.Exec(`UPDATE tasks SET completed_at = ?, last_verified_at = NULL WHERE id = ?`, now, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // UpdateTaskProgress 更新任务进度
@@ -173,6 +479,13 @@ func (db *DB) UpdateTaskOutputSize(id int64, size int64) error {
 	return err
 }
 
+// UpdateTaskOverrides 更新目录覆盖配置（转码配置、优先级、输出路径）
+func (db *DB) UpdateTaskOverrides(id int64, profile string, priority int, outputPath string) error {
+	query := `UPDATE tasks SET profile = ?, priority = ?, output_path = ? WHERE id = ?`
+	_, err := db.conn.Exec(query, profile, priority, outputPath, id)
+	return err
+}
+
 // UpdateTaskPath 更新任务路径（用于迁移旧版本相对路径到新版本完整路径）
 func (db *DB) UpdateTaskPath(id int64, newPath string) error {
 	query := `UPDATE tasks SET source_path = ? WHERE id = ?`
@@ -180,86 +493,122 @@ func (db *DB) UpdateTaskPath(id int64, newPath string) error {
 	return err
 }
 
+// UpdateTaskHash 更新源文件内容指纹
+func (db *DB) UpdateTaskHash(id int64, hash string) error {
+	query := `UPDATE tasks SET source_hash = ? WHERE id = ?`
+	_, err := db.conn.Exec(query, hash, id)
+	return err
+}
+
+// GetTasksBySize 查询源文件大小相同的任务（用于重命名检测）
+func (db *DB) GetTasksBySize(size int64) ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE source_size = ?
+	`
+
+	return db.queryTasks(query, size)
+}
+
+// GetTasksUnderDir 查询源文件位于指定目录下的任务
+func (db *DB) GetTasksUnderDir(dir string) ([]*Task, error) {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	// 范围查询可走 source_path 索引：[prefix, prefix 末尾分隔符+1)
+	upper := prefix[:len(prefix)-1] + string(rune(filepath.Separator)+1)
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE source_path >= ? AND source_path < ?
+	`
+
+	return db.queryTasks(query, prefix, upper)
+}
+
+// GetLegacyTasks 查询旧版本以相对路径记录的任务
+func (db *DB) GetLegacyTasks() ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE substr(source_path, 1, 1) != '/'
+	`
+
+	return db.queryTasks(query)
+}
+
+// MarkTaskMissing 记录源文件首次发现缺失的时间
+func (db *DB) MarkTaskMissing(id int64, since time.Time) error {
+	query := `UPDATE tasks SET missing_since = ? WHERE id = ? AND missing_since IS NULL`
+	_, err := db.conn.Exec(query, since, id)
+	return err
+}
+
+// ClearTaskMissing 源文件重新出现，清除缺失标记
+func (db *DB) ClearTaskMissing(id int64) error {
+	query := `UPDATE tasks SET missing_since = NULL WHERE id = ?`
+	_, err := db.conn.Exec(query, id)
+	return err
+}
+
+// RestoreOrphanedTask 孤立任务的源文件重新出现，恢复为已完成或待处理
+func (db *DB) RestoreOrphanedTask(id int64) error {
+	query := `
+		UPDATE tasks
+		SET status = CASE WHEN completed_at IS NULL THEN ? ELSE ? END,
+		    missing_since = NULL, log = ?
+		WHERE id = ? AND status = ?
+	`
+	_, err := db.conn.Exec(query, StatusPending, StatusCompleted, "源文件已恢复", id, StatusOrphaned)
+	return err
+}
+
+// ClearSourceRemoved 源文件已从垃圾桶恢复，重新参与孤立检测
+func (db *DB) ClearSourceRemoved(id int64) error {
+	query := `UPDATE tasks SET source_removed_at = NULL, missing_since = NULL WHERE id = ?`
+	_, err := db.conn.Exec(query, id)
+	return err
+}
+
+// MarkSourceRemoved 记录源文件已由清理模块移除（移入垃圾桶），不再视为孤立
+func (db *DB) MarkSourceRemoved(id int64) error {
+	query := `UPDATE tasks SET source_removed_at = ?, missing_since = NULL WHERE id = ?`
+	_, err := db.conn.Exec(query, time.Now(), id)
+	return err
+}
+
 // GetPendingTasks 获取待处理任务
 func (db *DB) GetPendingTasks(limit int) ([]*Task, error) {
 	query := `
-		SELECT id, source_path, source_mtime, source_size, status, retry_count,
-		       progress, output_size, created_at, completed_at, log
+		SELECT ` + taskColumns + `
 		FROM tasks
 		WHERE status = ? AND retry_count < 3
-		ORDER BY created_at ASC
+		ORDER BY priority DESC, created_at ASC
 		LIMIT ?
 	`
 
-	rows, err := db.conn.Query(query, StatusPending, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tasks []*Task
-	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(
-			&task.ID,
-			&task.SourcePath,
-			&task.SourceMtime,
-			&task.SourceSize,
-			&task.Status,
-			&task.RetryCount,
-			&task.Progress,
-			&task.OutputSize,
-			&task.CreatedAt,
-			&task.CompletedAt,
-			&task.Log,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
-	}
-
-	return tasks, rows.Err()
+	return db.queryTasks(query, StatusPending, limit)
 }
 
 // GetCompletedOldTasks 查询N天前完成的任务
 func (db *DB) GetCompletedOldTasks(cutoffTime time.Time) ([]*Task, error) {
 	query := `
-		SELECT id, source_path, source_mtime, source_size, status, retry_count,
-		       progress, output_size, created_at, completed_at, log
+		SELECT ` + taskColumns + `
 		FROM tasks
 		WHERE status = ? AND completed_at < ?
 	`
 
-	rows, err := db.conn.Query(query, StatusCompleted, cutoffTime)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return db.queryTasks(query, StatusCompleted, cutoffTime)
+}
 
-	var tasks []*Task
-	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(
-			&task.ID,
-			&task.SourcePath,
-			&task.SourceMtime,
-			&task.SourceSize,
-			&task.Status,
-			&task.RetryCount,
-			&task.Progress,
-			&task.OutputSize,
-			&task.CreatedAt,
-			&task.CompletedAt,
-			&task.Log,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
-	}
+// GetCompletedUnremovedTasks 查询已完成但源文件尚未被清理模块移除的任务
+func (db *DB) GetCompletedUnremovedTasks() ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE status = ? AND source_removed_at IS NULL
+	`
 
-	return tasks, rows.Err()
+	return db.queryTasks(query, StatusCompleted)
 }
 
 // ResetTaskToPending 重置任务为待处理状态（文件更新时使用）
@@ -267,7 +616,8 @@ func (db *DB) ResetTaskToPending(path string, mtime time.Time, size int64) error
 	query := `
 		UPDATE tasks 
 		SET status = ?, source_mtime = ?, source_size = ?, retry_count = 0, 
-		    progress = 0, completed_at = NULL, log = ''
+		    progress = 0, completed_at = NULL, log = '', source_hash = '',
+		    last_verified_at = NULL, corrupt_count = 0, salvage_steps = '', salvage_lost_seconds = 0
 		WHERE source_path = ?
 	`
 
@@ -275,6 +625,47 @@ func (db *DB) ResetTaskToPending(path string, mtime time.Time, size int64) error
 	return err
 }
 
+// ResetTaskToSettling 文件发生变化后重新进入稳定性观察期
+func (db *DB) ResetTaskToSettling(path string, mtime time.Time, size int64) error {
+	query := `
+		UPDATE tasks
+		SET status = ?, source_mtime = ?, source_size = ?, retry_count = 0,
+		    progress = 0, completed_at = NULL, log = '', stable_scans = 0, stable_since = ?,
+		    source_hash = '', last_verified_at = NULL, corrupt_count = 0,
+		    salvage_steps = '', salvage_lost_seconds = 0
+		WHERE source_path = ?
+	`
+
+	_, err := db.conn.Exec(query, StatusSettling, mtime, size, time.Now(), path)
+	return err
+}
+
+// UpdateSettlingState 更新观察期中文件的元数据与稳定计数
+func (db *DB) UpdateSettlingState(id int64, mtime time.Time, size int64, stableScans int, stableSince time.Time) error {
+	query := `
+		UPDATE tasks
+		SET source_mtime = ?, source_size = ?, stable_scans = ?, stable_since = ?
+		WHERE id = ? AND status = ?
+	`
+
+	_, err := db.conn.Exec(query, mtime, size, stableScans, stableSince, id, StatusSettling)
+	return err
+}
+
+// PromoteSettledTask 文件已稳定，转为待处理
+func (db *DB) PromoteSettledTask(id int64) error {
+	query := `UPDATE tasks SET status = ?, log = ? WHERE id = ? AND status = ?`
+	_, err := db.conn.Exec(query, StatusPending, "文件已稳定，加入队列", id, StatusSettling)
+	return err
+}
+
+// UpdateTaskSalvage 记录抢救损坏源文件的步骤与丢弃时长
+func (db *DB) UpdateTaskSalvage(id int64, steps string, lostSeconds float64) error {
+	query := `UPDATE tasks SET salvage_steps = ?, salvage_lost_seconds = ? WHERE id = ?`
+	_, err := db.conn.Exec(query, steps, lostSeconds, id)
+	return err
+}
+
 // IncrementRetryCount 增加重试次数
 func (db *DB) IncrementRetryCount(id int64) error {
 	query := `UPDATE tasks SET retry_count = retry_count + 1 WHERE id = ?`
@@ -330,6 +721,9 @@ func (db *DB) GetStats() (*Stats, error) {
 			COALESCE(SUM(CASE WHEN status = 'processing' THEN 1 ELSE 0 END), 0) as processing_count,
 			COALESCE(SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END), 0) as completed_count,
 			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) as failed_count,
+			COALESCE(SUM(CASE WHEN status = 'settling' THEN 1 ELSE 0 END), 0) as settling_count,
+			COALESCE(SUM(CASE WHEN status = 'orphaned' THEN 1 ELSE 0 END), 0) as orphaned_count,
+			COALESCE(SUM(CASE WHEN status = 'quarantined' THEN 1 ELSE 0 END), 0) as quarantined_count,
 			COALESCE(SUM(CASE WHEN status = 'completed' THEN (source_size - output_size) ELSE 0 END), 0) as total_saved
 		FROM tasks
 	`
@@ -340,12 +734,30 @@ func (db *DB) GetStats() (*Stats, error) {
 		&stats.ProcessingCount,
 		&stats.CompletedCount,
 		&stats.FailedCount,
+		&stats.SettlingCount,
+		&stats.OrphanedCount,
+		&stats.QuarantinedCount,
 		&stats.TotalSaved,
 	)
 
 	return stats, err
 }
 
+// GetOutputRatio 统计已完成任务的输出/源文件大小比例，返回比例和样本数
+func (db *DB) GetOutputRatio() (float64, int, error) {
+	var sourceTotal, outputTotal int64
+	var samples int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(source_size), 0), COALESCE(SUM(output_size), 0)
+		FROM tasks
+		WHERE status = 'completed' AND source_size > 0 AND output_size > 0
+	`).Scan(&samples, &sourceTotal, &outputTotal)
+	if err != nil || samples == 0 {
+		return 0, 0, err
+	}
+	return float64(outputTotal) / float64(sourceTotal), samples, nil
+}
+
 // GetAllTasks 获取所有任务（支持分页和状态筛选）
 func (db *DB) GetAllTasks(status string, limit, offset int) ([]*Task, error) {
 	var query string
@@ -353,8 +765,7 @@ func (db *DB) GetAllTasks(status string, limit, offset int) ([]*Task, error) {
 
 	if status != "" {
 		query = `
-			SELECT id, source_path, source_mtime, source_size, status, retry_count,
-			       progress, output_size, created_at, completed_at, log
+			SELECT ` + taskColumns + `
 			FROM tasks
 			WHERE status = ?
 			ORDER BY created_at DESC
@@ -363,8 +774,7 @@ func (db *DB) GetAllTasks(status string, limit, offset int) ([]*Task, error) {
 		args = []interface{}{status, limit, offset}
 	} else {
 		query = `
-			SELECT id, source_path, source_mtime, source_size, status, retry_count,
-			       progress, output_size, created_at, completed_at, log
+			SELECT ` + taskColumns + `
 			FROM tasks
 			ORDER BY created_at DESC
 			LIMIT ? OFFSET ?
@@ -372,77 +782,20 @@ func (db *DB) GetAllTasks(status string, limit, offset int) ([]*Task, error) {
 		args = []interface{}{limit, offset}
 	}
 
-	rows, err := db.conn.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tasks []*Task
-	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(
-			&task.ID,
-			&task.SourcePath,
-			&task.SourceMtime,
-			&task.SourceSize,
-			&task.Status,
-			&task.RetryCount,
-			&task.Progress,
-			&task.OutputSize,
-			&task.CreatedAt,
-			&task.CompletedAt,
-			&task.Log,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
-	}
-
-	return tasks, rows.Err()
+	return db.queryTasks(query, args...)
 }
 
 // GetScanErrorTasks 获取输出校验/扫描发现异常的任务
 func (db *DB) GetScanErrorTasks(limit, offset int) ([]*Task, error) {
 	query := `
-		SELECT id, source_path, source_mtime, source_size, status, retry_count,
-		       progress, output_size, created_at, completed_at, log
+		SELECT ` + taskColumns + `
 		FROM tasks
 		WHERE status != ? AND COALESCE(log, '') LIKE ?
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.conn.Query(query, StatusCompleted, "%输出文件%", limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tasks []*Task
-	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(
-			&task.ID,
-			&task.SourcePath,
-			&task.SourceMtime,
-			&task.SourceSize,
-			&task.Status,
-			&task.RetryCount,
-			&task.Progress,
-			&task.OutputSize,
-			&task.CreatedAt,
-			&task.CompletedAt,
-			&task.Log,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
-	}
-
-	return tasks, rows.Err()
+	return db.queryTasks(query, StatusCompleted, "%输出文件%", limit, offset)
 }
 
 // DeleteTask 删除任务记录
@@ -25,6 +25,34 @@ func TestInit(t *testing.T) {
 	}
 }
 
+func TestOpenReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	// 文件不存在时不创建
+	if _, err := OpenReadOnly(dbPath); !os.IsNotExist(err) {
+		t.Fatalf("数据库不存在时应返回 ErrNotExist: %v", err)
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Fatal("只读打开不应创建数据库文件")
+	}
+
+	db, _ := Init(dbPath)
+	db.CreateTask(&Task{SourcePath: "/input/a.mp4", SourceMtime: time.Now(), SourceSize: 1})
+	db.Close()
+
+	ro, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("只读打开失败: %v", err)
+	}
+	defer ro.Close()
+	if task, err := ro.GetTaskByPath("/input/a.mp4"); err != nil || task == nil {
+		t.Errorf("只读连接应能查询任务: %v", err)
+	}
+	if err := ro.CreateTask(&Task{SourcePath: "/input/b.mp4", SourceMtime: time.Now(), SourceSize: 1}); err == nil {
+		t.Error("只读连接不应允许写入")
+	}
+}
+
 func TestCreateTask(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -238,3 +266,43 @@ func TestResetTaskToPending(t *testing.T) {
 		t.Error("完成时间未清除")
 	}
 }
+
+func TestBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, _ := Init(filepath.Join(tmpDir, "test.db"))
+	defer db.Close()
+
+	// 提交后可见
+	batch, err := db.BeginBatch()
+	if err != nil {
+		t.Fatalf("开启批量写入失败: %v", err)
+	}
+	for _, path := range []string{"/in/a.mp4", "/in/b.mp4"} {
+		if err := batch.DB().CreateTask(&Task{SourcePath: path, SourceMtime: time.Now(), SourceSize: 1}); err != nil {
+			t.Fatalf("批量创建任务失败: %v", err)
+		}
+	}
+	// 事务内可读到自己的写入
+	if tasks, _ := batch.DB().GetTasksBySize(1); len(tasks) != 2 {
+		t.Errorf("事务内查询结果错误: %d", len(tasks))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+
+	// 回滚后不可见
+	batch, _ = db.BeginBatch()
+	batch.DB().CreateTask(&Task{SourcePath: "/in/c.mp4", SourceMtime: time.Now(), SourceSize: 1})
+	batch.Rollback()
+
+	tasks, err := db.GetTasksUnderDir("/in")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Errorf("期望 2 个任务，实际 %d", len(tasks))
+	}
+	if other, _ := db.GetTasksUnderDir("/i"); len(other) != 0 {
+		t.Errorf("前缀不应跨目录匹配: %d", len(other))
+	}
+}
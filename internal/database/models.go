@@ -13,6 +13,10 @@ const (
 	StatusProcessing TaskStatus = "processing"
 	StatusCompleted  TaskStatus = "completed"
 	StatusFailed     TaskStatus = "failed"
+	StatusSettling   TaskStatus = "settling" // 文件仍在写入，等待稳定后入队
+	StatusOrphaned   TaskStatus = "orphaned" // 源文件在 STM 之外被删除
+
+	StatusQuarantined TaskStatus = "quarantined" // 源文件反复检查失败，已移入隔离区
 )
 
 // Task 转码任务模型
@@ -28,6 +32,23 @@ type Task struct {
 	CreatedAt   time.Time      `db:"created_at" json:"created_at"`     // 创建时间
 	CompletedAt *time.Time     `db:"completed_at" json:"completed_at"` // 完成时间
 	Log         sql.NullString `db:"log" json:"log"`                   // 日志信息（可为NULL）
+	StableScans int            `db:"stable_scans" json:"stable_scans"` // 连续未变化的扫描次数
+	StableSince *time.Time     `db:"stable_since" json:"stable_since"` // 当前大小/mtime首次观察到的时间
+	Profile     string         `db:"profile" json:"profile"`           // 转码配置名（来自 .stm.yaml）
+	Priority    int            `db:"priority" json:"priority"`         // 优先级，越大越先处理
+	OutputPath  string         `db:"output_path" json:"output_path"`   // 覆盖的输出路径（为空按配对映射）
+	SourceHash  string         `db:"source_hash" json:"source_hash"`   // 源文件内容指纹（头尾部分哈希）
+
+	MissingSince    *time.Time `db:"missing_since" json:"missing_since"`         // 首次发现源文件缺失的时间
+	SourceRemovedAt *time.Time `db:"source_removed_at" json:"source_removed_at"` // 源文件由清理模块移除的时间
+	LastVerifiedAt  *time.Time `db:"last_verified_at" json:"last_verified_at"`   // 输出文件最近一次校验通过的时间
+	CorruptCount    int        `db:"corrupt_count" json:"corrupt_count"`         // 源文件检查失败的累计次数（手动重试不清零）
+	QuarantinePath  string     `db:"quarantine_path" json:"quarantine_path"`     // 源文件被隔离后的位置
+
+	SalvageSteps       string  `db:"salvage_steps" json:"salvage_steps"`               // 抢救损坏源文件执行的步骤及结果
+	SalvageLostSeconds float64 `db:"salvage_lost_seconds" json:"salvage_lost_seconds"` // 抢救过程中丢弃的时长（秒）
+
+	ArchivedPath string `db:"archived_path" json:"archived_path"` // 源文件归档后的位置（source_policy=archive）
 }
 
 // GetLog 获取日志内容
@@ -49,9 +70,148 @@ func (t *Task) SetLog(log string) {
 
 // Stats 统计信息
 type Stats struct {
-	PendingCount    int   `db:"pending_count" json:"pending_count"`
-	ProcessingCount int   `db:"processing_count" json:"processing_count"`
-	CompletedCount  int   `db:"completed_count" json:"completed_count"`
-	FailedCount     int   `db:"failed_count" json:"failed_count"`
-	TotalSaved      int64 `db:"total_saved" json:"total_saved"` // 节省的空间（字节）
+	PendingCount     int   `db:"pending_count" json:"pending_count"`
+	ProcessingCount  int   `db:"processing_count" json:"processing_count"`
+	CompletedCount   int   `db:"completed_count" json:"completed_count"`
+	FailedCount      int   `db:"failed_count" json:"failed_count"`
+	SettlingCount    int   `db:"settling_count" json:"settling_count"`
+	OrphanedCount    int   `db:"orphaned_count" json:"orphaned_count"`
+	QuarantinedCount int   `db:"quarantined_count" json:"quarantined_count"`
+	TotalSaved       int64 `db:"total_saved" json:"total_saved"` // 节省的空间（字节）
+}
+
+// ScanDir 增量扫描记录的目录状态
+type ScanDir struct {
+	Path      string    `db:"path" json:"path"`
+	Parent    string    `db:"parent" json:"parent"`
+	Mtime     time.Time `db:"mtime" json:"mtime"`           // 上次读取时的目录 mtime（零值表示下次必须重新读取）
+	FileCount int       `db:"file_count" json:"file_count"` // 目录中的文件数（不含子目录）
+	ScannedAt time.Time `db:"scanned_at" json:"scanned_at"`
+}
+
+// VerifyResult 输出校验结果
+type VerifyResult string
+
+const (
+	VerifyOK       VerifyResult = "ok"       // 校验通过
+	VerifyMissing  VerifyResult = "missing"  // 输出文件缺失，已重新入队
+	VerifyCorrupt  VerifyResult = "corrupt"  // 输出文件损坏，已隔离并重新入队
+	VerifyMismatch VerifyResult = "mismatch" // 输出时长或流数量与源文件不一致，任务标记为失败
+	VerifyError    VerifyResult = "error"    // 校验过程出错（文件无法访问等），下次重试
+)
+
+// Verification 输出校验记录
+type Verification struct {
+	ID             int64        `db:"id" json:"id"`
+	TaskID         int64        `db:"task_id" json:"task_id"`
+	SourcePath     string       `db:"source_path" json:"source_path"`
+	OutputPath     string       `db:"output_path" json:"output_path"`
+	Result         VerifyResult `db:"result" json:"result"`
+	Error          string       `db:"error" json:"error,omitempty"`
+	QuarantinePath string       `db:"quarantine_path" json:"quarantine_path,omitempty"` // 损坏输出的隔离位置
+	DurationMs     int64        `db:"duration_ms" json:"duration_ms"`
+	VerifiedAt     time.Time    `db:"verified_at" json:"verified_at"`
+}
+
+// TrashStatus 垃圾桶文件状态
+type TrashStatus string
+
+const (
+	TrashTrashed  TrashStatus = "trashed"  // 在垃圾桶中
+	TrashRestored TrashStatus = "restored" // 已恢复到原位置
+	TrashPurged   TrashStatus = "purged"   // 已彻底删除
+)
+
+// 移入垃圾桶的原因
+const (
+	TrashReasonCleanup = "cleanup" // 转码完成超过 soft_delete_days 的源文件
+	TrashReasonOrphan  = "orphan"  // 孤立任务的输出（orphan_policy=trash）或没有对应任务的输出
+	TrashReasonSidecar = "sidecar" // 随源文件移入的伴随文件（字幕、nfo、海报等）
+)
+
+// TrashItem 垃圾桶清单记录
+type TrashItem struct {
+	ID           int64       `db:"id" json:"id"`
+	TaskID       int64       `db:"task_id" json:"task_id"`
+	Pair         string      `db:"pair" json:"pair"` // 来源配对的输入目录
+	OriginalPath string      `db:"original_path" json:"original_path"`
+	TrashPath    string      `db:"trash_path" json:"trash_path"`
+	Size         int64       `db:"size" json:"size"`
+	Reason       string      `db:"reason" json:"reason"`
+	Status       TrashStatus `db:"status" json:"status"`
+	DeletedAt    time.Time   `db:"deleted_at" json:"deleted_at"`
+	ResolvedAt   *time.Time  `db:"resolved_at" json:"resolved_at"`             // 恢复或彻底删除的时间
+	PurgeReason  string      `db:"purge_reason" json:"purge_reason,omitempty"` // 彻底删除的原因（到期、超出容量等）
+	HoldReason   string      `db:"hold_reason" json:"hold_reason,omitempty"`   // 非空时不会被自动彻底删除（到期、超出容量）
+}
+
+// 告警类型
+const (
+	AlertPreTrashCheck = "pre_trash_check" // 移入垃圾桶前输出检查失败，源文件保留
+	AlertCorruptOutput = "corrupt_output"  // 输出文件损坏且源文件已不在原位置，需要人工处理
+)
+
+// Alert 需要人工处理的告警（同一任务的同类告警合并为一条）
+type Alert struct {
+	ID         int64      `db:"id" json:"id"`
+	Kind       string     `db:"kind" json:"kind"`
+	TaskID     int64      `db:"task_id" json:"task_id"`
+	Path       string     `db:"path" json:"path"`
+	Message    string     `db:"message" json:"message"`
+	Count      int        `db:"count" json:"count"` // 重复出现的次数
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"` // 最近一次出现的时间
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at"`
+}
+
+// CleanerRun 一次清理任务的执行记录
+type CleanerRun struct {
+	ID            int64      `db:"id" json:"id"`
+	Trigger       string     `db:"trigger" json:"trigger"` // schedule/startup/manual
+	Phase         string     `db:"phase" json:"phase"`     // soft/hard/all
+	StartedAt     time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt    *time.Time `db:"finished_at" json:"finished_at"`
+	Trashed       int        `db:"trashed" json:"trashed"`               // 移入垃圾桶的文件数
+	TrashedBytes  int64      `db:"trashed_bytes" json:"trashed_bytes"`   // 移入垃圾桶的字节数
+	Purged        int        `db:"purged" json:"purged"`                 // 彻底删除的文件数（到期、超出容量）
+	FreedBytes    int64      `db:"freed_bytes" json:"freed_bytes"`       // 彻底删除释放的字节数
+	Archived      int        `db:"archived" json:"archived"`             // 移入归档目录的源文件数
+	ArchivedBytes int64      `db:"archived_bytes" json:"archived_bytes"` // 移入归档目录的字节数
+	Blocked       int        `db:"blocked" json:"blocked"`               // 输出检查未通过而保留的源文件数
+	Orphans       int        `db:"orphans" json:"orphans"`               // 按策略处理的孤立任务输出数
+	PrunedDirs    int        `db:"pruned_dirs" json:"pruned_dirs"`       // 删除的空目录数
+	TempFiles     int        `db:"temp_files" json:"temp_files"`         // 删除的残留转码临时文件数
+	TempBytes     int64      `db:"temp_bytes" json:"temp_bytes"`         // 删除残留临时文件释放的字节数
+	Error         string     `db:"error" json:"error,omitempty"`
+}
+
+// ArchiveItem 归档清单记录（source_policy=archive 的源文件去向）
+type ArchiveItem struct {
+	ID           int64     `db:"id" json:"id"`
+	TaskID       int64     `db:"task_id" json:"task_id"`
+	Pair         string    `db:"pair" json:"pair"` // 来源配对的输入目录
+	OriginalPath string    `db:"original_path" json:"original_path"`
+	ArchivePath  string    `db:"archive_path" json:"archive_path"`
+	Size         int64     `db:"size" json:"size"`
+	Checksum     string    `db:"checksum" json:"checksum,omitempty"` // 跨分区复制时校验的 SHA-256，同分区重命名时为空
+	ArchivedAt   time.Time `db:"archived_at" json:"archived_at"`
+}
+
+// OrphanOutput 输出目录中没有对应任务的文件（源文件被改名、任务被删除或配对被移除后遗留）
+type OrphanOutput struct {
+	ID         int64     `db:"id" json:"id"`
+	Pair       string    `db:"pair" json:"pair"`               // 所在配对的输入目录
+	Path       string    `db:"path" json:"path"`               // 输出文件路径
+	SourcePath string    `db:"source_path" json:"source_path"` // 按配对映射推断的源文件路径（收养时作为任务源路径）
+	Size       int64     `db:"size" json:"size"`
+	Mtime      time.Time `db:"mtime" json:"mtime"`
+	DetectedAt time.Time `db:"detected_at" json:"detected_at"`   // 首次发现时间
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"` // 最近一次核对时间
+}
+
+// OutputRoot 曾经配置过的输入输出目录配对，配对删除后仍用于核对其输出目录
+type OutputRoot struct {
+	Output     string    `db:"output" json:"output"`
+	Input      string    `db:"input" json:"input"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"` // 最近一次出现在配置中的时间
 }
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+const orphanOutputColumns = `id, pair, path, source_path, size, mtime, detected_at, last_seen_at`
+
+// scanOrphanOutput 从查询结果中读取一条无主输出记录
+func scanOrphanOutput(row rowScanner) (*OrphanOutput, error) {
+	o := &OrphanOutput{}
+	if err := row.Scan(&o.ID, &o.Pair, &o.Path, &o.SourcePath, &o.Size, &o.Mtime, &o.DetectedAt, &o.LastSeenAt); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// UpsertOrphanOutput 记录核对中发现的无主输出，已存在时更新大小与最近核对时间（保留首次发现时间）
+func (db *DB) UpsertOrphanOutput(o *OrphanOutput) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO orphan_outputs (pair, path, source_path, size, mtime, detected_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET pair = excluded.pair, source_path = excluded.source_path,
+			size = excluded.size, mtime = excluded.mtime, last_seen_at = excluded.last_seen_at
+	`, o.Pair, o.Path, o.SourcePath, o.Size, o.Mtime, o.LastSeenAt, o.LastSeenAt)
+	return err
+}
+
+// DeleteOrphanOutputsSeenBefore 删除本次核对中未再发现的记录（文件已删除或已有对应任务）
+func (db *DB) DeleteOrphanOutputsSeenBefore(t time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM orphan_outputs WHERE last_seen_at < ?`, t)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetOrphanOutputs 查询无主输出（按路径排序）
+func (db *DB) GetOrphanOutputs() ([]*OrphanOutput, error) {
+	rows, err := db.conn.Query(`SELECT ` + orphanOutputColumns + ` FROM orphan_outputs ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*OrphanOutput
+	for rows.Next() {
+		o, err := scanOrphanOutput(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, o)
+	}
+	return items, rows.Err()
+}
+
+// GetOrphanOutput 按 ID 查询无主输出，不存在时返回 nil
+func (db *DB) GetOrphanOutput(id int64) (*OrphanOutput, error) {
+	o, err := scanOrphanOutput(db.conn.QueryRow(`SELECT `+orphanOutputColumns+` FROM orphan_outputs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+// DeleteOrphanOutput 删除无主输出记录（文件已删除或已收养）
+func (db *DB) DeleteOrphanOutput(id int64) error {
+	_, err := db.conn.Exec(`DELETE FROM orphan_outputs WHERE id = ?`, id)
+	return err
+}
+
+// RecordOutputRoot 记录当前配置中的配对，输出目录相同时更新输入目录与最近出现时间
+func (db *DB) RecordOutputRoot(input, output string, seen time.Time) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO output_roots (output, input, last_seen_at) VALUES (?, ?, ?)
+		ON CONFLICT(output) DO UPDATE SET input = excluded.input, last_seen_at = excluded.last_seen_at
+	`, output, input, seen)
+	return err
+}
+
+// GetOutputRoots 查询记录过的所有配对（含已从配置中删除的）
+func (db *DB) GetOutputRoots() ([]*OutputRoot, error) {
+	rows, err := db.conn.Query(`SELECT output, input, last_seen_at FROM output_roots ORDER BY output`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roots []*OutputRoot
+	for rows.Next() {
+		r := &OutputRoot{}
+		if err := rows.Scan(&r.Output, &r.Input, &r.LastSeenAt); err != nil {
+			return nil, err
+		}
+		roots = append(roots, r)
+	}
+	return roots, rows.Err()
+}
+
+// CreateAdoptedTask 为已有的输出文件直接创建已完成的任务（不重新转码）
+// sourceRemoved 为 true 时源文件已不存在，标记为已移除以免扫描时被视为孤立
+func (db *DB) CreateAdoptedTask(task *Task, note string, sourceRemoved bool) error {
+	return db.withTx(func(q querier) error {
+		now := time.Now()
+		var removedAt *time.Time
+		if sourceRemoved {
+			removedAt = &now
+		}
+		result, err := q.Exec(`
+			INSERT INTO tasks (source_path, source_mtime, source_size, status, progress, output_size,
+			                   completed_at, log, profile, priority, output_path, source_hash, source_removed_at)
+			VALUES (?, ?, ?, ?, 100, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, task.SourcePath, task.SourceMtime, task.SourceSize, StatusCompleted, task.OutputSize,
+			now, note, task.Profile, task.Priority, task.OutputPath, task.SourceHash, removedAt)
+		if err != nil {
+			return err
+		}
+		task.ID, err = result.LastInsertId()
+		task.Status = StatusCompleted
+		task.Progress = 100
+		task.CompletedAt = &now
+		task.SourceRemovedAt = removedAt
+		task.SetLog(note)
+		return err
+	})
+}
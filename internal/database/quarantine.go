@@ -0,0 +1,36 @@
+package database
+
+import (
+	"time"
+)
+
+// IncrementCorruptCount 源文件检查失败次数加一，返回累计次数
+func (db *DB) IncrementCorruptCount(id int64) (int, error) {
+	var count int
+	err := db.withTx(func(q querier) error {
+		if _, err := q.Exec(`UPDATE tasks SET corrupt_count = corrupt_count + 1 WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return q.QueryRow(`SELECT corrupt_count FROM tasks WHERE id = ?`, id).Scan(&count)
+	})
+	return count, err
+}
+
+// MarkTaskQuarantined 记录源文件已移入隔离区
+func (db *DB) MarkTaskQuarantined(id int64, quarantinePath, logMsg string) error {
+	query := `UPDATE tasks SET status = ?, quarantine_path = ?, progress = 0, log = ? WHERE id = ?`
+	_, err := db.conn.Exec(query, StatusQuarantined, quarantinePath, logMsg, id)
+	return err
+}
+
+// RestoreQuarantinedTask 源文件已移回原位置，重新加入队列
+func (db *DB) RestoreQuarantinedTask(id int64, mtime time.Time, size int64) error {
+	query := `
+		UPDATE tasks
+		SET status = ?, source_mtime = ?, source_size = ?, retry_count = 0, corrupt_count = 0,
+		    quarantine_path = '', progress = 0, completed_at = NULL, missing_since = NULL, log = ?
+		WHERE id = ? AND status = ?
+	`
+	_, err := db.conn.Exec(query, StatusPending, mtime, size, "已从隔离区恢复", id, StatusQuarantined)
+	return err
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"path/filepath"
+)
+
+// GetScanDirs 查询根目录（含）下记录的所有目录状态
+func (db *DB) GetScanDirs(root string) ([]*ScanDir, error) {
+	root = filepath.Clean(root)
+	prefix := root + string(filepath.Separator)
+	upper := root + string(rune(filepath.Separator)+1)
+
+	rows, err := db.conn.Query(`
+		SELECT path, parent, mtime, file_count, scanned_at
+		FROM scan_dirs
+		WHERE path = ? OR (path >= ? AND path < ?)
+	`, root, prefix, upper)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dirs []*ScanDir
+	for rows.Next() {
+		dir := &ScanDir{}
+		if err := rows.Scan(&dir.Path, &dir.Parent, &dir.Mtime, &dir.FileCount, &dir.ScannedAt); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, rows.Err()
+}
+
+// SaveScanDirs 批量写入目录状态，删除已不存在的目录记录
+func (db *DB) SaveScanDirs(dirs []*ScanDir, removed []string) error {
+	return db.withTx(func(q querier) error {
+		for _, dir := range dirs {
+			_, err := q.Exec(`
+				INSERT INTO scan_dirs (path, parent, mtime, file_count, scanned_at)
+				VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT(path) DO UPDATE SET
+					parent = excluded.parent, mtime = excluded.mtime,
+					file_count = excluded.file_count, scanned_at = excluded.scanned_at
+			`, dir.Path, dir.Parent, dir.Mtime, dir.FileCount, dir.ScannedAt)
+			if err != nil {
+				return err
+			}
+		}
+		for _, path := range removed {
+			if _, err := q.Exec(`DELETE FROM scan_dirs WHERE path = ?`, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
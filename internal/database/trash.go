@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+const trashItemColumns = `id, task_id, pair, original_path, trash_path, size, reason, status, deleted_at,
+	resolved_at, purge_reason, hold_reason`
+
+// scanTrashItem 从查询结果中读取一条垃圾桶记录
+func scanTrashItem(row rowScanner) (*TrashItem, error) {
+	item := &TrashItem{}
+	err := row.Scan(&item.ID, &item.TaskID, &item.Pair, &item.OriginalPath, &item.TrashPath,
+		&item.Size, &item.Reason, &item.Status, &item.DeletedAt, &item.ResolvedAt, &item.PurgeReason, &item.HoldReason)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// AddTrashItem 记录移入垃圾桶的文件
+func (db *DB) AddTrashItem(item *TrashItem) error {
+	if item.Status == "" {
+		item.Status = TrashTrashed
+	}
+	result, err := db.conn.Exec(`
+		INSERT INTO trash_items (task_id, pair, original_path, trash_path, size, reason, status, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, item.TaskID, item.Pair, item.OriginalPath, item.TrashPath, item.Size, item.Reason, item.Status, item.DeletedAt)
+	if err != nil {
+		return err
+	}
+	item.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetTrashItem 通过 ID 查询垃圾桶记录，不存在时返回 nil
+func (db *DB) GetTrashItem(id int64) (*TrashItem, error) {
+	item, err := scanTrashItem(db.conn.QueryRow(`SELECT `+trashItemColumns+` FROM trash_items WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return item, err
+}
+
+// GetTrashedItems 查询仍在垃圾桶中的文件（按删除时间从早到晚）
+func (db *DB) GetTrashedItems() ([]*TrashItem, error) {
+	return db.queryTrashItems(`SELECT `+trashItemColumns+` FROM trash_items
+		WHERE status = ? ORDER BY deleted_at, id`, TrashTrashed)
+}
+
+// GetTrashedItemsByTask 查询任务仍在垃圾桶中、指定原因的文件（如随源文件移入的伴随文件）
+func (db *DB) GetTrashedItemsByTask(taskID int64, reason string) ([]*TrashItem, error) {
+	return db.queryTrashItems(`SELECT `+trashItemColumns+` FROM trash_items
+		WHERE status = ? AND task_id = ? AND reason = ? ORDER BY id`, TrashTrashed, taskID, reason)
+}
+
+// HasRemovalRecord 源文件是否有清理模块移入垃圾桶或归档的记录（含已彻底删除的垃圾桶记录）
+func (db *DB) HasRemovalRecord(taskID int64, sourcePath string) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM trash_items WHERE task_id = ? AND original_path = ?)
+		    OR EXISTS (SELECT 1 FROM archive_items WHERE task_id = ? AND original_path = ?)
+	`, taskID, sourcePath, taskID, sourcePath).Scan(&exists)
+	return exists, err
+}
+
+func (db *DB) queryTrashItems(query string, args ...interface{}) ([]*TrashItem, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// HoldTrashItem 阻止垃圾桶文件被自动彻底删除（如该文件是损坏输出对应的唯一源文件）
+func (db *DB) HoldTrashItem(id int64, reason string) error {
+	_, err := db.conn.Exec(`UPDATE trash_items SET hold_reason = ? WHERE id = ? AND status = ?`,
+		reason, id, TrashTrashed)
+	return err
+}
+
+// GetHeldTrashPaths 查询仍在垃圾桶中、不允许自动彻底删除的文件路径
+func (db *DB) GetHeldTrashPaths() (map[string]bool, error) {
+	rows, err := db.conn.Query(`SELECT trash_path FROM trash_items WHERE status = ? AND hold_reason != ''`, TrashTrashed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths[path] = true
+	}
+	return paths, rows.Err()
+}
+
+// ResolveTrashItem 标记垃圾桶记录已恢复或已彻底删除
+func (db *DB) ResolveTrashItem(id int64, status TrashStatus) error {
+	_, err := db.conn.Exec(`UPDATE trash_items SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+		status, time.Now(), id, TrashTrashed)
+	return err
+}
+
+// ResolveTrashPath 按垃圾桶路径标记记录（文件被直接删除时使用），无记录时不报错
+func (db *DB) ResolveTrashPath(trashPath string, status TrashStatus, reason string) error {
+	_, err := db.conn.Exec(`UPDATE trash_items SET status = ?, resolved_at = ?, purge_reason = ?
+		WHERE trash_path = ? AND status = ?`,
+		status, time.Now(), reason, trashPath, TrashTrashed)
+	return err
+}
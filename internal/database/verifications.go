@@ -0,0 +1,77 @@
+package database
+
+import (
+	"time"
+)
+
+// GetTasksToVerify 按 id 游标分页查询需要校验输出的已完成任务
+// 从未校验或上次校验早于 cutoff 的任务才会返回
+func (db *DB) GetTasksToVerify(afterID int64, cutoff time.Time, limit int) ([]*Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks
+		WHERE status = ? AND id > ? AND (last_verified_at IS NULL OR last_verified_at < ?)
+		ORDER BY id
+		LIMIT ?`
+	return db.queryTasks(query, StatusCompleted, afterID, cutoff, limit)
+}
+
+// MarkTaskVerified 记录输出校验通过的时间
+func (db *DB) MarkTaskVerified(id int64, at time.Time) error {
+	_, err := db.conn.Exec(`UPDATE tasks SET last_verified_at = ? WHERE id = ?`, at, id)
+	return err
+}
+
+// AddVerification 写入一条校验记录
+func (db *DB) AddVerification(v *Verification) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO verifications (task_id, source_path, output_path, result, error, quarantine_path, duration_ms, verified_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, v.TaskID, v.SourcePath, v.OutputPath, v.Result, v.Error, v.QuarantinePath, v.DurationMs, v.VerifiedAt)
+	if err != nil {
+		return err
+	}
+	v.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetVerifications 查询校验记录（最新的在前），result 为空时返回全部，taskID 为 0 时不按任务筛选
+func (db *DB) GetVerifications(result string, taskID int64, limit, offset int) ([]*Verification, error) {
+	query := `SELECT id, task_id, source_path, output_path, result, error, quarantine_path, duration_ms, verified_at
+		FROM verifications WHERE 1 = 1`
+	var args []interface{}
+	if result != "" {
+		query += ` AND result = ?`
+		args = append(args, result)
+	}
+	if taskID > 0 {
+		query += ` AND task_id = ?`
+		args = append(args, taskID)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Verification
+	for rows.Next() {
+		v := &Verification{}
+		if err := rows.Scan(&v.ID, &v.TaskID, &v.SourcePath, &v.OutputPath, &v.Result, &v.Error,
+			&v.QuarantinePath, &v.DurationMs, &v.VerifiedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+// DeleteVerificationsBefore 删除早于指定时间的校验记录，返回删除条数
+func (db *DB) DeleteVerificationsBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM verifications WHERE verified_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,251 @@
+// Package fileutil 提供跨分区安全的文件移动
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PartialSuffix 跨分区复制过程中目标文件的临时后缀，中断后下次移动时从该文件续传
+const PartialSuffix = ".stm_part"
+
+const bufferSize = 1 << 20
+
+// Options 移动选项
+type Options struct {
+	BytesPerSecond int64 // 跨分区复制限速（字节/秒），0为不限制
+}
+
+// Result 移动结果
+type Result struct {
+	Copied   bool   // 是否跨分区复制（否则为同分区重命名）
+	Checksum string // 跨分区复制时源文件内容的 SHA-256
+	Resumed  int64  // 从上次中断处续传的字节数
+}
+
+// Move 移动文件，同分区直接重命名；跨分区时流式复制到 <dst>.stm_part 并计算 SHA-256，
+// 同步后重新读取目标文件比对，再复制权限、属主和时间戳，重命名为 dst 后才删除源文件。
+// 复制中断留下的 .stm_part 会在下次移动同一文件时校验已复制部分后续传。
+func Move(src, dst string, opts Options) (*Result, error) {
+	err := os.Rename(src, dst)
+	if err == nil {
+		syncDir(filepath.Dir(dst))
+		return &Result{}, nil
+	}
+	if !IsCrossDevice(err) {
+		return nil, fmt.Errorf("移动文件失败: %w", err)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("读取源文件信息失败: %w", err)
+	}
+
+	partial := dst + PartialSuffix
+	result, err := copyFile(src, partial, info, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	written, err := Checksum(partial)
+	if err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("读取目标文件失败: %w", err)
+	}
+	if written != result.Checksum {
+		os.Remove(partial)
+		return nil, fmt.Errorf("校验失败: 源文件 %s, 目标文件 %s", result.Checksum, written)
+	}
+
+	if err := copyMetadata(partial, info); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, dst); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("重命名目标文件失败: %w", err)
+	}
+	syncDir(filepath.Dir(dst))
+
+	if err := os.Remove(src); err != nil {
+		return nil, fmt.Errorf("删除源文件失败: %w", err)
+	}
+	syncDir(filepath.Dir(src))
+	return result, nil
+}
+
+// IsCrossDevice 检查是否为跨设备重命名错误
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || strings.Contains(err.Error(), "invalid cross-device link")
+}
+
+// Checksum 计算文件内容的 SHA-256
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyBuffer(h, f, make([]byte, bufferSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile 复制到 partial 并同步到磁盘，已有的 partial 与源文件开头一致时续传
+func copyFile(src, partial string, info os.FileInfo, opts Options) (*Result, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("打开源文件失败: %w", err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, info.Mode().Perm())
+	if err != nil {
+		return nil, fmt.Errorf("创建目标文件失败: %w", err)
+	}
+	defer dstFile.Close()
+
+	h := sha256.New()
+	resumed, err := resume(srcFile, dstFile, info.Size(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = dstFile
+	if opts.BytesPerSecond > 0 {
+		w = &throttledWriter{w: dstFile, rate: opts.BytesPerSecond, start: time.Now()}
+	}
+	written, err := io.CopyBuffer(io.MultiWriter(w, h), srcFile, make([]byte, bufferSize))
+	if err != nil {
+		return nil, fmt.Errorf("复制数据失败: %w", err)
+	}
+	if total := resumed + written; total != info.Size() {
+		os.Remove(partial)
+		return nil, fmt.Errorf("复制数据不完整: 预期 %d 字节, 实际 %d 字节", info.Size(), total)
+	}
+
+	if err := dstFile.Sync(); err != nil {
+		return nil, fmt.Errorf("同步数据失败: %w", err)
+	}
+	return &Result{Copied: true, Checksum: hex.EncodeToString(h.Sum(nil)), Resumed: resumed}, nil
+}
+
+// resume 比较已复制部分与源文件开头，一致时将两个文件定位到续传位置并返回已复制字节数，
+// 否则清空目标文件从头复制。h 累计源文件已读取部分的哈希
+func resume(srcFile, dstFile *os.File, size int64, h hash.Hash) (int64, error) {
+	dstInfo, err := dstFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	done := dstInfo.Size()
+
+	if done > 0 && done <= size {
+		srcHash, dstHash := sha256.New(), sha256.New()
+		buf := make([]byte, bufferSize)
+		if _, err := io.CopyBuffer(io.MultiWriter(srcHash, h), io.LimitReader(srcFile, done), buf); err != nil {
+			return 0, fmt.Errorf("读取源文件失败: %w", err)
+		}
+		if _, err := io.CopyBuffer(dstHash, dstFile, buf); err != nil {
+			return 0, fmt.Errorf("读取未完成的目标文件失败: %w", err)
+		}
+		if string(srcHash.Sum(nil)) == string(dstHash.Sum(nil)) {
+			return done, nil // 两个文件均已读到 done 处
+		}
+		h.Reset()
+	}
+
+	// 没有可续传的内容
+	if _, err := srcFile.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := dstFile.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := dstFile.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// copyMetadata 复制权限、属主（无权限时跳过）和修改时间
+func copyMetadata(path string, info os.FileInfo) error {
+	if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("设置权限失败: %w", err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("设置属主失败: %w", err)
+		}
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("设置时间戳失败: %w", err)
+	}
+	return nil
+}
+
+// syncDir 同步目录，确保重命名/删除写入磁盘（部分文件系统不支持，忽略错误）
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// throttledWriter 按平均速率限速的 Writer
+type throttledWriter struct {
+	w       io.Writer
+	rate    int64 // 字节/秒
+	start   time.Time
+	written int64
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.written += int64(n)
+	expected := time.Duration(float64(t.written) / float64(t.rate) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// Copy 复制文件（先写入 <dst>.stm_part，同步并校验后再重命名），保留权限、属主和时间戳
+func Copy(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("读取源文件信息失败: %w", err)
+	}
+
+	partial := dst + PartialSuffix
+	result, err := copyFile(src, partial, info, Options{})
+	if err != nil {
+		return err
+	}
+	written, err := Checksum(partial)
+	if err != nil || written != result.Checksum {
+		os.Remove(partial)
+		return fmt.Errorf("校验失败: 源文件 %s, 目标文件 %s: %v", result.Checksum, written, err)
+	}
+	if err := copyMetadata(partial, info); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, dst); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("重命名目标文件失败: %w", err)
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
@@ -0,0 +1,78 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveSameDevice(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.mkv")
+	dst := filepath.Join(tempDir, "dst.mkv")
+	os.WriteFile(src, []byte("video data"), 0644)
+
+	result, err := Move(src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Move() 失败: %v", err)
+	}
+	if result.Copied {
+		t.Error("同分区应直接重命名")
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("源文件应已移除: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "video data" {
+		t.Errorf("目标文件内容错误: %q", data)
+	}
+}
+
+func TestCopyFileResume(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.mkv")
+	partial := filepath.Join(tempDir, "dst.mkv"+PartialSuffix)
+	os.WriteFile(src, []byte("video data"), 0600)
+	mtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	os.Chtimes(src, mtime, mtime)
+	info, _ := os.Stat(src)
+
+	// echo -n "video data" | sha256sum
+	const want = "a37684ccb4710846dfe2f0ec8239ee3f36b5cacc1d7c917fb20984e5fd7d3de9"
+
+	// 已复制部分与源文件一致：续传
+	os.WriteFile(partial, []byte("video"), 0600)
+	result, err := copyFile(src, partial, info, Options{})
+	if err != nil {
+		t.Fatalf("copyFile() 失败: %v", err)
+	}
+	if result.Resumed != 5 || result.Checksum != want {
+		t.Errorf("续传结果错误: %+v", result)
+	}
+	if data, _ := os.ReadFile(partial); string(data) != "video data" {
+		t.Errorf("续传后内容错误: %q", data)
+	}
+
+	// 已复制部分与源文件不一致：从头复制
+	os.WriteFile(partial, []byte("audio"), 0600)
+	result, err = copyFile(src, partial, info, Options{BytesPerSecond: 1 << 20})
+	if err != nil {
+		t.Fatalf("copyFile() 失败: %v", err)
+	}
+	if result.Resumed != 0 || result.Checksum != want {
+		t.Errorf("重新复制结果错误: %+v", result)
+	}
+	if sum, _ := Checksum(partial); sum != want {
+		t.Errorf("目标文件校验值 = %s, want %s", sum, want)
+	}
+
+	// 权限与修改时间
+	os.Chmod(partial, 0644)
+	if err := copyMetadata(partial, info); err != nil {
+		t.Fatalf("copyMetadata() 失败: %v", err)
+	}
+	got, _ := os.Stat(partial)
+	if got.Mode().Perm() != 0600 || !got.ModTime().Equal(mtime) {
+		t.Errorf("元数据未保留: mode=%v mtime=%v", got.Mode().Perm(), got.ModTime())
+	}
+}
@@ -0,0 +1,63 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sidecars 返回源文件所在目录中匹配模式的伴随文件（如 movie.srt、movie-poster.jpg）
+// 模式中的 {name} 替换为源文件名（不含扩展名），源文件本身不会返回
+func Sidecars(sourcePath string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	dir := filepath.Dir(sourcePath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	name := escapeGlob(stem(sourcePath))
+	var sidecars []string
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == filepath.Base(sourcePath) {
+			continue
+		}
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(strings.ReplaceAll(pattern, "{name}", name), entry.Name()); ok {
+				sidecars = append(sidecars, filepath.Join(dir, entry.Name()))
+				break
+			}
+		}
+	}
+	sort.Strings(sidecars)
+	return sidecars, nil
+}
+
+// SidecarFor 返回伴随文件对应到 target 旁边的路径：保留相对源文件名的后缀
+// 例如 /in/movie.en.srt 对应输出 /out/movie.mp4 时为 /out/movie.en.srt
+func SidecarFor(sidecarPath, sourcePath, target string) string {
+	suffix := strings.TrimPrefix(filepath.Base(sidecarPath), stem(sourcePath))
+	return filepath.Join(filepath.Dir(target), stem(target)+suffix)
+}
+
+// stem 文件名去掉扩展名
+func stem(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// escapeGlob 转义文件名中的通配符
+func escapeGlob(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSidecars(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{
+		"movie [1080p].mkv", "movie [1080p].srt", "movie [1080p].en.srt",
+		"movie [1080p]-poster.jpg", "movie [1080p].nfo", "other.srt", "movie.srt",
+	} {
+		os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644)
+	}
+	source := filepath.Join(tempDir, "movie [1080p].mkv")
+
+	got, err := Sidecars(source, []string{"{name}.srt", "{name}.*.srt", "{name}-poster.jpg"})
+	if err != nil {
+		t.Fatalf("Sidecars() 失败: %v", err)
+	}
+	want := []string{
+		filepath.Join(tempDir, "movie [1080p]-poster.jpg"),
+		filepath.Join(tempDir, "movie [1080p].en.srt"),
+		filepath.Join(tempDir, "movie [1080p].srt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sidecars() = %v, want %v", got, want)
+	}
+
+	if got := SidecarFor(want[1], source, "/out/movie [1080p].mp4"); got != "/out/movie [1080p].en.srt" {
+		t.Errorf("SidecarFor() = %s", got)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "movie.srt")
+	dst := filepath.Join(tempDir, "out", "movie.srt")
+	os.WriteFile(src, []byte("subtitle"), 0640)
+	os.MkdirAll(filepath.Dir(dst), 0755)
+
+	if err := Copy(src, dst); err != nil {
+		t.Fatalf("Copy() 失败: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "subtitle" {
+		t.Errorf("目标文件内容错误: %q", data)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("源文件应保留: %v", err)
+	}
+	if info, _ := os.Stat(dst); info.Mode().Perm() != 0640 {
+		t.Errorf("权限未保留: %v", info.Mode())
+	}
+	if _, err := os.Stat(dst + PartialSuffix); !os.IsNotExist(err) {
+		t.Errorf("临时文件应已清理: %v", err)
+	}
+}
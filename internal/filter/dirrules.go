@@ -0,0 +1,251 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// IgnoreFileName 目录级忽略文件（gitignore 语法，作用于所在目录及其子目录）
+	IgnoreFileName = ".stmignore"
+	// OverrideFileName 目录级覆盖配置文件
+	OverrideFileName = ".stm.yaml"
+
+	// SourceIgnoreFile 规则来源：.stmignore
+	SourceIgnoreFile = "stmignore"
+)
+
+// ignoreRule .stmignore 中的一条规则
+type ignoreRule struct {
+	pattern  string
+	negate   bool // ! 开头：重新包含
+	dirOnly  bool // / 结尾：仅匹配目录
+	anchored bool // 含 /：相对于 .stmignore 所在目录
+	line     int
+	raw      string
+}
+
+// parseIgnoreFile 解析 gitignore 语法的规则文件
+func parseIgnoreFile(data string) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{line: lineNo, raw: line}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (r ignoreRule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return Match("/"+r.pattern, relPath)
+	}
+	return Match(r.pattern, relPath)
+}
+
+// DirOverrides .stm.yaml 中可覆盖的设置，作用于所在目录及其子目录
+type DirOverrides struct {
+	Profile      string `yaml:"profile" json:"profile,omitempty"`             // 转码配置名（对应 profiles）
+	Priority     *int   `yaml:"priority" json:"priority,omitempty"`           // 任务优先级，越大越先处理
+	OutputSubdir string `yaml:"output_subdir" json:"output_subdir,omitempty"` // 输出子目录（相对于配对输出目录）
+}
+
+// ResolvedOverrides 合并所有上级目录后的生效设置
+type ResolvedOverrides struct {
+	Profile  string
+	Priority int
+	// OutputBase 覆盖后的输出路径（未统一扩展名），为空表示使用默认映射
+	OutputBase string
+}
+
+type dirEntry struct {
+	generation uint64
+
+	ignoreMtime time.Time
+	ignore      []ignoreRule
+
+	overrideMtime time.Time
+	override      *DirOverrides
+}
+
+// DirRules 目录级规则缓存，按文件 mtime 失效
+// 同一轮扫描（generation）内每个目录只 stat 一次
+type DirRules struct {
+	mu         sync.Mutex
+	entries    map[string]*dirEntry
+	generation uint64
+}
+
+// NewDirRules 创建目录规则缓存
+func NewDirRules() *DirRules {
+	return &DirRules{entries: make(map[string]*dirEntry)}
+}
+
+// NewGeneration 开始新一轮扫描，之后访问的目录会重新检查文件 mtime
+func (d *DirRules) NewGeneration() {
+	d.mu.Lock()
+	d.generation++
+	d.mu.Unlock()
+}
+
+// load 读取目录的规则文件（命中缓存且 mtime 未变化时直接返回）
+func (d *DirRules) load(dir string) *dirEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[dir]
+	if ok && entry.generation == d.generation {
+		return entry
+	}
+	if !ok {
+		entry = &dirEntry{}
+		d.entries[dir] = entry
+	}
+	entry.generation = d.generation
+
+	ignorePath := filepath.Join(dir, IgnoreFileName)
+	if info, err := os.Stat(ignorePath); err == nil {
+		if !info.ModTime().Equal(entry.ignoreMtime) {
+			if data, err := os.ReadFile(ignorePath); err == nil {
+				entry.ignore = parseIgnoreFile(string(data))
+				entry.ignoreMtime = info.ModTime()
+			} else {
+				log.Printf("[Filter] 读取 %s 失败: %v", ignorePath, err)
+			}
+		}
+	} else {
+		entry.ignore = nil
+		entry.ignoreMtime = time.Time{}
+	}
+
+	overridePath := filepath.Join(dir, OverrideFileName)
+	if info, err := os.Stat(overridePath); err == nil {
+		if !info.ModTime().Equal(entry.overrideMtime) {
+			entry.override = nil
+			entry.overrideMtime = info.ModTime()
+			if data, err := os.ReadFile(overridePath); err == nil {
+				var override DirOverrides
+				if err := yaml.Unmarshal(data, &override); err != nil {
+					log.Printf("[Filter] 解析 %s 失败: %v", overridePath, err)
+				} else {
+					entry.override = &override
+				}
+			} else {
+				log.Printf("[Filter] 读取 %s 失败: %v", overridePath, err)
+			}
+		}
+	} else {
+		entry.override = nil
+		entry.overrideMtime = time.Time{}
+	}
+
+	return entry
+}
+
+// ancestors 返回从根目录到 relPath 父目录的所有目录（含根目录）
+func ancestors(root, relPath string) []string {
+	dirs := []string{root}
+	relDir := filepath.Dir(filepath.ToSlash(relPath))
+	if relDir == "." || relDir == "" {
+		return dirs
+	}
+	current := root
+	for _, part := range strings.Split(relDir, "/") {
+		current = filepath.Join(current, part)
+		dirs = append(dirs, current)
+	}
+	return dirs
+}
+
+// CheckIgnored 按 .stmignore 判断路径是否被忽略（后出现/更深层的规则优先）
+func (d *DirRules) CheckIgnored(root, relPath string, isDir bool) (Decision, bool) {
+	var (
+		matched  bool
+		decision Decision
+	)
+	for _, dir := range ancestors(root, relPath) {
+		entry := d.load(dir)
+		if len(entry.ignore) == 0 {
+			continue
+		}
+		scoped, err := filepath.Rel(dir, filepath.Join(root, relPath))
+		if err != nil {
+			continue
+		}
+		for _, rule := range entry.ignore {
+			if !rule.match(scoped, isDir) {
+				continue
+			}
+			matched = true
+			ruleName := fmt.Sprintf("%s:%d:%s", filepath.Join(dir, IgnoreFileName), rule.line, rule.raw)
+			if rule.negate {
+				decision = accept(ruleName, SourceIgnoreFile, "被 .stmignore 重新包含")
+			} else {
+				decision = reject(ruleName, SourceIgnoreFile, "被 .stmignore 忽略")
+			}
+		}
+	}
+	return decision, matched
+}
+
+// Resolve 合并从根目录到文件所在目录的 .stm.yaml，更深层的设置优先
+func (d *DirRules) Resolve(root, outputRoot, relPath string) ResolvedOverrides {
+	var resolved ResolvedOverrides
+	for _, dir := range ancestors(root, relPath) {
+		entry := d.load(dir)
+		if entry.override == nil {
+			continue
+		}
+		o := entry.override
+		if o.Profile != "" {
+			resolved.Profile = o.Profile
+		}
+		if o.Priority != nil {
+			resolved.Priority = *o.Priority
+		}
+		if o.OutputSubdir != "" {
+			// 该目录下的文件输出到 <输出目录>/<output_subdir>/<相对该目录的路径>
+			below, err := filepath.Rel(dir, filepath.Join(root, relPath))
+			if err == nil {
+				resolved.OutputBase = filepath.Join(outputRoot, filepath.Clean("/"+o.OutputSubdir), below)
+			}
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,254 @@
+package filter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/stm/video-transcoder/internal/config"
+)
+
+// 规则来源
+const (
+	SourceBuiltin = "builtin" // 内置系统规则
+	SourceGlobal  = "global"  // 全局配置
+	SourcePair    = "pair"    // 配对配置
+)
+
+// Decision 过滤判定结果
+type Decision struct {
+	Accepted bool   `json:"accepted"`
+	Rule     string `json:"rule,omitempty"`   // 命中的规则，如 exclude:**/sample/**
+	Source   string `json:"source,omitempty"` // 规则来源：builtin/global/pair
+	Reason   string `json:"reason"`
+}
+
+func accept(rule, source, reason string) Decision {
+	return Decision{Accepted: true, Rule: rule, Source: source, Reason: reason}
+}
+
+func reject(rule, source, reason string) Decision {
+	return Decision{Accepted: false, Rule: rule, Source: source, Reason: reason}
+}
+
+type pattern struct {
+	glob   string
+	source string
+}
+
+// Filter 单个目录配对的过滤器
+type Filter struct {
+	root        string
+	dirRules    *DirRules
+	trashName   string
+	quarantine  string
+	includes    []pattern
+	excludes    []pattern
+	minSize     int64
+	minDuration int
+	maxDuration int
+	sizeSource  string
+	durSource   string
+}
+
+// ForPair 根据全局配置与配对配置构建过滤器
+// 排除规则叠加生效；包含规则、大小与时长限制以配对配置优先
+func ForPair(cfg *config.Config, pair config.InputOutputPair) *Filter {
+	f := &Filter{root: pair.Input, trashName: cfg.Path.Trash, quarantine: cfg.Quarantine.Dir}
+
+	for _, p := range cfg.FFmpeg.ExcludePatterns {
+		f.excludes = append(f.excludes, pattern{glob: p, source: SourceGlobal})
+	}
+	for _, p := range cfg.Filter.Exclude {
+		f.excludes = append(f.excludes, pattern{glob: p, source: SourceGlobal})
+	}
+	for _, p := range pair.Filter.Exclude {
+		f.excludes = append(f.excludes, pattern{glob: p, source: SourcePair})
+	}
+
+	if len(pair.Filter.Include) > 0 {
+		for _, p := range pair.Filter.Include {
+			f.includes = append(f.includes, pattern{glob: p, source: SourcePair})
+		}
+	} else {
+		for _, p := range cfg.Filter.Include {
+			f.includes = append(f.includes, pattern{glob: p, source: SourceGlobal})
+		}
+	}
+
+	f.minSize, f.sizeSource = cfg.Filter.MinSizeMB*1024*1024, SourceGlobal
+	if pair.Filter.MinSizeMB > 0 {
+		f.minSize, f.sizeSource = pair.Filter.MinSizeMB*1024*1024, SourcePair
+	}
+
+	f.minDuration, f.maxDuration, f.durSource = cfg.Filter.MinDurationSeconds, cfg.Filter.MaxDurationSeconds, SourceGlobal
+	if pair.Filter.MinDurationSeconds > 0 || pair.Filter.MaxDurationSeconds > 0 {
+		f.minDuration, f.maxDuration, f.durSource = pair.Filter.MinDurationSeconds, pair.Filter.MaxDurationSeconds, SourcePair
+	}
+
+	return f
+}
+
+// WithDirRules 启用目录级 .stmignore 规则
+func (f *Filter) WithDirRules(rules *DirRules) *Filter {
+	f.dirRules = rules
+	return f
+}
+
+// checkIgnoreFile 检查 .stmignore 规则
+func (f *Filter) checkIgnoreFile(relPath string, isDir bool) (Decision, bool) {
+	if f.dirRules == nil {
+		return Decision{}, false
+	}
+	decision, matched := f.dirRules.CheckIgnored(f.root, relPath, isDir)
+	if !matched || decision.Accepted {
+		return Decision{}, false
+	}
+	return decision, true
+}
+
+// CheckDir 判断目录是否需要进入（relDir 相对于配对输入目录）
+func (f *Filter) CheckDir(relDir string) Decision {
+	relDir = filepath.ToSlash(relDir)
+	if relDir == "." || relDir == "" {
+		return accept("", "", "配对根目录")
+	}
+
+	name := filepath.Base(relDir)
+	if IsSystemDir(name, f.trashName) {
+		return reject("dir:"+name, SourceBuiltin, "系统目录")
+	}
+	if f.quarantine != "" && relDir == f.quarantine {
+		return reject("dir:"+name, SourceBuiltin, "源文件隔离区")
+	}
+
+	for _, p := range f.excludes {
+		if MatchDir(p.glob, relDir) {
+			return reject("exclude:"+p.glob, p.source, "目录命中排除规则")
+		}
+	}
+	if decision, ignored := f.checkIgnoreFile(relDir, true); ignored {
+		return decision
+	}
+	return accept("", "", "目录未命中排除规则")
+}
+
+// CheckFile 对文件执行路径与大小检查（relPath 相对于配对输入目录）
+func (f *Filter) CheckFile(relPath string, size int64) Decision {
+	relPath = filepath.ToSlash(relPath)
+	name := filepath.Base(relPath)
+
+	if IsSystemFile(name) {
+		return reject("file:"+name, SourceBuiltin, "系统/临时文件")
+	}
+
+	// 上级目录规则（直接检查文件时使用，扫描时已通过剪枝过滤）
+	if dir := filepath.Dir(relPath); dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			if d := f.CheckDir(strings.Join(parts[:i+1], "/")); !d.Accepted {
+				return d
+			}
+		}
+	}
+
+	for _, p := range f.excludes {
+		if Match(p.glob, relPath) {
+			return reject("exclude:"+p.glob, p.source, "命中排除规则")
+		}
+	}
+	if decision, ignored := f.checkIgnoreFile(relPath, false); ignored {
+		return decision
+	}
+
+	included := accept("", "", "未配置包含规则")
+	if len(f.includes) > 0 {
+		included = reject("include", f.includes[0].source, "未命中任何包含规则")
+		for _, p := range f.includes {
+			if Match(p.glob, relPath) {
+				included = accept("include:"+p.glob, p.source, "命中包含规则")
+				break
+			}
+		}
+		if !included.Accepted {
+			return included
+		}
+	}
+
+	if f.minSize > 0 && size < f.minSize {
+		return reject(fmt.Sprintf("min_size_mb:%d", f.minSize/1024/1024), f.sizeSource,
+			fmt.Sprintf("文件过小 (%.2f MB)", float64(size)/1024/1024))
+	}
+
+	return included
+}
+
+// NeedsDuration 是否配置了时长限制（需要 ffprobe）
+func (f *Filter) NeedsDuration() bool {
+	return f.minDuration > 0 || f.maxDuration > 0
+}
+
+// CheckDuration 检查视频时长（秒）
+func (f *Filter) CheckDuration(seconds float64) Decision {
+	if f.minDuration > 0 && seconds < float64(f.minDuration) {
+		return reject(fmt.Sprintf("min_duration_seconds:%d", f.minDuration), f.durSource,
+			fmt.Sprintf("时长过短 (%.0f 秒)", seconds))
+	}
+	if f.maxDuration > 0 && seconds > float64(f.maxDuration) {
+		return reject(fmt.Sprintf("max_duration_seconds:%d", f.maxDuration), f.durSource,
+			fmt.Sprintf("时长过长 (%.0f 秒)", seconds))
+	}
+	return accept("", "", "时长符合要求")
+}
+
+// IsSystemDir 内置规则：垃圾桶及 NAS 系统目录
+func IsSystemDir(name, trashName string) bool {
+	skipDirs := []string{
+		".stm_trash",      // 垃圾桶
+		".stm_quarantine", // 损坏输出隔离区
+		"@eaDir",          // 群晖索引
+		"#recycle",        // 群晖回收站
+		".DS_Store",       // macOS
+	}
+	if trashName != "" && name == filepath.Base(trashName) {
+		return true
+	}
+
+	for _, dir := range skipDirs {
+		if name == dir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSystemFile 内置规则：系统文件、隐藏文件与临时文件
+func IsSystemFile(name string) bool {
+	// 群晖缩略图/视频
+	if strings.HasPrefix(name, "SYNOPHOTO_") {
+		return true
+	}
+
+	// 隐藏文件
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	// 临时文件
+	if strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+		return true
+	}
+
+	// 转码中间文件
+	if strings.Contains(name, ".stm_tmp") {
+		return true
+	}
+
+	// 锁文件
+	if strings.HasSuffix(name, ".lock") {
+		return true
+	}
+
+	return false
+}
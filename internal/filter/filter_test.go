@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.mkv", "movie.mkv", true},
+		{"*.mkv", "a/b/movie.mkv", true},
+		{"/*.mkv", "a/movie.mkv", false},
+		{"Movies/*.mkv", "Movies/a.mkv", true},
+		{"Movies/*.mkv", "TV/Movies/a.mkv", false},
+		{"**/Sample/**", "a/Sample/x.mkv", true},
+		{"**/Sample/**", "Sample/x.mkv", true},
+		{"**/Sample/**", "a/Samples/x.mkv", false},
+		{"TV/**/*.mp4", "TV/show/s01/e01.mp4", true},
+		{"TV/**/*.mp4", "TV/e01.mp4", true},
+		{"TV/**/*.mp4", "Movies/e01.mp4", false},
+		{"SYNOPHOTO_*", "a/SYNOPHOTO_FILM.mp4", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.path, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.path); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDir(t *testing.T) {
+	if !MatchDir("**/@eaDir/**", "a/@eaDir") {
+		t.Error("**/@eaDir/** 应匹配目录 a/@eaDir")
+	}
+	if !MatchDir("Incoming/*", "Incoming") {
+		t.Error("Incoming/* 应匹配目录 Incoming")
+	}
+	if MatchDir("Incoming/*", "Movies") {
+		t.Error("Incoming/* 不应匹配目录 Movies")
+	}
+}
+
+func TestForPair(t *testing.T) {
+	cfg := &config.Config{
+		Path: config.PathConfig{Trash: ".stm_trash"},
+		FFmpeg: config.FFmpegConfig{
+			ExcludePatterns: []string{"*.part"},
+		},
+		Filter: config.FilterRules{
+			Exclude:   []string{"**/Sample/**"},
+			MinSizeMB: 1,
+		},
+	}
+	pair := config.InputOutputPair{
+		Input:  "/in",
+		Output: "/out",
+		Filter: config.FilterRules{
+			Include:            []string{"Movies/**"},
+			MaxDurationSeconds: 3600,
+		},
+	}
+	f := ForPair(cfg, pair)
+
+	tests := []struct {
+		path   string
+		size   int64
+		want   bool
+		source string
+	}{
+		{"Movies/a.mkv", 2 << 20, true, SourcePair},
+		{"TV/a.mkv", 2 << 20, false, SourcePair},
+		{"Movies/Sample/a.mkv", 2 << 20, false, SourceGlobal},
+		{"Movies/small.mkv", 1024, false, SourceGlobal},
+		{"Movies/.hidden.mkv", 2 << 20, false, SourceBuiltin},
+		{"Movies/.stm_trash/a.mkv", 2 << 20, false, SourceBuiltin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			d := f.CheckFile(tt.path, tt.size)
+			if d.Accepted != tt.want {
+				t.Errorf("CheckFile(%s) accepted = %v, want %v (%+v)", tt.path, d.Accepted, tt.want, d)
+			}
+			if d.Source != tt.source {
+				t.Errorf("CheckFile(%s) source = %s, want %s", tt.path, d.Source, tt.source)
+			}
+		})
+	}
+
+	if !f.NeedsDuration() {
+		t.Fatal("配置了时长限制时应需要探测时长")
+	}
+	if f.CheckDuration(7200).Accepted {
+		t.Error("超过最长时长应被拒绝")
+	}
+	if !f.CheckDuration(1800).Accepted {
+		t.Error("时长在范围内应被接受")
+	}
+}
+
+func TestDirRules(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Movies", "Extras"), 0755)
+	os.MkdirAll(filepath.Join(root, "TV"), 0755)
+
+	os.WriteFile(filepath.Join(root, IgnoreFileName), []byte("# 根目录规则\n*.avi\nExtras/\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Movies", IgnoreFileName), []byte("!keep.avi\n/local.mkv\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Movies", OverrideFileName), []byte("profile: film\npriority: 5\noutput_subdir: Films\n"), 0644)
+
+	rules := NewDirRules()
+	rules.NewGeneration()
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"TV/a.avi", false, true},
+		{"Movies/keep.avi", false, false},
+		{"Movies/other.avi", false, true},
+		{"Movies/Extras", true, true},
+		{"Movies/local.mkv", false, true},
+		{"Movies/sub/local.mkv", false, false},
+		{"TV/a.mkv", false, false},
+	}
+	for _, tt := range tests {
+		d, matched := rules.CheckIgnored(root, tt.path, tt.isDir)
+		if got := matched && !d.Accepted; got != tt.ignored {
+			t.Errorf("CheckIgnored(%s) ignored = %v, want %v (%+v)", tt.path, got, tt.ignored, d)
+		}
+	}
+
+	resolved := rules.Resolve(root, "/out", "Movies/2020/a.mkv")
+	if resolved.Profile != "film" || resolved.Priority != 5 {
+		t.Errorf("覆盖配置未生效: %+v", resolved)
+	}
+	if want := filepath.Join("/out", "Films", "2020", "a.mkv"); resolved.OutputBase != want {
+		t.Errorf("OutputBase = %s, want %s", resolved.OutputBase, want)
+	}
+	if other := rules.Resolve(root, "/out", "TV/a.mkv"); other.Profile != "" || other.OutputBase != "" {
+		t.Errorf("其他目录不应受影响: %+v", other)
+	}
+
+	// 修改文件后（mtime变化）在新一轮扫描中重新加载
+	later := time.Now().Add(time.Minute)
+	overridePath := filepath.Join(root, "Movies", OverrideFileName)
+	os.WriteFile(overridePath, []byte("priority: 1\n"), 0644)
+	os.Chtimes(overridePath, later, later)
+	rules.NewGeneration()
+	if resolved := rules.Resolve(root, "/out", "Movies/a.mkv"); resolved.Priority != 1 || resolved.Profile != "" {
+		t.Errorf("修改后的覆盖配置未重新加载: %+v", resolved)
+	}
+}
@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match 判断相对路径是否匹配 glob 模式（以 / 分隔）
+//
+// 支持的语法：
+//   - `*`、`?`、`[...]`：与 path.Match 一致，不跨越目录层级
+//   - `**`：匹配零个或多个目录层级
+//   - 以 `/` 开头的模式锚定到根目录（开头的 `/` 会被忽略）
+//   - 不包含 `/` 的模式匹配任意层级下的文件名（等价于 `**/pattern`）
+func Match(pattern, relPath string) bool {
+	pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+	if pattern == "" {
+		return false
+	}
+
+	if strings.HasPrefix(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// MatchDir 判断目录是否被模式整体覆盖（用于剪枝）
+// 除模式本身匹配外，`dir/*` 与 `dir/**` 也视为匹配目录 dir
+func MatchDir(pattern, relDir string) bool {
+	if Match(pattern, relDir) {
+		return true
+	}
+	trimmed := strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+	for _, suffix := range []string{"/**", "/*"} {
+		if strings.HasSuffix(trimmed, suffix) {
+			base := strings.TrimSuffix(trimmed, suffix)
+			if base != "" && Match(base, relDir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// 合并连续的 **
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], parts[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+	return len(parts) == 0
+}
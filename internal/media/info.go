@@ -0,0 +1,139 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info describes the container duration and stream layout of a media file.
+type Info struct {
+	Duration float64 `json:"duration"` // seconds, 0 if unknown
+	Video    int     `json:"video"`    // video streams, excluding attached pictures (cover art)
+	Audio    int     `json:"audio"`
+	Subtitle int     `json:"subtitle"`
+}
+
+// ProbeInfo reads duration and stream counts with a single ffprobe call.
+func ProbeInfo(path string, timeout time.Duration) (*Info, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type:stream_disposition=attached_pic",
+		"-of", "json",
+		path,
+	)
+
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("ffprobe超时(%s): %w", timeout, ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取媒体信息失败: %w", err)
+	}
+	return parseProbeInfo(output)
+}
+
+func parseProbeInfo(data []byte) (*Info, error) {
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("解析媒体信息失败: %w", err)
+	}
+
+	info := &Info{}
+	if d := strings.TrimSpace(probe.Format.Duration); d != "" && d != "N/A" {
+		info.Duration, _ = strconv.ParseFloat(d, 64)
+	}
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if stream.Disposition.AttachedPic == 0 {
+				info.Video++
+			}
+		case "audio":
+			info.Audio++
+		case "subtitle":
+			info.Subtitle++
+		}
+	}
+	return info, nil
+}
+
+// Expectation is what a transcoded output should contain.
+type Expectation struct {
+	Duration      float64 // source duration in seconds, 0 skips the duration check
+	Tolerance     float64 // allowed duration difference in seconds
+	Video         int
+	Audio         int
+	Subtitle      int
+	CheckSubtitle bool // subtitle handling left to ffmpeg defaults is not checked
+}
+
+// ErrParity marks an output whose duration or streams differ from the expectation.
+var ErrParity = errors.New("输出一致性检查失败")
+
+// CheckParity compares an output against the expectation and returns an error wrapping ErrParity on mismatch.
+func (i *Info) CheckParity(exp Expectation) error {
+	var problems []string
+
+	if exp.Duration > 0 {
+		if i.Duration <= 0 {
+			problems = append(problems, "无法读取输出时长")
+		} else if diff := math.Abs(i.Duration - exp.Duration); diff > exp.Tolerance {
+			problems = append(problems, fmt.Sprintf("时长 %.1fs，源文件 %.1fs（允许误差 %.1fs）",
+				i.Duration, exp.Duration, exp.Tolerance))
+		}
+	}
+	if i.Video != exp.Video {
+		problems = append(problems, fmt.Sprintf("视频流 %d，应为 %d", i.Video, exp.Video))
+	}
+	if i.Audio != exp.Audio {
+		problems = append(problems, fmt.Sprintf("音频流 %d，应为 %d", i.Audio, exp.Audio))
+	}
+	if exp.CheckSubtitle && i.Subtitle != exp.Subtitle {
+		problems = append(problems, fmt.Sprintf("字幕流 %d，应为 %d", i.Subtitle, exp.Subtitle))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrParity, strings.Join(problems, "; "))
+}
+
+// DecodeFull decodes the whole file and fails on any decoder error.
+func DecodeFull(path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-xerror", "-i", path, "-f", "null", "-")
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("完整解码超时(%s): %w", timeout, ctx.Err())
+	}
+	if err != nil {
+		errMsg := strings.TrimSpace(string(output))
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		return fmt.Errorf("完整解码失败: %s", errMsg[:min(500, len(errMsg))])
+	}
+	return nil
+}
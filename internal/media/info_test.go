@@ -0,0 +1,29 @@
+package media
+
+import "testing"
+
+func TestParseProbeInfo(t *testing.T) {
+	data := []byte(`{
+		"streams": [
+			{"codec_type": "video", "disposition": {"attached_pic": 0}},
+			{"codec_type": "video", "disposition": {"attached_pic": 1}},
+			{"codec_type": "audio"},
+			{"codec_type": "audio"},
+			{"codec_type": "subtitle"}
+		],
+		"format": {"duration": "1234.560000"}
+	}`)
+
+	info, err := parseProbeInfo(data)
+	if err != nil {
+		t.Fatalf("parseProbeInfo() error = %v", err)
+	}
+	if info.Duration != 1234.56 || info.Video != 1 || info.Audio != 2 || info.Subtitle != 1 {
+		t.Errorf("parseProbeInfo() = %+v", info)
+	}
+
+	info, err = parseProbeInfo([]byte(`{"format": {"duration": "N/A"}}`))
+	if err != nil || info.Duration != 0 {
+		t.Errorf("unknown duration should be 0: %+v, %v", info, err)
+	}
+}
@@ -41,6 +41,29 @@ func ProbeFile(path string, timeout time.Duration, decodeSeconds int) error {
 	return decodeSegment(path, timeout, 0, decodeSeconds, "文件解码测试失败 (文件损坏或格式不支持)", false)
 }
 
+// ProbeDuration returns the container duration in seconds.
+func ProbeDuration(path string, timeout time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return 0, fmt.Errorf("ffprobe超时(%s): %w", timeout, ctx.Err())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -154,3 +177,27 @@ func isDecodeErrorLine(line string) bool {
 	}
 	return false
 }
+
+// ProbeReport returns the full ffprobe output (format, streams and errors) for diagnostics.
+// The output is returned even when ffprobe fails, since the error lines are what matter for broken files.
+func ProbeReport(path string, timeout time.Duration) string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		path,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("ffprobe超时(%s)", timeout)
+	}
+	if err != nil && len(output) == 0 {
+		return err.Error()
+	}
+	return string(output)
+}
@@ -0,0 +1,115 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Remux copies all streams into a fresh Matroska container, rebuilding the index.
+// With genpts set, missing or broken timestamps are regenerated as well.
+func Remux(src, dst string, timeout time.Duration, genpts bool) error {
+	args := []string{"-y", "-v", "error", "-err_detect", "ignore_err"}
+	if genpts {
+		args = append(args, "-fflags", "+genpts+igndts+discardcorrupt")
+	}
+	args = append(args,
+		"-i", src,
+		"-map", "0:v?", "-map", "0:a?", "-map", "0:s?",
+		"-c", "copy",
+		"-f", "matroska",
+		dst,
+	)
+	return runFFmpeg(timeout, "重新封装失败", args...)
+}
+
+// SalvageSegments copies the source in fixed-length segments, skips the ones that
+// cannot be read and joins the rest. segmentTimeout bounds each segment copy and
+// probe; joinTimeout bounds the final concat, which rewrites the whole file.
+// It returns the number of seconds dropped.
+func SalvageSegments(src, dst string, duration float64, segmentSeconds int, segmentTimeout, joinTimeout time.Duration) (float64, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("源文件时长未知，无法分段抢救")
+	}
+	if segmentSeconds <= 0 {
+		segmentSeconds = 30
+	}
+
+	workDir := dst + ".segments"
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(workDir)
+
+	var list strings.Builder
+	lost, kept := 0.0, 0
+	for i, start := 0, 0.0; start < duration; i, start = i+1, start+float64(segmentSeconds) {
+		length := math.Min(float64(segmentSeconds), duration-start)
+		segment := filepath.Join(workDir, fmt.Sprintf("%05d.mkv", i))
+
+		err := runFFmpeg(segmentTimeout, "分段复制失败",
+			"-y", "-v", "error", "-err_detect", "ignore_err",
+			"-fflags", "+genpts+discardcorrupt",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-i", src,
+			"-t", strconv.FormatFloat(length, 'f', 3, 64),
+			"-map", "0:v?", "-map", "0:a?",
+			"-c", "copy",
+			"-avoid_negative_ts", "make_zero",
+			"-f", "matroska",
+			segment,
+		)
+		if err == nil {
+			err = ProbeFile(segment, segmentTimeout, 1)
+		}
+		if err != nil {
+			lost += length
+			continue
+		}
+
+		kept++
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(segment, "'", `'\''`))
+	}
+	if kept == 0 {
+		return lost, fmt.Errorf("所有分段均无法读取")
+	}
+
+	listPath := filepath.Join(workDir, "list.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return lost, err
+	}
+	err := runFFmpeg(joinTimeout, "合并分段失败",
+		"-y", "-v", "error",
+		"-f", "concat", "-safe", "0",
+		"-i", listPath,
+		"-c", "copy",
+		"-f", "matroska",
+		dst,
+	)
+	return lost, err
+}
+
+func runFFmpeg(timeout time.Duration, reason string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: 超时(%s): %w", reason, timeout, ctx.Err())
+	}
+	if err != nil {
+		errMsg := strings.TrimSpace(string(output))
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		return fmt.Errorf("%s: %s", reason, errMsg[:min(500, len(errMsg))])
+	}
+	return nil
+}
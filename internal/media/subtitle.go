@@ -0,0 +1,26 @@
+package media
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IsSubtitle reports whether the path has an external text subtitle extension.
+func IsSubtitle(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt", ".ass", ".ssa", ".vtt":
+		return true
+	}
+	return false
+}
+
+// ConvertSubtitle converts an external subtitle file; the target format is
+// taken from the extension of dst.
+func ConvertSubtitle(src, dst string, timeout time.Duration) error {
+	return runFFmpeg(timeout, "字幕转换失败",
+		"-y", "-v", "error",
+		"-i", src,
+		dst,
+	)
+}
@@ -64,6 +64,18 @@ var (
 		Help: "Total number of files permanently deleted",
 	})
 
+	// TempFilesSwept 删除的残留转码临时文件数
+	TempFilesSwept = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stm_temp_files_swept_total",
+		Help: "Total number of stale transcode temp files removed",
+	})
+
+	// TempBytesReclaimed 删除残留临时文件释放的空间（字节）
+	TempBytesReclaimed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stm_temp_bytes_reclaimed_total",
+		Help: "Total bytes reclaimed by removing stale transcode temp files",
+	})
+
 	// DiskSpaceAvailable 可用磁盘空间（字节）
 	DiskSpaceAvailable = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "stm_disk_space_available_bytes",
@@ -78,6 +90,33 @@ var (
 		},
 		[]string{"version", "mode"},
 	)
+
+	// ScanDuration 最近一次扫描各配对的耗时（秒）
+	ScanDuration = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stm_scan_duration_seconds",
+			Help: "Duration of the last scan per input directory",
+		},
+		[]string{"pair"},
+	)
+
+	// ScanFiles 最近一次扫描各配对遍历的视频文件数
+	ScanFiles = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stm_scan_files",
+			Help: "Number of video files seen in the last scan per input directory",
+		},
+		[]string{"pair"},
+	)
+
+	// ScanThroughput 最近一次扫描各配对的吞吐量（文件/秒）
+	ScanThroughput = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stm_scan_files_per_second",
+			Help: "Scan throughput of the last scan per input directory",
+		},
+		[]string{"pair"},
+	)
 )
 
 // UpdateTaskStats 更新任务统计
@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// adoption 收养模式下新文件已有的输出
+type adoption struct {
+	outputPath string
+	size       int64
+}
+
+// checkAdoptable 检查新文件在映射路径上是否已有输出，且输出可读、时长与流数量与源文件一致
+// 未通过时返回 nil，文件按普通新文件排队转码
+func (s *Scanner) checkAdoptable(entry *scanEntry) *adoption {
+	outputPath := s.config.ExistingOutputPath(entry.fullPath, entry.overrides.OutputBase)
+	if outputPath == "" {
+		return nil
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+
+	probeTimeout := time.Duration(s.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	if err := media.ProbeFile(outputPath, probeTimeout, 0); err != nil {
+		log.Printf("[Scanner] 已有输出无法读取，按新文件转码 %s: %v", outputPath, err)
+		return nil
+	}
+	sourceInfo, err := media.ProbeInfo(entry.fullPath, probeTimeout)
+	if err != nil {
+		log.Printf("[Scanner] 读取源文件信息失败，无法校验已有输出 %s: %v", entry.fullPath, err)
+		return nil
+	}
+	outputInfo, err := media.ProbeInfo(outputPath, probeTimeout)
+	if err != nil {
+		log.Printf("[Scanner] 读取已有输出信息失败，按新文件转码 %s: %v", outputPath, err)
+		return nil
+	}
+	encode, _ := s.config.ResolveProfile(entry.overrides.Profile)
+	if err := outputInfo.CheckParity(s.config.Expectation(encode, sourceInfo)); err != nil {
+		log.Printf("[Scanner] 已有输出与源文件不一致，按新文件转码 %s: %v", outputPath, err)
+		return nil
+	}
+	return &adoption{outputPath: outputPath, size: info.Size()}
+}
+
+// adoptTask 为已有输出的新文件直接创建已完成的任务，并在日志中记录输出来源
+func (s *Scanner) adoptTask(store taskStore, task *database.Task, adopted *adoption) string {
+	task.OutputSize = adopted.size
+	note := "收养已有输出（未转码）: " + adopted.outputPath
+	if err := store.CreateAdoptedTask(task, note, false); err != nil {
+		log.Printf("[Scanner] 收养已有输出失败 %s: %v", task.SourcePath, err)
+		return "error"
+	}
+	log.Printf("[Scanner] 已有输出通过校验，直接记为已完成: %s -> %s (%.2f MB)",
+		task.SourcePath, adopted.outputPath, float64(adopted.size)/1024/1024)
+	return "adopted"
+}
@@ -0,0 +1,277 @@
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/filter"
+)
+
+// defaultOutputRatio 没有历史转码记录时估算输出大小使用的压缩比
+const defaultOutputRatio = 0.5
+
+// 试运行中文件的处理结果
+const (
+	DryRunNew      = "new"      // 将新建任务
+	DryRunSettling = "settling" // 将新建任务并等待文件稳定后入队
+	DryRunRenamed  = "renamed"  // 已有任务的源文件被重命名或移动，将沿用原任务和输出
+	DryRunUpdate   = "update"   // 源文件已变化或输出丢失，将重新转码
+	DryRunSkip     = "skip"     // 已有任务，无需处理
+	DryRunExcluded = "excluded" // 被过滤规则排除
+)
+
+// DryRunItem 试运行中单个文件的结果
+type DryRunItem struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Size   int64  `json:"size"`
+	Rule   string `json:"rule,omitempty"`   // 排除时命中的规则
+	Reason string `json:"reason,omitempty"` // 判定原因
+}
+
+// DryRunReport 试运行扫描报告
+type DryRunReport struct {
+	Path       string    `json:"path"`
+	Pair       string    `json:"pair"`       // 所属配对，未配置的目录为空
+	Configured bool      `json:"configured"` // 目录是否已在监控配对中
+	StartedAt  time.Time `json:"started_at"`
+	Duration   float64   `json:"duration_seconds"`
+
+	New      int `json:"new"`
+	Settling int `json:"settling"` // 新文件，等待稳定后入队（计入待转码）
+	Renamed  int `json:"renamed"`  // 重命名的文件，沿用已有任务（不计入待转码）
+	Update   int `json:"update"`
+	Skip     int `json:"skip"`
+	Excluded int `json:"excluded"`
+
+	SourceBytes          int64   `json:"source_bytes"`           // 所有未排除视频文件的大小
+	PendingBytes         int64   `json:"pending_bytes"`          // 需要转码（新建、等待稳定、更新）的源文件大小
+	EstimatedOutputBytes int64   `json:"estimated_output_bytes"` // 需要转码部分的预计输出大小
+	OutputRatio          float64 `json:"output_ratio"`           // 估算使用的输出/源文件大小比例
+	RatioSamples         int     `json:"ratio_samples"`          // 比例依据的已完成任务数，0 表示使用默认值
+
+	Items []DryRunItem `json:"items"`
+}
+
+// DryRun 试运行扫描：遍历目录并给出扫描将执行的操作，不写入数据库
+// path 可以是已配置配对内的目录，也可以是准备添加的新目录（使用全局过滤规则）
+func (s *Scanner) DryRun(ctx context.Context, path string) (*DryRunReport, error) {
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("访问目录失败: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("不是目录: %s", path)
+	}
+
+	report := &DryRunReport{Path: path, StartedAt: time.Now()}
+	pair, _, ok := s.config.FindPair(path)
+	if ok {
+		report.Pair = pair.Input
+		report.Configured = true
+	} else {
+		pair = config.InputOutputPair{Input: path}
+	}
+
+	s.dirRules.NewGeneration()
+	rules := filter.ForPair(s.config, pair).WithDirRules(s.dirRules)
+	if err := checkRootRules(rules, pair, path); err != nil {
+		return nil, err
+	}
+
+	// 没有数据库时（命令行试运行且数据库尚未创建）所有文件按新文件处理
+	index := make(map[string]*database.Task)
+	if s.db != nil {
+		if index, err = s.loadIndex(path); err != nil {
+			return nil, fmt.Errorf("加载任务索引失败: %w", err)
+		}
+	}
+
+	var mu sync.Mutex
+	add := func(item DryRunItem) {
+		mu.Lock()
+		report.Items = append(report.Items, item)
+		mu.Unlock()
+	}
+
+	err = walkParallel(ctx, path, s.walkWorkers(), func(dir string) []string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("[Scanner] 试运行访问路径失败 %s: %v", dir, err)
+			return nil
+		}
+
+		var subdirs []string
+		for _, d := range entries {
+			fullPath := filepath.Join(dir, d.Name())
+			relPath, err := filepath.Rel(pair.Input, fullPath)
+			if err != nil {
+				continue
+			}
+			if d.IsDir() {
+				decision := rules.CheckDir(relPath)
+				if decision.Accepted {
+					subdirs = append(subdirs, fullPath)
+				} else if decision.Source != filter.SourceBuiltin {
+					// 垃圾桶、隔离区等系统目录不是待扫描的内容，其余被排除的目录列出其中的视频文件
+					for _, item := range s.dryRunExcludedDir(fullPath, relPath, decision) {
+						add(item)
+					}
+				}
+				continue
+			}
+			if !s.config.IsVideoFile(fullPath) {
+				continue
+			}
+			fi, err := d.Info()
+			if err != nil {
+				log.Printf("[Scanner] 获取文件信息失败 %s: %v", fullPath, err)
+				continue
+			}
+			add(s.dryRunFile(fullPath, relPath, fi, rules, index[fullPath]))
+		}
+		return subdirs
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool { return report.Items[i].Path < report.Items[j].Path })
+	for _, item := range report.Items {
+		switch item.Action {
+		case DryRunNew:
+			report.New++
+			report.PendingBytes += item.Size
+		case DryRunSettling:
+			report.Settling++
+			report.PendingBytes += item.Size
+		case DryRunRenamed:
+			report.Renamed++
+		case DryRunUpdate:
+			report.Update++
+			report.PendingBytes += item.Size
+		case DryRunSkip:
+			report.Skip++
+		case DryRunExcluded:
+			report.Excluded++
+			continue
+		}
+		report.SourceBytes += item.Size
+	}
+
+	report.OutputRatio, report.RatioSamples = defaultOutputRatio, 0
+	if s.db != nil {
+		if ratio, samples, err := s.db.GetOutputRatio(); err != nil {
+			log.Printf("[Scanner] 查询历史压缩比失败，使用默认值: %v", err)
+		} else if samples > 0 {
+			report.OutputRatio, report.RatioSamples = ratio, samples
+		}
+	}
+	report.EstimatedOutputBytes = int64(float64(report.PendingBytes) * report.OutputRatio)
+	report.Duration = time.Since(report.StartedAt).Seconds()
+
+	log.Printf("[Scanner] 试运行完成 %s: 新增 %d, 等待稳定 %d, 重命名 %d, 更新 %d, 跳过 %d, 排除 %d, 待转码 %.2f GB, 预计输出 %.2f GB",
+		path, report.New, report.Settling, report.Renamed, report.Update, report.Skip, report.Excluded,
+		float64(report.PendingBytes)/1024/1024/1024, float64(report.EstimatedOutputBytes)/1024/1024/1024)
+	return report, nil
+}
+
+// dryRunFile 判定单个文件在实际扫描中的处理结果（与 processFile 的判定一致，但不写入）
+func (s *Scanner) dryRunFile(path, relPath string, info os.FileInfo, rules *filter.Filter, task *database.Task) DryRunItem {
+	item := DryRunItem{Path: path, Size: info.Size()}
+
+	if decision := rules.CheckFile(relPath, info.Size()); !decision.Accepted {
+		item.Action, item.Rule, item.Reason = DryRunExcluded, decision.Rule, decision.Reason
+		return item
+	}
+
+	if task == nil {
+		if decision, ok := s.checkDuration(path, info.Size(), info.ModTime(), rules); !ok {
+			item.Action, item.Rule, item.Reason = DryRunExcluded, decision.Rule, decision.Reason
+			return item
+		}
+		// 与扫描一致：先检测重命名，再按稳定性设置进入观察期
+		if s.db != nil {
+			renamed, err := findRenamed(s.db, path, info.Size(), info.ModTime(), "")
+			if err != nil {
+				log.Printf("[Scanner] 试运行重命名检测失败 %s: %v", path, err)
+			} else if renamed != nil {
+				if renamed.Status == database.StatusProcessing {
+					item.Action, item.Reason = DryRunSkip, "重命名的任务正在转码: "+renamed.SourcePath
+				} else {
+					item.Action, item.Reason = DryRunRenamed, "重命名自: "+renamed.SourcePath
+				}
+				return item
+			}
+		}
+		if s.config.Scanner.StabilityEnabled() {
+			item.Action, item.Reason = DryRunSettling, "新文件，等待稳定后入队"
+			return item
+		}
+		item.Action, item.Reason = DryRunNew, "新文件"
+		return item
+	}
+
+	if task.Status == database.StatusSettling {
+		item.Action, item.Reason = DryRunSkip, "等待文件稳定"
+		return item
+	}
+	if !task.SourceMtime.Equal(info.ModTime()) || task.SourceSize != info.Size() {
+		item.Action, item.Reason = DryRunUpdate, "源文件已变化"
+		return item
+	}
+	if task.Status == database.StatusCompleted && s.config.ExistingOutputPath(path, task.OutputPath) == "" {
+		item.Action, item.Reason = DryRunUpdate, "输出文件丢失"
+		return item
+	}
+
+	item.Action, item.Reason = DryRunSkip, "已有任务: "+string(task.Status)
+	return item
+}
+
+// dryRunExcludedDir 列出被排除目录下的视频文件，均记为命中该目录的规则
+func (s *Scanner) dryRunExcludedDir(dir, relDir string, decision filter.Decision) []DryRunItem {
+	var items []DryRunItem
+	reason := fmt.Sprintf("%s: %s", decision.Reason, filepath.ToSlash(relDir))
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !s.config.IsVideoFile(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		items = append(items, DryRunItem{Path: path, Action: DryRunExcluded, Size: info.Size(), Rule: decision.Rule, Reason: reason})
+		return nil
+	})
+	return items
+}
+
+// WriteCSV 将文件列表写为 CSV
+func (r *DryRunReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"path", "action", "size", "rule", "reason"}); err != nil {
+		return err
+	}
+	for _, item := range r.Items {
+		record := []string{item.Path, item.Action, strconv.FormatInt(item.Size, 10), item.Rule, item.Reason}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationCache 因时长被排除的文件的探测结果，按路径、大小和 mtime 命中
+// 排除的文件不会创建任务，没有缓存时每次完整扫描（及目录变化后的增量扫描）都要重新 ffprobe
+type durationCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedDuration
+}
+
+type cachedDuration struct {
+	size     int64
+	mtime    time.Time
+	duration float64
+}
+
+func newDurationCache() *durationCache {
+	return &durationCache{entries: make(map[string]cachedDuration)}
+}
+
+// get 返回文件未变化时缓存的时长；文件已变化的记录直接丢弃
+func (c *durationCache) get(path string, size int64, mtime time.Time) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok {
+		return 0, false
+	}
+	if entry.size != size || !entry.mtime.Equal(mtime) {
+		delete(c.entries, path)
+		return 0, false
+	}
+	return entry.duration, true
+}
+
+func (c *durationCache) put(path string, size int64, mtime time.Time, duration float64) {
+	c.mu.Lock()
+	c.entries[path] = cachedDuration{size: size, mtime: mtime, duration: duration}
+	c.mu.Unlock()
+}
+
+func (c *durationCache) remove(path string) {
+	c.mu.Lock()
+	delete(c.entries, path)
+	c.mu.Unlock()
+}
+
+// prune 删除扫描目录下本次未见到的文件的记录（文件已删除、移走或已不再是视频文件）
+// 增量扫描中未读取的目录内的记录保留
+func (c *durationCache) prune(root string, seen, unchanged map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.entries {
+		if rel, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		if _, ok := unchanged[filepath.Dir(path)]; ok {
+			continue
+		}
+		delete(c.entries, path)
+	}
+}
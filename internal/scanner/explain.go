@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/filter"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// FilterExplanation 路径过滤判定说明
+type FilterExplanation struct {
+	Path     string            `json:"path"`
+	Pair     string            `json:"pair"`
+	RelPath  string            `json:"rel_path"`
+	Exists   bool              `json:"exists"`
+	Accepted bool              `json:"accepted"`
+	Decision filter.Decision   `json:"decision"` // 最终起决定作用的规则
+	Checks   []filter.Decision `json:"checks"`   // 依次执行的检查
+}
+
+// ExplainPath 说明某个路径会被哪条规则接受或拒绝（不修改数据库）
+func (s *Scanner) ExplainPath(path string) (*FilterExplanation, error) {
+	path = filepath.Clean(path)
+	pair, relPath, ok := s.config.FindPair(path)
+	if !ok {
+		return nil, fmt.Errorf("路径不属于任何监控目录: %s", path)
+	}
+
+	s.dirRules.NewGeneration()
+	rules := filter.ForPair(s.config, pair).WithDirRules(s.dirRules)
+	result := &FilterExplanation{Path: path, Pair: pair.Input, RelPath: relPath}
+
+	finish := func(d filter.Decision) *FilterExplanation {
+		result.Checks = append(result.Checks, d)
+		result.Decision = d
+		result.Accepted = d.Accepted
+		return result
+	}
+
+	var size int64
+	info, err := os.Stat(path)
+	if err == nil {
+		result.Exists = true
+		size = info.Size()
+		if info.IsDir() {
+			return finish(rules.CheckDir(relPath)), nil
+		}
+	}
+
+	if !s.config.IsVideoFile(path) {
+		return finish(filter.Decision{Rule: "extensions", Source: filter.SourceGlobal, Reason: "不是支持的视频格式"}), nil
+	}
+	result.Checks = append(result.Checks, filter.Decision{Accepted: true, Rule: "extensions", Source: filter.SourceGlobal, Reason: "支持的视频格式"})
+
+	decision := rules.CheckFile(relPath, size)
+	if !decision.Accepted || !rules.NeedsDuration() {
+		return finish(decision), nil
+	}
+	result.Checks = append(result.Checks, decision)
+
+	if !result.Exists {
+		return finish(filter.Decision{Accepted: true, Reason: "文件不存在，无法检查时长"}), nil
+	}
+	probeTimeout := time.Duration(s.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	duration, err := media.ProbeDuration(path, probeTimeout)
+	if err != nil {
+		return finish(filter.Decision{Accepted: true, Reason: fmt.Sprintf("获取时长失败，扫描时将放行: %v", err)}), nil
+	}
+	return finish(rules.CheckDuration(duration)), nil
+}
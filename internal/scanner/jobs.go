@@ -0,0 +1,420 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+)
+
+// ScanJobStatus 扫描任务状态
+type ScanJobStatus string
+
+const (
+	ScanJobQueued    ScanJobStatus = "queued"    // 等待同批次前面的配对扫描完成
+	ScanJobRunning   ScanJobStatus = "running"   // 扫描中
+	ScanJobCompleted ScanJobStatus = "completed" // 已完成
+	ScanJobCancelled ScanJobStatus = "cancelled" // 已取消
+	ScanJobFailed    ScanJobStatus = "failed"    // 失败
+)
+
+// 扫描任务触发方式
+const (
+	TriggerScheduled = "scheduled" // 周期扫描
+	TriggerManual    = "manual"    // 手动触发（API）
+)
+
+// maxFinishedScanJobs 保留的已结束扫描任务数
+const maxFinishedScanJobs = 50
+
+var (
+	// ErrScanJobNotFound 扫描任务不存在
+	ErrScanJobNotFound = errors.New("扫描任务不存在")
+	// ErrScanJobFinished 扫描任务已结束，无法取消
+	ErrScanJobFinished = errors.New("扫描任务已结束")
+)
+
+// ScanCounts 扫描结果计数
+type ScanCounts struct {
+	New      int `json:"new"`
+	Update   int `json:"update"`
+	Skip     int `json:"skip"`
+	Settling int `json:"settling"`
+	Excluded int `json:"excluded"`
+	Renamed  int `json:"renamed"`
+	Adopted  int `json:"adopted"` // 收养模式下直接记为已完成
+	Errors   int `json:"errors"`
+}
+
+func (c *ScanCounts) add(other ScanCounts) {
+	c.New += other.New
+	c.Update += other.Update
+	c.Skip += other.Skip
+	c.Settling += other.Settling
+	c.Excluded += other.Excluded
+	c.Renamed += other.Renamed
+	c.Adopted += other.Adopted
+	c.Errors += other.Errors
+}
+
+// record 按 processFile 返回的动作计数
+func (c *ScanCounts) record(action string) {
+	switch action {
+	case "new":
+		c.New++
+	case "update":
+		c.Update++
+	case "skip":
+		c.Skip++
+	case "settling":
+		c.Settling++
+	case "excluded":
+		c.Excluded++
+	case "renamed":
+		c.Renamed++
+	case "adopted":
+		c.Adopted++
+	case "error":
+		c.Errors++
+	}
+}
+
+// ScanJobInfo 扫描任务快照（用于 API 输出）
+type ScanJobInfo struct {
+	ID          int64         `json:"id"`
+	Pair        string        `json:"pair"`           // 配对输入目录
+	Path        string        `json:"path,omitempty"` // 扫描的子目录，为空表示整个配对
+	Deep        bool          `json:"deep"`
+	Adopt       bool          `json:"adopt"` // 收养模式
+	Trigger     string        `json:"trigger"`
+	Status      ScanJobStatus `json:"status"`
+	CurrentDir  string        `json:"current_dir,omitempty"`
+	Dirs        int           `json:"dirs"`  // 已处理目录数
+	Files       int           `json:"files"` // 已处理视频文件数
+	Counts      ScanCounts    `json:"counts"`
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at"`
+	FinishedAt  *time.Time    `json:"finished_at"`
+	DurationSec float64       `json:"duration_seconds"`
+}
+
+// ScanJob 单个配对（或子目录）的一次扫描
+type ScanJob struct {
+	mu     sync.Mutex
+	info   ScanJobInfo
+	pair   config.InputOutputPair
+	root   string // 遍历起点：配对输入目录或其子目录
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Info 返回任务快照
+func (j *ScanJob) Info() ScanJobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := j.info
+	if info.StartedAt != nil {
+		end := time.Now()
+		if info.FinishedAt != nil {
+			end = *info.FinishedAt
+		}
+		info.DurationSec = end.Sub(*info.StartedAt).Seconds()
+	}
+	return info
+}
+
+func (j *ScanJob) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.info.Status = ScanJobRunning
+	j.info.StartedAt = &now
+}
+
+func (j *ScanJob) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.info.FinishedAt = &now
+	j.info.CurrentDir = ""
+	switch {
+	case j.ctx.Err() != nil:
+		j.info.Status = ScanJobCancelled
+	case err != nil:
+		j.info.Status = ScanJobFailed
+		j.info.Error = err.Error()
+	default:
+		j.info.Status = ScanJobCompleted
+	}
+}
+
+func (j *ScanJob) enterDir(dir string) {
+	j.mu.Lock()
+	j.info.CurrentDir = dir
+	j.info.Dirs++
+	j.mu.Unlock()
+}
+
+func (j *ScanJob) record(action string, excluded bool) {
+	j.mu.Lock()
+	j.info.Files++
+	if excluded {
+		j.info.Counts.Excluded++
+	} else {
+		j.info.Counts.record(action)
+	}
+	j.mu.Unlock()
+}
+
+func (j *ScanJob) counts() ScanCounts {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info.Counts
+}
+
+// jobRegistry 扫描任务登记，每个配对同时只允许一个进行中的任务
+type jobRegistry struct {
+	mu     sync.Mutex
+	ctx    context.Context // 应用上下文，关闭时所有任务随之取消
+	nextID int64
+	jobs   []*ScanJob
+	active map[string]*ScanJob // 配对输入目录 → 未结束的任务
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{ctx: context.Background(), active: make(map[string]*ScanJob)}
+}
+
+// setContext 设置应用上下文，并在其取消时取消所有未结束的任务
+func (r *jobRegistry) setContext(ctx context.Context) {
+	r.mu.Lock()
+	r.ctx = ctx
+	r.mu.Unlock()
+	context.AfterFunc(ctx, r.cancelAll)
+}
+
+// context 返回应用上下文
+func (r *jobRegistry) context() context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ctx
+}
+
+// cancelAll 取消所有排队中和进行中的任务
+func (r *jobRegistry) cancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.active {
+		job.cancel()
+	}
+}
+
+// acquire 为配对登记新任务；该配对已有未结束的任务时返回该任务
+func (r *jobRegistry) acquire(pair config.InputOutputPair, root string, deep bool, trigger string) (*ScanJob, *ScanJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if busy := r.active[pair.Input]; busy != nil {
+		return nil, busy
+	}
+
+	r.nextID++
+	ctx, cancel := context.WithCancel(r.ctx)
+	job := &ScanJob{
+		pair:   pair,
+		root:   root,
+		ctx:    ctx,
+		cancel: cancel,
+		info: ScanJobInfo{
+			ID:        r.nextID,
+			Pair:      pair.Input,
+			Deep:      deep,
+			Trigger:   trigger,
+			Status:    ScanJobQueued,
+			CreatedAt: time.Now(),
+		},
+	}
+	if root != pair.Input {
+		job.info.Path = root
+	}
+
+	r.active[pair.Input] = job
+	r.jobs = append(r.jobs, job)
+	r.prune()
+	return job, nil
+}
+
+// release 任务结束后释放配对
+func (r *jobRegistry) release(job *ScanJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active[job.pair.Input] == job {
+		delete(r.active, job.pair.Input)
+	}
+	job.cancel()
+}
+
+// prune 只保留最近的已结束任务
+func (r *jobRegistry) prune() {
+	finished := 0
+	for _, job := range r.jobs {
+		if r.active[job.pair.Input] != job {
+			finished++
+		}
+	}
+	if finished <= maxFinishedScanJobs {
+		return
+	}
+
+	kept := r.jobs[:0]
+	for _, job := range r.jobs {
+		if finished > maxFinishedScanJobs && r.active[job.pair.Input] != job {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	r.jobs = kept
+}
+
+func (r *jobRegistry) list() []*ScanJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]*ScanJob, len(r.jobs))
+	copy(jobs, r.jobs)
+	return jobs
+}
+
+func (r *jobRegistry) get(id int64) *ScanJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.info.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// ListScanJobs 列出扫描任务（最新的在前）
+func (s *Scanner) ListScanJobs() []ScanJobInfo {
+	jobs := s.jobs.list()
+	infos := make([]ScanJobInfo, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		infos = append(infos, jobs[i].Info())
+	}
+	return infos
+}
+
+// GetScanJob 查询扫描任务
+func (s *Scanner) GetScanJob(id int64) (ScanJobInfo, bool) {
+	job := s.jobs.get(id)
+	if job == nil {
+		return ScanJobInfo{}, false
+	}
+	return job.Info(), true
+}
+
+// CancelScanJob 取消排队中或进行中的扫描任务
+func (s *Scanner) CancelScanJob(id int64) error {
+	job := s.jobs.get(id)
+	if job == nil {
+		return ErrScanJobNotFound
+	}
+
+	info := job.Info()
+	if info.FinishedAt != nil {
+		return ErrScanJobFinished
+	}
+	job.cancel()
+	return nil
+}
+
+// SetContext 设置应用上下文（服务启动时调用），关闭时取消所有扫描任务，后台启动的扫描也在该上下文中运行
+func (s *Scanner) SetContext(ctx context.Context) {
+	s.jobs.setContext(ctx)
+}
+
+// StartScan 在后台启动扫描，返回新建的任务和因配对正在扫描而跳过的任务
+func (s *Scanner) StartScan(opts ScanOptions) (started, busy []ScanJobInfo, err error) {
+	jobs, busyJobs, deep, err := s.prepareJobs(opts, TriggerManual)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, job := range jobs {
+		started = append(started, job.Info())
+	}
+	for _, job := range busyJobs {
+		busy = append(busy, job.Info())
+	}
+
+	if len(jobs) > 0 {
+		// 使用应用上下文：服务关闭时手动扫描也随之停止，不会在数据库关闭后继续写入
+		go s.runJobs(s.jobs.context(), jobs, opts, deep)
+	}
+	return started, busy, nil
+}
+
+// scanTarget 一次扫描涉及的配对与遍历起点
+type scanTarget struct {
+	pair config.InputOutputPair
+	root string
+}
+
+// resolveTargets 根据选项确定要扫描的配对和目录
+func (s *Scanner) resolveTargets(opts ScanOptions) ([]scanTarget, error) {
+	if opts.Path != "" {
+		path := filepath.Clean(opts.Path)
+		pair, _, ok := s.config.FindPair(path)
+		if !ok {
+			return nil, fmt.Errorf("路径不属于任何监控目录: %s", opts.Path)
+		}
+		if opts.Pair != "" && filepath.Clean(opts.Pair) != pair.Input {
+			return nil, fmt.Errorf("路径 %s 不在配对 %s 中", opts.Path, opts.Pair)
+		}
+		return []scanTarget{{pair: pair, root: path}}, nil
+	}
+
+	var targets []scanTarget
+	for _, pair := range s.config.GetPairs() {
+		if opts.Pair != "" && filepath.Clean(opts.Pair) != pair.Input {
+			continue
+		}
+		targets = append(targets, scanTarget{pair: pair, root: pair.Input})
+	}
+	if opts.Pair != "" && len(targets) == 0 {
+		return nil, fmt.Errorf("配对不存在: %s", opts.Pair)
+	}
+	return targets, nil
+}
+
+// prepareJobs 登记扫描任务，正在扫描的配对不会重复登记
+func (s *Scanner) prepareJobs(opts ScanOptions, trigger string) (jobs, busy []*ScanJob, deep bool, err error) {
+	targets, err := s.resolveTargets(opts)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	deep = s.needsDeepScan(opts)
+	adopt := opts.Adopt || s.config.Scanner.AdoptExisting
+	for _, target := range targets {
+		job, running := s.jobs.acquire(target.pair, target.root, deep, trigger)
+		if running != nil {
+			busy = append(busy, running)
+			continue
+		}
+		if adopt {
+			job.mu.Lock()
+			job.info.Adopt = true
+			job.mu.Unlock()
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, busy, deep, nil
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+// checkOrphans 检查扫描目录（配对输入目录或其子目录）下源文件已消失的任务
+// 缺失超过宽限期的任务标记为孤立，输出文件由清理模块按 orphan_policy 处理
+// unchanged 为增量扫描中 mtime 未变化的目录，其中的文件视为仍然存在
+func (s *Scanner) checkOrphans(ctx context.Context, pair config.InputOutputPair, root string, seen, unchanged map[string]struct{}) {
+	// 输入目录不可访问（如 NAS 未挂载）时不做判断，避免误判全部任务
+	if _, err := os.Stat(pair.Input); err != nil {
+		log.Printf("[Scanner] 输入目录不可访问，跳过孤立检测 %s: %v", pair.Input, err)
+		return
+	}
+
+	tasks, err := s.db.GetTasksUnderDir(root)
+	if err != nil {
+		log.Printf("[Scanner] 查询配对任务失败 %s: %v", root, err)
+		return
+	}
+	if len(seen) == 0 && len(unchanged) == 0 && len(tasks) > 0 {
+		log.Printf("[Scanner] 输入目录中未发现任何视频文件，跳过孤立检测: %s", root)
+		return
+	}
+
+	now := time.Now()
+	grace := time.Duration(s.config.Cleaning.OrphanGraceHours) * time.Hour
+	missing, orphaned, restored := 0, 0, 0
+
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return
+		}
+		// 隔离的源文件由 STM 自己移走，不属于孤立
+		if task.Status == database.StatusProcessing || task.Status == database.StatusQuarantined || task.SourceRemovedAt != nil {
+			continue
+		}
+
+		exists := false
+		if _, ok := seen[task.SourcePath]; ok {
+			exists = true
+		} else if _, ok := unchanged[filepath.Dir(task.SourcePath)]; ok && task.MissingSince == nil && task.Status != database.StatusOrphaned {
+			exists = true // 目录未变化：此前存在的文件未被删除或移走
+		} else if _, err := os.Stat(task.SourcePath); err == nil {
+			exists = true // 被过滤规则跳过但文件仍在
+		} else if !os.IsNotExist(err) {
+			continue // 无法确定（权限等），保持现状
+		}
+
+		if exists {
+			if task.Status == database.StatusOrphaned {
+				if err := s.db.RestoreOrphanedTask(task.ID); err != nil {
+					log.Printf("[Scanner] 恢复孤立任务失败 %s: %v", task.SourcePath, err)
+					continue
+				}
+				log.Printf("[Scanner] 孤立任务的源文件已恢复: %s", task.SourcePath)
+				restored++
+			} else if task.MissingSince != nil {
+				if err := s.db.ClearTaskMissing(task.ID); err != nil {
+					log.Printf("[Scanner] 清除缺失标记失败 %s: %v", task.SourcePath, err)
+				}
+			}
+			continue
+		}
+
+		if task.Status == database.StatusOrphaned {
+			continue
+		}
+
+		// 清理模块已移走但未来得及记录的源文件（有垃圾桶或归档记录）不视为孤立，其余按外部删除处理
+		removed, err := s.db.HasRemovalRecord(task.ID, task.SourcePath)
+		if err != nil {
+			log.Printf("[Scanner] 查询源文件移除记录失败 %s: %v", task.SourcePath, err)
+			continue
+		}
+		if removed {
+			if err := s.db.MarkSourceRemoved(task.ID); err != nil {
+				log.Printf("[Scanner] 记录源文件移除失败 %s: %v", task.SourcePath, err)
+			}
+			continue
+		}
+
+		if task.MissingSince == nil {
+			if err := s.db.MarkTaskMissing(task.ID, now); err != nil {
+				log.Printf("[Scanner] 记录源文件缺失失败 %s: %v", task.SourcePath, err)
+				continue
+			}
+			missing++
+			if grace > 0 {
+				log.Printf("[Scanner] 源文件缺失，%v 后标记为孤立: %s", grace, task.SourcePath)
+				continue
+			}
+		} else if now.Sub(*task.MissingSince) < grace {
+			continue
+		}
+
+		if err := s.db.UpdateTaskStatus(task.ID, database.StatusOrphaned, "源文件已在外部删除"); err != nil {
+			log.Printf("[Scanner] 标记孤立任务失败 %s: %v", task.SourcePath, err)
+			continue
+		}
+		log.Printf("[Scanner] 源文件已删除，标记为孤立任务: %s", task.SourcePath)
+		orphaned++
+	}
+
+	if missing > 0 || orphaned > 0 || restored > 0 {
+		log.Printf("[Scanner] 孤立检测完成 %s: 新发现缺失 %d, 标记孤立 %d, 恢复 %d",
+			root, missing, orphaned, restored)
+	}
+}
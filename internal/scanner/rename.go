@@ -0,0 +1,186 @@
+package scanner
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+	"github.com/stm/video-transcoder/internal/filter"
+)
+
+// fingerprintChunk 内容指纹读取的头尾块大小
+const fingerprintChunk = 64 * 1024
+
+// partialHash 计算文件内容指纹：文件大小 + 头尾各 64KB 的 SHA-1
+// 只读取少量数据，适合在 NAS 上对大文件快速比对
+func partialHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := sha1.New()
+	var sizeBuf [8]byte
+	binary.BigEndian.PutUint64(sizeBuf[:], uint64(size))
+	h.Write(sizeBuf[:])
+
+	buf := make([]byte, fingerprintChunk)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	h.Write(buf[:n])
+
+	// 文件大于两个块时再读取尾部
+	if size > 2*fingerprintChunk {
+		n, err = f.ReadAt(buf, size-fingerprintChunk)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		h.Write(buf[:n])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// renameLookup 重命名检测使用的只读查询（扫描写入阶段的 taskStore 与试运行的 *database.DB 均实现）
+type renameLookup interface {
+	GetTasksBySize(size int64) ([]*database.Task, error)
+}
+
+// findRenamed 查找源文件被重命名或移动为 path 的已有任务，不修改任何数据
+// 匹配条件：旧源文件已不存在，且大小、mtime、内容指纹一致；hash 为空时按需计算
+func findRenamed(store renameLookup, path string, size int64, mtime time.Time, hash string) (*database.Task, error) {
+	candidates, err := store.GetTasksBySize(size)
+	if err != nil {
+		return nil, fmt.Errorf("查询重命名候选失败: %w", err)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.SourcePath == path || !candidate.SourceMtime.Equal(mtime) || candidate.SourceHash == "" {
+			continue
+		}
+		if _, err := os.Stat(candidate.SourcePath); !os.IsNotExist(err) {
+			continue // 旧文件仍在：是副本而非重命名
+		}
+
+		if hash == "" {
+			if hash, err = partialHash(path); err != nil {
+				return nil, fmt.Errorf("计算内容指纹失败: %w", err)
+			}
+		}
+		if candidate.SourceHash == hash {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// detectRename 新文件入库前检查是否为已有任务的源文件被重命名或移动
+// 返回扫描动作和是否已处理
+func (s *Scanner) detectRename(store taskStore, entry *scanEntry) (string, bool) {
+	fullPath := entry.fullPath
+	candidate, err := findRenamed(store, fullPath, entry.size, entry.mtime, entry.hash)
+	if err != nil {
+		log.Printf("[Scanner] 重命名检测失败 %s: %v", fullPath, err)
+		return "", false
+	}
+	if candidate == nil {
+		return "", false
+	}
+
+	// 转码中的任务等其结束后再迁移，避免重复创建任务
+	if candidate.Status == database.StatusProcessing {
+		log.Printf("[Scanner] 检测到重命名但任务正在转码，下次扫描再处理: %s -> %s",
+			candidate.SourcePath, fullPath)
+		return "skip", true
+	}
+
+	move, err := s.applyRename(store, candidate, fullPath, entry.overrides)
+	if err != nil {
+		log.Printf("[Scanner] 迁移重命名任务失败 %s -> %s: %v", candidate.SourcePath, fullPath, err)
+		return "error", true
+	}
+	entry.move = move
+	return "renamed", true
+}
+
+// outputMove 重命名后待移动的输出文件，在任务路径的更新提交后执行
+type outputMove struct {
+	taskID    int64
+	from, to  string
+	overrides filter.ResolvedOverrides
+}
+
+// applyRename 更新任务源路径，已完成任务的输出需要随源文件移动时返回移动计划
+func (s *Scanner) applyRename(store taskStore, task *database.Task, newPath string, overrides filter.ResolvedOverrides) (*outputMove, error) {
+	oldOutput := s.config.ExistingOutputPath(task.SourcePath, task.OutputPath)
+
+	if err := store.UpdateTaskPath(task.ID, newPath); err != nil {
+		return nil, err
+	}
+	if err := store.UpdateTaskOverrides(task.ID, overrides.Profile, overrides.Priority, overrides.OutputBase); err != nil {
+		return nil, err
+	}
+	log.Printf("[Scanner] 检测到重命名，沿用已有任务 #%d: %s -> %s", task.ID, task.SourcePath, newPath)
+
+	if task.Status != database.StatusCompleted || oldOutput == "" {
+		return nil, nil
+	}
+
+	newBase, _ := s.config.ResolveOutputBase(newPath, overrides.OutputBase)
+	newOutput := s.config.ApplyOutputExtension(newBase)
+	if newOutput == oldOutput {
+		return nil, nil
+	}
+
+	if _, err := os.Stat(newOutput); err == nil {
+		log.Printf("[Scanner] 新位置已存在输出文件，保留旧输出: %s", newOutput)
+		return nil, nil
+	}
+	return &outputMove{taskID: task.ID, from: oldOutput, to: newOutput, overrides: overrides}, nil
+}
+
+// moveOutput 将输出文件移动到新源文件对应的位置（跨分区时复制并校验）
+// 移动失败时将旧输出记为任务的输出路径，避免下次扫描因输出缺失而重新转码
+func (s *Scanner) moveOutput(m *outputMove) {
+	err := os.MkdirAll(filepath.Dir(m.to), 0755)
+	if err == nil {
+		opts := fileutil.Options{BytesPerSecond: int64(s.config.Cleaning.MoveBandwidthMB * 1024 * 1024)}
+		_, err = fileutil.Move(m.from, m.to, opts)
+	}
+	if err == nil {
+		log.Printf("[Scanner] 输出文件已随源文件移动: %s -> %s", m.from, m.to)
+		return
+	}
+
+	log.Printf("[Scanner] 移动输出文件失败，任务 #%d 继续使用旧输出 %s: %v", m.taskID, m.from, err)
+	if err := s.db.UpdateTaskOverrides(m.taskID, m.overrides.Profile, m.overrides.Priority, m.from); err != nil {
+		log.Printf("[Scanner] 记录任务 #%d 的输出路径失败: %v", m.taskID, err)
+	}
+}
+
+// hashFile 计算内容指纹，失败时返回空（下次扫描重试）
+func (s *Scanner) hashFile(path string) string {
+	hash, err := partialHash(path)
+	if err != nil {
+		log.Printf("[Scanner] 计算内容指纹失败 %s: %v", path, err)
+		return ""
+	}
+	return hash
+}
@@ -2,33 +2,60 @@ package scanner
 
 import (
 	"context"
-	"io/fs"
+	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/stm/video-transcoder/internal/config"
 	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/filter"
+	"github.com/stm/video-transcoder/internal/media"
+	"github.com/stm/video-transcoder/internal/metrics"
 )
 
 // Scanner 目录扫描器
 type Scanner struct {
-	config *config.Config
-	db     *database.DB
+	config   *config.Config
+	db       *database.DB
+	dirRules *filter.DirRules // .stmignore / .stm.yaml 缓存
+
+	mu           sync.Mutex
+	lastDeepScan time.Time // 上次完整扫描完成时间
+
+	jobs      *jobRegistry   // 扫描任务登记
+	durations *durationCache // 因时长被排除的文件的探测结果
+}
+
+// ScanOptions 扫描选项
+type ScanOptions struct {
+	Deep bool   // 完整扫描：忽略目录 mtime，读取所有目录
+	Pair string // 只扫描指定配对（输入目录），为空表示全部配对
+	Path string // 只扫描指定子目录（须位于某个配对的输入目录下）
+	// 收养模式：新文件在映射路径上已有通过校验的输出时直接记为已完成（scanner.adopt_existing 对所有扫描生效）
+	Adopt bool
 }
 
 // New 创建扫描器实例
 func New(cfg *config.Config, db *database.DB) *Scanner {
 	return &Scanner{
-		config: cfg,
-		db:     db,
+		config:    cfg,
+		db:        db,
+		dirRules:  filter.NewDirRules(),
+		jobs:      newJobRegistry(),
+		durations: newDurationCache(),
 	}
 }
 
-// Scan 扫描输入目录并更新数据库
+// Scan 扫描输入目录并更新数据库（增量模式下按计划自动决定是否完整扫描）
 func (s *Scanner) Scan(ctx context.Context) error {
+	return s.ScanWithOptions(ctx, ScanOptions{})
+}
+
+// ScanWithOptions 按选项同步扫描输入目录，正在扫描中的配对会被跳过
+func (s *Scanner) ScanWithOptions(ctx context.Context, opts ScanOptions) error {
 	// 调试日志：检查 context 状态
 	if ctx.Err() != nil {
 		log.Printf("[Scanner] ⚠️  WARNING: Scan 启动时 context 已被取消: %v", ctx.Err())
@@ -36,157 +63,436 @@ func (s *Scanner) Scan(ctx context.Context) error {
 		log.Printf("[Scanner] ✓ context 状态正常，类型: %T", ctx)
 	}
 
-	pairs := s.config.GetPairs()
-	log.Printf("[Scanner] 开始扫描 %d 个目录配对", len(pairs))
+	jobs, busy, deep, err := s.prepareJobs(opts, TriggerScheduled)
+	if err != nil {
+		return err
+	}
+	for _, job := range busy {
+		log.Printf("[Scanner] 配对正在扫描中（任务 #%d），本次跳过: %s", job.Info().ID, job.pair.Input)
+	}
 
-	totalNew := 0
-	totalUpdate := 0
-	totalSkip := 0
-	startTime := time.Now()
+	s.runJobs(ctx, jobs, opts, deep)
+	return nil
+}
 
-	for _, pair := range pairs {
-		log.Printf("[Scanner] 扫描目录: %s -> %s", pair.Input, pair.Output)
-		newCount, updateCount, skipCount, err := s.scanDirectory(ctx, pair.Input, pair.Output)
-		if err != nil {
-			log.Printf("[Scanner] 扫描目录失败 %s: %v", pair.Input, err)
-			continue
+// runJobs 依次执行同一批次的扫描任务，ctx 取消时取消所有未结束的任务
+func (s *Scanner) runJobs(ctx context.Context, jobs []*ScanJob, opts ScanOptions, deep bool) {
+	if deep {
+		log.Printf("[Scanner] 开始完整扫描 %d 个目录配对", len(jobs))
+	} else {
+		log.Printf("[Scanner] 开始增量扫描 %d 个目录配对", len(jobs))
+	}
+
+	var total ScanCounts
+	startTime := time.Now()
+	s.dirRules.NewGeneration()
+
+	legacy := s.loadLegacyIndex()
+
+	complete := true
+	for _, job := range jobs {
+		stop := context.AfterFunc(ctx, job.cancel)
+
+		log.Printf("[Scanner] 扫描目录: %s -> %s", job.root, job.pair.Output)
+		job.start()
+		err := s.scanDirectory(job, legacy, deep)
+		job.finish(err)
+		s.jobs.release(job)
+		stop()
+
+		if info := job.Info(); info.Status != ScanJobCompleted {
+			complete = false
+			if info.Status == ScanJobCancelled {
+				log.Printf("[Scanner] 扫描任务 #%d 已取消: %s", info.ID, job.root)
+			} else {
+				log.Printf("[Scanner] 扫描目录失败 %s: %v", job.root, err)
+			}
 		}
-		totalNew += newCount
-		totalUpdate += updateCount
-		totalSkip += skipCount
+		total.add(job.counts())
+	}
+
+	// 只扫描部分配对或子目录时不影响完整扫描计划
+	full := opts.Pair == "" && opts.Path == ""
+	if full && deep && complete && ctx.Err() == nil {
+		s.mu.Lock()
+		s.lastDeepScan = time.Now()
+		s.mu.Unlock()
 	}
 
 	elapsed := time.Since(startTime)
-	log.Printf("[Scanner] 扫描完成，耗时: %v，新增: %d, 更新: %d, 跳过: %d",
-		elapsed, totalNew, totalUpdate, totalSkip)
+	log.Printf("[Scanner] 扫描完成，耗时: %v，新增: %d, 更新: %d, 跳过: %d, 等待稳定: %d, 排除: %d, 重命名: %d, 收养: %d",
+		elapsed, total.New, total.Update, total.Skip, total.Settling, total.Excluded, total.Renamed, total.Adopted)
+}
 
-	if err := s.verifyCompletedOutputs(ctx); err != nil {
-		log.Printf("[Scanner] 输出校验失败: %v", err)
+// needsDeepScan 是否执行完整扫描：手动指定、未启用增量模式或距上次完整扫描已超过间隔
+func (s *Scanner) needsDeepScan(opts ScanOptions) bool {
+	if opts.Deep || !s.config.Scanner.Incremental {
+		return true
 	}
 
-	return nil
+	interval := time.Duration(s.config.Scanner.DeepScanHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastDeepScan.IsZero() || time.Since(s.lastDeepScan) >= interval
 }
 
-// scanDirectory 扫描单个目录
-func (s *Scanner) scanDirectory(ctx context.Context, inputDir string, outputDir string) (newCount, updateCount, skipCount int, err error) {
+// scanDirectory 执行单个扫描任务（整个配对或其子目录）
+// 先将目录下已有任务载入内存索引，并行遍历目录完成查找与探测，再由单个协程分批写入数据库
+func (s *Scanner) scanDirectory(job *ScanJob, legacy *legacyIndex, deep bool) error {
+	ctx, pair, root := job.ctx, job.pair, job.root
+
 	// 调试日志：扫描开始前检查 context
 	if ctx.Err() != nil {
 		log.Printf("[Scanner] ⚠️  scanDirectory 启动时 context 已取消: %v", ctx.Err())
-		return 0, 0, 0, ctx.Err()
+		return ctx.Err()
 	}
 
-	err = filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			log.Printf("[Scanner] 访问路径失败 %s: %v", path, walkErr)
-			return nil // 继续扫描其他文件
-		}
+	startTime := time.Now()
+	rules := filter.ForPair(s.config, pair).WithDirRules(s.dirRules)
+	if err := checkRootRules(rules, pair, root); err != nil {
+		return err
+	}
 
-		// 检查上下文取消
-		select {
-		case <-ctx.Done():
-			log.Printf("[Scanner] ⚠️  ctx.Done() 被触发，原因: %v", ctx.Err())
-			return ctx.Err()
-		default:
+	index, err := s.loadIndex(root)
+	if err != nil {
+		return fmt.Errorf("加载任务索引失败: %w", err)
+	}
+
+	entries := make(chan *scanEntry, 256)
+	walk := s.newPairWalk(job, rules, index, legacy, entries, !deep)
+	walkErr := make(chan error, 1)
+	go func() {
+		walkErr <- walkParallel(ctx, root, s.walkWorkers(), walk.processDir)
+		close(entries)
+	}()
+
+	seen := make(map[string]struct{}) // 本次扫描见到的视频文件，用于孤立检测
+	s.applyEntries(job, entries, legacy, seen)
+
+	if err = <-walkErr; err != nil && ctx.Err() != nil {
+		log.Printf("[Scanner] ⚠️  扫描被取消，原因: %v", ctx.Err())
+	}
+
+	elapsed := time.Since(startTime)
+	s.reportPairScan(pair, len(seen), len(index), len(walk.updated), len(walk.unchanged), elapsed)
+
+	if err != nil {
+		return err
+	}
+	walk.saveDirs()
+	s.durations.prune(root, seen, walk.unchanged)
+	s.checkOrphans(ctx, pair, root, seen, walk.unchanged)
+	return nil
+}
+
+// checkRootRules 扫描子目录时检查其自身及上级目录是否被过滤规则排除
+func checkRootRules(rules *filter.Filter, pair config.InputOutputPair, root string) error {
+	relRoot, err := filepath.Rel(pair.Input, root)
+	if err != nil || relRoot == "." {
+		return err
+	}
+
+	parts := strings.Split(relRoot, string(filepath.Separator))
+	for i := range parts {
+		relPath := filepath.Join(parts[:i+1]...)
+		if decision := rules.CheckDir(relPath); !decision.Accepted {
+			return fmt.Errorf("目录被过滤规则排除: %s (%s)", relPath, decision.Rule)
 		}
+	}
+	return nil
+}
 
-		// 跳过目录
-		if d.IsDir() {
-			// 检查是否需要跳过此目录
-			if shouldSkipDir(d.Name()) {
-				log.Printf("[Scanner] 跳过系统目录: %s", path)
-				return filepath.SkipDir
-			}
-			return nil
+// scanEntry 遍历阶段收集的文件信息，查找索引、时长探测和指纹计算均在并行阶段完成
+type scanEntry struct {
+	fullPath  string
+	relPath   string
+	mtime     time.Time
+	size      int64
+	task      *database.Task // 已有任务，nil 表示新文件
+	legacy    bool           // task 来自旧版本相对路径记录
+	excluded  bool           // 被文件过滤规则排除
+	rejected  *filter.Decision
+	overrides filter.ResolvedOverrides
+	hash      string      // 新文件或需补算时的内容指纹
+	adopted   *adoption   // 收养模式下新文件已有的输出
+	move      *outputMove // 重命名后需随源文件移动的输出
+
+	openForWriting bool // 观察期中的文件仍被其他进程以写模式打开
+}
+
+// legacyIndex 旧版本以相对路径记录的任务
+type legacyIndex struct {
+	byRel    map[string]*database.Task
+	migrated map[int64]bool // 已在本轮扫描中迁移为完整路径（仅由写入协程访问）
+}
+
+// loadIndex 将扫描目录下的已有任务一次性载入内存
+func (s *Scanner) loadIndex(root string) (map[string]*database.Task, error) {
+	tasks, err := s.db.GetTasksUnderDir(root)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]*database.Task, len(tasks))
+	for _, task := range tasks {
+		index[task.SourcePath] = task
+	}
+	return index, nil
+}
+
+// loadLegacyIndex 载入旧版本相对路径任务（每轮扫描一次）
+func (s *Scanner) loadLegacyIndex() *legacyIndex {
+	legacy := &legacyIndex{
+		byRel:    make(map[string]*database.Task),
+		migrated: make(map[int64]bool),
+	}
+	tasks, err := s.db.GetLegacyTasks()
+	if err != nil {
+		log.Printf("[Scanner] 查询旧版本记录失败: %v", err)
+		return legacy
+	}
+	for _, task := range tasks {
+		legacy.byRel[task.SourcePath] = task
+	}
+	return legacy
+}
+
+// prepareEntry 查找已有任务并完成耗时的探测（时长过滤、内容指纹）
+func (s *Scanner) prepareEntry(pair config.InputOutputPair, entry *scanEntry, rules *filter.Filter,
+	index map[string]*database.Task, legacy *legacyIndex, adopt bool) {
+
+	entry.overrides = s.resolveOverrides(pair, entry.relPath)
+
+	// 查询索引中是否存在该文件（先尝试完整路径，再兼容旧版本相对路径）
+	entry.task = index[entry.fullPath]
+	if entry.task == nil {
+		if task := legacy.byRel[entry.relPath]; task != nil {
+			entry.task = task
+			entry.legacy = true
 		}
+	}
 
-		// 文件过滤
-		if shouldSkipFile(d.Name()) {
-			return nil
+	if entry.task == nil {
+		// 时长限制需要 ffprobe，仅对新文件检查
+		if decision, ok := s.checkDuration(entry.fullPath, entry.size, entry.mtime, rules); !ok {
+			entry.rejected = &decision
+			return
+		}
+		// 收养模式：校验映射路径上已有的输出（ffprobe 较慢，在并行阶段完成）
+		if adopt {
+			entry.adopted = s.checkAdoptable(entry)
 		}
+		// 稳定的文件立即记录内容指纹，观察期中的文件稳定后再补算
+		if !s.config.Scanner.StabilityEnabled() {
+			entry.hash = s.hashFile(entry.fullPath)
+		}
+		return
+	}
 
-		// 检查是否为视频文件
-		if !s.config.IsVideoFile(path) {
-			return nil
+	task := entry.task
+	unchanged := task.SourceMtime.Equal(entry.mtime) && task.SourceSize == entry.size
+
+	// 观察期中未变化的文件检查写入进程（遍历 /proc 较慢，不能放在持有批量事务的写入阶段）
+	if task.Status == database.StatusSettling {
+		if unchanged && s.config.Scanner.CheckOpenWriters {
+			entry.openForWriting = isFileOpenForWriting(entry.fullPath)
 		}
+		return
+	}
 
-		// 获取文件信息
-		info, err := d.Info()
-		if err != nil {
-			log.Printf("[Scanner] 获取文件信息失败 %s: %v", path, err)
-			return nil
+	// 未变化的文件补齐内容指纹，供重命名检测使用
+	if task.SourceHash == "" && unchanged {
+		entry.hash = s.hashFile(entry.fullPath)
+	}
+}
+
+// applyEntries 依次处理遍历结果，按批次提交事务
+// 必须读完 entries，否则遍历协程会阻塞
+func (s *Scanner) applyEntries(job *ScanJob, entries <-chan *scanEntry, legacy *legacyIndex, seen map[string]struct{}) {
+
+	const maxBatchAge = time.Second // 单连接模式下事务不宜长时间持有
+
+	var (
+		batch      *database.Batch
+		batchOps   int
+		batchStart time.Time
+		moves      []*outputMove // 批次提交后再移动的输出文件
+	)
+	flush := func() {
+		if batch == nil {
+			return
 		}
+		if err := batch.Commit(); err != nil {
+			log.Printf("[Scanner] 提交扫描批次失败 (%d 条): %v", batchOps, err)
+			moves = nil // 任务路径未更新，下次扫描重新检测重命名
+		}
+		for _, m := range moves {
+			s.moveOutput(m)
+		}
+		batch = nil
+		batchOps = 0
+		moves = nil
+	}
+	defer flush()
 
-		// 计算相对于输入目录的路径
-		relPath, err := filepath.Rel(inputDir, path)
-		if err != nil {
-			log.Printf("[Scanner] 计算相对路径失败 %s: %v", path, err)
-			return nil
+	ticker := time.NewTicker(maxBatchAge)
+	defer ticker.Stop()
+
+	for {
+		var entry *scanEntry
+		select {
+		case e, ok := <-entries:
+			if !ok {
+				return
+			}
+			entry = e
+		case <-ticker.C:
+			if batch != nil && time.Since(batchStart) >= maxBatchAge {
+				flush()
+			}
+			continue
 		}
 
-		// 处理文件（传入对应的输出目录）
-		action := s.processFile(path, relPath, outputDir, info.ModTime(), info.Size())
-		switch action {
-		case "new":
-			newCount++
-		case "update":
-			updateCount++
-		case "skip":
-			skipCount++
+		seen[entry.fullPath] = struct{}{}
+		if entry.excluded {
+			job.record("", true)
+			continue
 		}
 
-		return nil
-	})
+		var store taskStore = s.db
+		if batch == nil {
+			b, err := s.db.BeginBatch()
+			if err != nil {
+				log.Printf("[Scanner] 开启扫描批次失败，逐条写入: %v", err)
+			} else {
+				batch = b
+				batchStart = time.Now()
+			}
+		}
+		if batch != nil {
+			store = batch.DB()
+		}
 
-	return
-}
+		// 处理文件（传入对应的输出目录）
+		action := s.processFile(store, job.pair, entry, legacy)
+		job.record(action, false)
+		if entry.move != nil {
+			if batch != nil {
+				moves = append(moves, entry.move)
+			} else {
+				s.moveOutput(entry.move)
+			}
+		}
 
-// processFile 处理单个文件
-func (s *Scanner) processFile(fullPath, relPath, outputDir string, mtime time.Time, size int64) string {
-	// 查询数据库中是否存在该文件（先尝试完整路径）
-	task, err := s.db.GetTaskByPath(fullPath)
-	if err != nil {
-		log.Printf("[Scanner] 查询任务失败 %s: %v", fullPath, err)
-		return "error"
+		batchOps++
+		if batchOps >= s.batchSize() {
+			flush()
+		}
 	}
+}
 
-	// 向后兼容：如果没有找到，尝试查询相对路径（旧版本数据）
-	if task == nil {
-		task, err = s.db.GetTaskByPath(relPath)
-		if err != nil {
-			log.Printf("[Scanner] 查询任务失败 %s: %v", relPath, err)
-			return "error"
-		}
-		// 如果找到了旧记录，更新为完整路径
-		if task != nil {
+// processFile 处理单个文件，所有数据库操作通过 store 执行（可能处于批量事务中）
+func (s *Scanner) processFile(store taskStore, pair config.InputOutputPair, entry *scanEntry, legacy *legacyIndex) string {
+	fullPath, relPath := entry.fullPath, entry.relPath
+	mtime, size := entry.mtime, entry.size
+	task := entry.task
+
+	// 向后兼容：旧记录使用相对路径，更新为完整路径
+	if task != nil && entry.legacy {
+		if legacy.migrated[task.ID] {
+			task = nil // 已被其他配对的同名文件迁移
+		} else {
 			log.Printf("[Scanner] 发现旧版本记录，更新路径: %s -> %s", relPath, fullPath)
-			if err := s.db.UpdateTaskPath(task.ID, fullPath); err != nil {
+			if err := store.UpdateTaskPath(task.ID, fullPath); err != nil {
 				log.Printf("[Scanner] 更新任务路径失败: %v", err)
 				return "error"
 			}
-			// 重新查询获取更新后的任务
-			task, _ = s.db.GetTaskByPath(fullPath)
+			legacy.migrated[task.ID] = true
+			migrated := *task
+			migrated.SourcePath = fullPath
+			task = &migrated
 		}
 	}
 
+	overrides := entry.overrides
+
 	// 情况1: 新文件
 	if task == nil {
+		if entry.rejected != nil {
+			log.Printf("[Scanner] 文件被过滤: %s (%s: %s)", relPath, entry.rejected.Rule, entry.rejected.Reason)
+			return "excluded"
+		}
+
+		// 重命名/移动的文件沿用已有任务，避免重新转码
+		if action, handled := s.detectRename(store, entry); handled {
+			return action
+		}
+
 		newTask := &database.Task{
 			SourcePath:  fullPath,
 			SourceMtime: mtime,
 			SourceSize:  size,
+			Profile:     overrides.Profile,
+			Priority:    overrides.Priority,
+			OutputPath:  overrides.OutputBase,
+			SourceHash:  entry.hash,
+		}
+		// 已有通过校验的输出：直接记为已完成，不重新转码
+		if entry.adopted != nil {
+			return s.adoptTask(store, newTask, entry.adopted)
 		}
-		if err := s.db.CreateTask(newTask); err != nil {
+		// 启用稳定性检测时先进入观察期，避免处理仍在写入的文件
+		if s.config.Scanner.StabilityEnabled() {
+			now := time.Now()
+			newTask.Status = database.StatusSettling
+			newTask.StableSince = &now
+			newTask.SourceHash = ""
+		}
+		if err := store.CreateTask(newTask); err != nil {
 			log.Printf("[Scanner] 创建任务失败 %s: %v", fullPath, err)
 			return "error"
 		}
+		if newTask.Status == database.StatusSettling {
+			log.Printf("[Scanner] 新文件等待稳定: %s (%.2f MB)",
+				fullPath, float64(size)/1024/1024)
+			return "settling"
+		}
 		log.Printf("[Scanner] 新文件入库: %s (%.2f MB)",
 			fullPath, float64(size)/1024/1024)
 		return "new"
 	}
 
+	// 尚未开始转码的任务同步目录覆盖配置
+	if task.Status == database.StatusPending || task.Status == database.StatusSettling || task.Status == database.StatusFailed {
+		if task.Profile != overrides.Profile || task.Priority != overrides.Priority || task.OutputPath != overrides.OutputBase {
+			if err := store.UpdateTaskOverrides(task.ID, overrides.Profile, overrides.Priority, overrides.OutputBase); err != nil {
+				log.Printf("[Scanner] 更新目录覆盖配置失败 %s: %v", fullPath, err)
+			} else {
+				log.Printf("[Scanner] 目录覆盖配置已更新: %s (profile=%q, priority=%d)",
+					relPath, overrides.Profile, overrides.Priority)
+			}
+		}
+	}
+
+	// 观察期中的文件：检查是否已稳定
+	if task.Status == database.StatusSettling {
+		return s.checkSettling(store, task, mtime, size, entry.openForWriting)
+	}
+
 	// 情况2: 文件已更新（mtime或size变化）
 	if !task.SourceMtime.Equal(mtime) || task.SourceSize != size {
-		if err := s.db.ResetTaskToPending(fullPath, mtime, size); err != nil {
+		if s.config.Scanner.StabilityEnabled() {
+			if err := store.ResetTaskToSettling(fullPath, mtime, size); err != nil {
+				log.Printf("[Scanner] 重置任务失败 %s: %v", fullPath, err)
+				return "error"
+			}
+			log.Printf("[Scanner] 文件已更新，等待稳定: %s", relPath)
+			return "settling"
+		}
+		if err := store.ResetTaskToPending(fullPath, mtime, size); err != nil {
 			log.Printf("[Scanner] 重置任务失败 %s: %v", fullPath, err)
 			return "error"
 		}
@@ -194,22 +500,22 @@ func (s *Scanner) processFile(fullPath, relPath, outputDir string, mtime time.Ti
 		return "update"
 	}
 
+	// 补齐内容指纹，供重命名检测使用
+	if task.SourceHash == "" && entry.hash != "" {
+		if err := store.UpdateTaskHash(task.ID, entry.hash); err != nil {
+			log.Printf("[Scanner] 保存内容指纹失败 %s: %v", fullPath, err)
+		}
+	}
+
 	// 情况3: 已完成且目标文件存在
 	if task.Status == database.StatusCompleted {
-		// 使用配对的输出目录而非全局配置
-		basePath := filepath.Join(outputDir, relPath)
-		targetPath := s.config.ApplyOutputExtension(basePath)
-		if _, err := os.Stat(targetPath); err == nil {
+		// 使用任务记录的输出路径（.stm.yaml 覆盖）或配对的输出目录
+		if s.config.ExistingOutputPath(fullPath, task.OutputPath) != "" {
 			return "skip"
 		}
-		if targetPath != basePath {
-			if _, err := os.Stat(basePath); err == nil {
-				return "skip"
-			}
-		}
 		// 目标文件不存在，重置任务
 		log.Printf("[Scanner] 目标文件丢失，重置任务: %s", relPath)
-		if err := s.db.ResetTaskToPending(fullPath, mtime, size); err != nil {
+		if err := store.ResetTaskToPending(fullPath, mtime, size); err != nil {
 			log.Printf("[Scanner] 重置任务失败 %s: %v", fullPath, err)
 			return "error"
 		}
@@ -219,47 +525,97 @@ func (s *Scanner) processFile(fullPath, relPath, outputDir string, mtime time.Ti
 	return "skip"
 }
 
-// shouldSkipDir 检查是否应跳过该目录
-func shouldSkipDir(name string) bool {
-	skipDirs := []string{
-		".stm_trash", // 垃圾桶
-		"@eaDir",     // 群晖索引
-		"#recycle",   // 群晖回收站
-		".DS_Store",  // macOS
+// taskStore 扫描写入阶段使用的数据库操作，由 *database.DB（含批量事务绑定的 DB）实现
+type taskStore interface {
+	CreateTask(task *database.Task) error
+	UpdateTaskPath(id int64, newPath string) error
+	UpdateTaskOverrides(id int64, profile string, priority int, outputPath string) error
+	UpdateTaskHash(id int64, hash string) error
+	ResetTaskToPending(path string, mtime time.Time, size int64) error
+	ResetTaskToSettling(path string, mtime time.Time, size int64) error
+	UpdateSettlingState(id int64, mtime time.Time, size int64, stableScans int, stableSince time.Time) error
+	PromoteSettledTask(id int64) error
+	CreateAdoptedTask(task *database.Task, note string, sourceRemoved bool) error
+	GetTasksBySize(size int64) ([]*database.Task, error)
+}
+
+// reportPairScan 记录单个配对的扫描耗时与吞吐量
+func (s *Scanner) reportPairScan(pair config.InputOutputPair, files, indexed, dirsRead, dirsSkipped int, elapsed time.Duration) {
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(files) / elapsed.Seconds()
 	}
+	log.Printf("[Scanner] 配对扫描完成 %s: 视频文件 %d, 已有任务 %d, 读取目录 %d, 未变化目录 %d, 耗时 %v, %.0f 文件/秒",
+		pair.Input, files, indexed, dirsRead, dirsSkipped, elapsed.Round(time.Millisecond), rate)
 
-	for _, dir := range skipDirs {
-		if name == dir {
-			return true
-		}
+	metrics.ScanDuration.WithLabelValues(pair.Input).Set(elapsed.Seconds())
+	metrics.ScanFiles.WithLabelValues(pair.Input).Set(float64(files))
+	metrics.ScanThroughput.WithLabelValues(pair.Input).Set(rate)
+}
+
+// walkWorkers 并行遍历协程数
+func (s *Scanner) walkWorkers() int {
+	if s.config.Scanner.WalkWorkers > 0 {
+		return s.config.Scanner.WalkWorkers
+	}
+	return 4
+}
+
+// batchSize 每个事务的写入条数
+func (s *Scanner) batchSize() int {
+	if s.config.Scanner.BatchSize > 0 {
+		return s.config.Scanner.BatchSize
 	}
+	return 500
+}
 
-	return false
+// shouldSkipDir 检查是否应跳过该目录（内置系统规则）
+func shouldSkipDir(name string) bool {
+	return filter.IsSystemDir(name, "")
 }
 
-// shouldSkipFile 检查是否应跳过该文件（支持通配符）
+// shouldSkipFile 检查是否应跳过该文件（内置系统规则）
 func shouldSkipFile(name string) bool {
-	// 群晖缩略图/视频
-	if strings.HasPrefix(name, "SYNOPHOTO_") {
-		return true
-	}
+	return filter.IsSystemFile(name)
+}
 
-	// 隐藏文件
-	if strings.HasPrefix(name, ".") {
-		return true
+// resolveOverrides 合并上级目录的 .stm.yaml，未知的转码配置名会被忽略
+func (s *Scanner) resolveOverrides(pair config.InputOutputPair, relPath string) filter.ResolvedOverrides {
+	overrides := s.dirRules.Resolve(pair.Input, pair.Output, relPath)
+	if overrides.Profile != "" {
+		if _, ok := s.config.ResolveProfile(overrides.Profile); !ok {
+			log.Printf("[Scanner] 未知的转码配置 %q，使用默认参数: %s", overrides.Profile, relPath)
+			overrides.Profile = ""
+		}
 	}
+	return overrides
+}
 
-	// 临时文件
-	if strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
-		return true
+// checkDuration 按过滤规则检查视频时长，探测失败时放行交由转码阶段处理
+// 被排除的文件缓存探测结果，文件未变化时不再重复 ffprobe；规则调整后按缓存的时长重新判定
+func (s *Scanner) checkDuration(path string, size int64, mtime time.Time, rules *filter.Filter) (filter.Decision, bool) {
+	if rules == nil || !rules.NeedsDuration() {
+		return filter.Decision{Accepted: true}, true
 	}
 
-	// 锁文件
-	if strings.HasSuffix(name, ".lock") {
-		return true
+	duration, cached := s.durations.get(path, size, mtime)
+	if !cached {
+		probeTimeout := time.Duration(s.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+		var err error
+		duration, err = media.ProbeDuration(path, probeTimeout)
+		if err != nil {
+			log.Printf("[Scanner] 获取时长失败，跳过时长过滤 %s: %v", path, err)
+			return filter.Decision{Accepted: true}, true
+		}
 	}
 
-	return false
+	decision := rules.CheckDuration(duration)
+	if decision.Accepted {
+		s.durations.remove(path)
+	} else if !cached {
+		s.durations.put(path, size, mtime, duration)
+	}
+	return decision, decision.Accepted
 }
 
 // RunPeriodically 周期性运行扫描器
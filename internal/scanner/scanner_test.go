@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -216,3 +217,746 @@ func TestScanDetectsFileUpdate(t *testing.T) {
 		t.Errorf("文件更新后任务应被重置为pending，实际: %s", task2.Status)
 	}
 }
+
+func TestScanSettlesBeforeEnqueue(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Scanner.StableScans = 1
+
+	testFile := filepath.Join(inputDir, "downloading.mp4")
+	os.WriteFile(testFile, []byte("partial"), 0644)
+
+	ctx := context.Background()
+	scanner.Scan(ctx)
+
+	task, _ := db.GetTaskByPath(testFile)
+	if task == nil || task.Status != database.StatusSettling {
+		t.Fatalf("新文件应处于等待稳定状态，实际: %+v", task)
+	}
+
+	// 文件仍在增长：继续观察
+	time.Sleep(10 * time.Millisecond)
+	os.WriteFile(testFile, []byte("partial content"), 0644)
+	scanner.Scan(ctx)
+
+	task, _ = db.GetTaskByPath(testFile)
+	if task.Status != database.StatusSettling {
+		t.Fatalf("文件变化后应继续等待稳定，实际: %s", task.Status)
+	}
+
+	// 一次扫描内未变化：转为待处理
+	scanner.Scan(ctx)
+
+	task, _ = db.GetTaskByPath(testFile)
+	if task.Status != database.StatusPending {
+		t.Errorf("文件稳定后应转为pending，实际: %s", task.Status)
+	}
+}
+
+func TestScanWaitsForOpenWriters(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fdinfo"); err != nil {
+		t.Skip("当前系统不支持 /proc")
+	}
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Scanner.StableScans = 1
+	scanner.config.Scanner.CheckOpenWriters = true
+
+	testFile := filepath.Join(inputDir, "recording.mp4")
+	f, err := os.Create(testFile)
+	if err != nil {
+		t.Fatalf("创建测试文件失败: %v", err)
+	}
+	defer f.Close()
+	f.Write([]byte("partial"))
+
+	ctx := context.Background()
+	scanner.Scan(ctx)
+	scanner.Scan(ctx)
+	if task, _ := db.GetTaskByPath(testFile); task == nil || task.Status != database.StatusSettling {
+		t.Fatalf("仍被写入的文件应继续等待稳定: %+v", task)
+	}
+
+	f.Close()
+	scanner.Scan(ctx)
+	if task, _ := db.GetTaskByPath(testFile); task.Status != database.StatusPending {
+		t.Errorf("写入结束后应转为pending，实际: %s", task.Status)
+	}
+}
+
+func TestIsFileOpenForWriting(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fdinfo"); err != nil {
+		t.Skip("当前系统不支持 /proc")
+	}
+
+	path := filepath.Join(t.TempDir(), "writing.mp4")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("创建测试文件失败: %v", err)
+	}
+
+	if !isFileOpenForWriting(path) {
+		t.Error("以写模式打开的文件应被检测到")
+	}
+
+	f.Close()
+	if isFileOpenForWriting(path) {
+		t.Error("关闭后的文件不应被检测为写入中")
+	}
+}
+
+func TestScanHonorsDirectoryRules(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	showDir := filepath.Join(inputDir, "Shows")
+	os.MkdirAll(filepath.Join(showDir, "Extras"), 0755)
+	os.WriteFile(filepath.Join(inputDir, ".stmignore"), []byte("Extras/\n"), 0644)
+	os.WriteFile(filepath.Join(showDir, ".stm.yaml"), []byte("priority: 10\n"), 0644)
+
+	kept := filepath.Join(showDir, "ep01.mkv")
+	ignored := filepath.Join(showDir, "Extras", "bonus.mkv")
+	os.WriteFile(kept, []byte("fake"), 0644)
+	os.WriteFile(ignored, []byte("fake"), 0644)
+
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+
+	task, _ := db.GetTaskByPath(kept)
+	if task == nil {
+		t.Fatal("任务未创建")
+	}
+	if task.Priority != 10 {
+		t.Errorf(".stm.yaml 优先级未生效: %d", task.Priority)
+	}
+
+	if task, _ := db.GetTaskByPath(ignored); task != nil {
+		t.Error(".stmignore 忽略的目录不应创建任务")
+	}
+}
+
+func TestScanCachesDurationRejections(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Filter.MinDurationSeconds = 60
+
+	clip := filepath.Join(inputDir, "clip.mp4")
+	os.WriteFile(clip, []byte("fake"), 0644)
+	info, _ := os.Stat(clip)
+
+	// 模拟上次扫描已探测为 5 秒：文件未变化时直接按缓存排除，不再调用 ffprobe
+	scanner.durations.put(clip, info.Size(), info.ModTime(), 5)
+	if err := scanner.ScanWithOptions(context.Background(), ScanOptions{Deep: true}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if task, _ := db.GetTaskByPath(clip); task != nil {
+		t.Fatal("缓存的时长应使文件继续被排除")
+	}
+	if _, ok := scanner.durations.get(clip, info.Size(), info.ModTime()); !ok {
+		t.Fatal("排除记录不应被清除")
+	}
+
+	// 文件变化后缓存失效，重新探测（伪造文件探测失败时放行）
+	later := info.ModTime().Add(time.Minute)
+	os.Chtimes(clip, later, later)
+	if err := scanner.ScanWithOptions(context.Background(), ScanOptions{Deep: true}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if task, _ := db.GetTaskByPath(clip); task == nil {
+		t.Error("文件变化后应重新探测并创建任务")
+	}
+	if _, ok := scanner.durations.get(clip, info.Size(), later); ok {
+		t.Error("放行的文件不应留在缓存中")
+	}
+
+	// 已删除文件的记录在下次扫描时清除
+	gone := filepath.Join(inputDir, "gone.mp4")
+	scanner.durations.put(gone, 4, later, 5)
+	scanner.ScanWithOptions(context.Background(), ScanOptions{Deep: true})
+	if _, ok := scanner.durations.get(gone, 4, later); ok {
+		t.Error("已删除文件的记录应被清除")
+	}
+}
+
+func TestScanDetectsRename(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	outputDir := scanner.config.Path.Pairs[0].Output
+
+	oldPath := filepath.Join(inputDir, "a.mkv")
+	os.WriteFile(oldPath, []byte("movie content"), 0644)
+
+	ctx := context.Background()
+	scanner.Scan(ctx)
+
+	task, _ := db.GetTaskByPath(oldPath)
+	if task == nil || task.SourceHash == "" {
+		t.Fatalf("任务未创建或缺少内容指纹: %+v", task)
+	}
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "完成")
+	os.WriteFile(filepath.Join(outputDir, "a.mkv"), []byte("encoded"), 0644)
+
+	// 重命名并移动到子目录（mtime 保持不变）
+	os.MkdirAll(filepath.Join(inputDir, "Movies"), 0755)
+	newPath := filepath.Join(inputDir, "Movies", "b.mkv")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("重命名失败: %v", err)
+	}
+
+	scanner.Scan(ctx)
+
+	moved, _ := db.GetTaskByPath(newPath)
+	if moved == nil {
+		t.Fatal("重命名后应沿用原任务")
+	}
+	if moved.ID != task.ID {
+		t.Errorf("不应创建新任务: 原 #%d, 现 #%d", task.ID, moved.ID)
+	}
+	if moved.Status != database.StatusCompleted {
+		t.Errorf("任务状态不应改变: %s", moved.Status)
+	}
+	if old, _ := db.GetTaskByPath(oldPath); old != nil {
+		t.Error("旧路径的任务记录应已迁移")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "Movies", "b.mkv")); err != nil {
+		t.Errorf("输出文件未随源文件移动: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "a.mkv")); !os.IsNotExist(err) {
+		t.Error("旧输出文件应已移走")
+	}
+}
+
+func TestScanRenameKeepsOutputWhenMoveFails(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	outputDir := scanner.config.Path.Pairs[0].Output
+
+	oldPath := filepath.Join(inputDir, "a.mkv")
+	os.WriteFile(oldPath, []byte("movie content"), 0644)
+	scanner.Scan(context.Background())
+
+	task, _ := db.GetTaskByPath(oldPath)
+	if task == nil {
+		t.Fatal("任务未创建")
+	}
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "完成")
+	oldOutput := filepath.Join(outputDir, "a.mkv")
+	os.WriteFile(oldOutput, []byte("encoded"), 0644)
+
+	// 输出目录中同名的普通文件使新位置无法创建目录
+	os.WriteFile(filepath.Join(outputDir, "Movies"), []byte("blocker"), 0644)
+	os.MkdirAll(filepath.Join(inputDir, "Movies"), 0755)
+	newPath := filepath.Join(inputDir, "Movies", "b.mkv")
+	os.Rename(oldPath, newPath)
+
+	scanner.Scan(context.Background())
+
+	moved, _ := db.GetTaskByPath(newPath)
+	if moved == nil || moved.ID != task.ID {
+		t.Fatalf("重命名后应沿用原任务: %+v", moved)
+	}
+	if moved.OutputPath != oldOutput {
+		t.Errorf("移动失败时应记录旧输出路径: %q", moved.OutputPath)
+	}
+	if got := scanner.config.ExistingOutputPath(newPath, moved.OutputPath); got != oldOutput {
+		t.Errorf("任务应仍关联旧输出: %q", got)
+	}
+}
+
+func TestScanFlagsOrphanedTasks(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	keep := filepath.Join(inputDir, "keep.mp4")
+	gone := filepath.Join(inputDir, "gone.mp4")
+	os.WriteFile(keep, []byte("keep"), 0644)
+	os.WriteFile(gone, []byte("gone"), 0644)
+
+	ctx := context.Background()
+	scanner.Scan(ctx)
+
+	// 宽限期内只记录缺失时间
+	scanner.config.Cleaning.OrphanGraceHours = 1
+	os.Remove(gone)
+	scanner.Scan(ctx)
+
+	task, _ := db.GetTaskByPath(gone)
+	if task.Status == database.StatusOrphaned || task.MissingSince == nil {
+		t.Fatalf("宽限期内不应标记孤立: status=%s, missing_since=%v", task.Status, task.MissingSince)
+	}
+
+	// 宽限期结束后标记为孤立
+	scanner.config.Cleaning.OrphanGraceHours = 0
+	scanner.Scan(ctx)
+
+	task, _ = db.GetTaskByPath(gone)
+	if task.Status != database.StatusOrphaned {
+		t.Errorf("源文件删除后应标记为孤立，实际: %s", task.Status)
+	}
+	if kept, _ := db.GetTaskByPath(keep); kept.Status == database.StatusOrphaned {
+		t.Error("源文件仍在的任务不应标记为孤立")
+	}
+
+	// 源文件恢复后取消孤立标记
+	os.WriteFile(gone, []byte("gone"), 0644)
+	scanner.Scan(ctx)
+
+	task, _ = db.GetTaskByPath(gone)
+	if task.Status == database.StatusOrphaned || task.MissingSince != nil {
+		t.Errorf("源文件恢复后应取消孤立标记: status=%s", task.Status)
+	}
+}
+
+func TestScanOrphanOnlyTrustsCleanerRecords(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Cleaning.OrphanGraceHours = 0
+
+	trashed := filepath.Join(inputDir, "trashed.mp4")
+	deleted := filepath.Join(inputDir, "deleted.mp4")
+	os.WriteFile(trashed, []byte("trashed"), 0644)
+	os.WriteFile(deleted, []byte("deleted"), 0644)
+	os.WriteFile(filepath.Join(inputDir, "other.mp4"), []byte("other"), 0644)
+
+	ctx := context.Background()
+	scanner.Scan(ctx)
+	for _, path := range []string{trashed, deleted} {
+		task, _ := db.GetTaskByPath(path)
+		db.UpdateTaskStatus(task.ID, database.StatusCompleted, "完成")
+	}
+
+	// 清理模块移入垃圾桶（已写清单但未标记任务）与外部删除
+	task, _ := db.GetTaskByPath(trashed)
+	db.AddTrashItem(&database.TrashItem{TaskID: task.ID, OriginalPath: trashed, TrashPath: trashed + "_del", DeletedAt: time.Now()})
+	os.Remove(trashed)
+	os.Remove(deleted)
+	scanner.Scan(ctx)
+
+	if task, _ := db.GetTaskByPath(trashed); task.SourceRemovedAt == nil || task.Status == database.StatusOrphaned {
+		t.Errorf("有垃圾桶记录的源文件应记为已移除: status=%s", task.Status)
+	}
+	if task, _ := db.GetTaskByPath(deleted); task.Status != database.StatusOrphaned || task.SourceRemovedAt != nil {
+		t.Errorf("外部删除的源文件应标记为孤立: status=%s", task.Status)
+	}
+}
+
+func TestScanManyFilesInBatches(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Scanner.WalkWorkers = 3
+	scanner.config.Scanner.BatchSize = 7
+
+	var paths []string
+	for d := 0; d < 10; d++ {
+		dir := filepath.Join(inputDir, "show", string(rune('a'+d)), "season")
+		os.MkdirAll(dir, 0755)
+		for f := 0; f < 12; f++ {
+			path := filepath.Join(dir, string(rune('a'+f))+".mkv")
+			os.WriteFile(path, []byte(path), 0644)
+			paths = append(paths, path)
+		}
+	}
+	os.MkdirAll(filepath.Join(inputDir, "@eaDir"), 0755)
+	os.WriteFile(filepath.Join(inputDir, "@eaDir", "thumb.mp4"), []byte("x"), 0644)
+
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+
+	for _, path := range paths {
+		if task, _ := db.GetTaskByPath(path); task == nil {
+			t.Fatalf("任务未创建: %s", path)
+		}
+	}
+	stats, _ := db.GetStats()
+	if stats.PendingCount != len(paths) {
+		t.Errorf("任务数错误: 期望 %d, 实际 %d", len(paths), stats.PendingCount)
+	}
+
+	// 再次扫描不应产生新任务
+	scanner.Scan(context.Background())
+	stats, _ = db.GetStats()
+	if stats.PendingCount != len(paths) {
+		t.Errorf("重复扫描后任务数变化: %d", stats.PendingCount)
+	}
+}
+
+func TestScanMigratesLegacyRelativePaths(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	testFile := filepath.Join(inputDir, "old.mp4")
+	os.WriteFile(testFile, []byte("old"), 0644)
+	info, _ := os.Stat(testFile)
+
+	legacy := &database.Task{SourcePath: "old.mp4", SourceMtime: info.ModTime(), SourceSize: info.Size()}
+	db.CreateTask(legacy)
+
+	scanner.Scan(context.Background())
+
+	task, _ := db.GetTaskByPath(testFile)
+	if task == nil || task.ID != legacy.ID {
+		t.Fatalf("旧版本记录应迁移为完整路径: %+v", task)
+	}
+}
+
+func TestIncrementalScanSkipsUnchangedDirs(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Scanner.Incremental = true
+	scanner.config.Scanner.DeepScanHours = 24
+
+	dirA := filepath.Join(inputDir, "A")
+	dirB := filepath.Join(inputDir, "B", "nested")
+	os.MkdirAll(dirA, 0755)
+	os.MkdirAll(dirB, 0755)
+	os.WriteFile(filepath.Join(dirA, "a1.mp4"), []byte("a1"), 0644)
+	os.WriteFile(filepath.Join(dirB, "b1.mp4"), []byte("b1"), 0644)
+
+	// 目录 mtime 需早于当前时间才会被记录
+	old := time.Now().Add(-time.Hour)
+	for _, dir := range []string{inputDir, dirA, filepath.Join(inputDir, "B"), dirB} {
+		os.Chtimes(dir, old, old)
+	}
+
+	ctx := context.Background()
+	scanner.Scan(ctx) // 首次扫描为完整扫描，建立目录基线
+
+	// A 中新增文件（目录 mtime 变化）；B/nested 中新增文件但还原 mtime
+	a2 := filepath.Join(dirA, "a2.mp4")
+	b2 := filepath.Join(dirB, "b2.mp4")
+	os.WriteFile(a2, []byte("a2"), 0644)
+	os.WriteFile(b2, []byte("b2"), 0644)
+	os.Chtimes(dirB, old, old)
+
+	scanner.Scan(ctx)
+
+	if task, _ := db.GetTaskByPath(a2); task == nil {
+		t.Error("mtime 变化的目录中的新文件应被发现")
+	}
+	if task, _ := db.GetTaskByPath(b2); task != nil {
+		t.Error("增量扫描不应读取 mtime 未变化的目录")
+	}
+	if task, _ := db.GetTaskByPath(filepath.Join(dirB, "b1.mp4")); task == nil || task.Status == database.StatusOrphaned || task.MissingSince != nil {
+		t.Error("未变化目录中的已有任务不应被视为缺失")
+	}
+
+	// 完整扫描读取所有目录
+	scanner.ScanWithOptions(ctx, ScanOptions{Deep: true})
+	if task, _ := db.GetTaskByPath(b2); task == nil {
+		t.Error("完整扫描应发现所有文件")
+	}
+}
+
+func TestScanSubdirectoryOnly(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	dirA := filepath.Join(inputDir, "A")
+	dirB := filepath.Join(inputDir, "B")
+	os.MkdirAll(dirA, 0755)
+	os.MkdirAll(dirB, 0755)
+	a1 := filepath.Join(dirA, "a1.mp4")
+	b1 := filepath.Join(dirB, "b1.mp4")
+	os.WriteFile(a1, []byte("a1"), 0644)
+	os.WriteFile(b1, []byte("b1"), 0644)
+
+	ctx := context.Background()
+	if err := scanner.ScanWithOptions(ctx, ScanOptions{Path: dirA}); err != nil {
+		t.Fatalf("子目录扫描失败: %v", err)
+	}
+	if task, _ := db.GetTaskByPath(a1); task == nil {
+		t.Error("子目录中的文件应被发现")
+	}
+	if task, _ := db.GetTaskByPath(b1); task != nil {
+		t.Error("子目录扫描不应处理其他目录")
+	}
+
+	// 子目录扫描的孤立检测只覆盖该子目录
+	scanner.Scan(ctx)
+	os.Remove(b1)
+	scanner.ScanWithOptions(ctx, ScanOptions{Path: dirA})
+	if task, _ := db.GetTaskByPath(b1); task == nil || task.MissingSince != nil {
+		t.Error("子目录扫描不应检查其他目录的任务")
+	}
+
+	if err := scanner.ScanWithOptions(ctx, ScanOptions{Path: t.TempDir()}); err == nil {
+		t.Error("不属于任何配对的路径应返回错误")
+	}
+	if err := scanner.ScanWithOptions(ctx, ScanOptions{Pair: "/no/such/pair"}); err == nil {
+		t.Error("不存在的配对应返回错误")
+	}
+}
+
+func TestScanJobSingleFlight(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	os.WriteFile(filepath.Join(inputDir, "video.mp4"), []byte("v"), 0644)
+	pair := scanner.config.GetPairs()[0]
+
+	// 模拟该配对正在扫描
+	running, _ := scanner.jobs.acquire(pair, pair.Input, false, TriggerScheduled)
+	started, busy, err := scanner.StartScan(ScanOptions{})
+	if err != nil {
+		t.Fatalf("启动扫描失败: %v", err)
+	}
+	if len(started) != 0 || len(busy) != 1 || busy[0].ID != running.Info().ID {
+		t.Fatalf("配对扫描中时不应启动新任务: started=%d busy=%d", len(started), len(busy))
+	}
+	scanner.jobs.release(running)
+
+	started, _, err = scanner.StartScan(ScanOptions{})
+	if err != nil || len(started) != 1 {
+		t.Fatalf("配对空闲时应启动扫描: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := scanner.GetScanJob(started[0].ID)
+		if !ok {
+			t.Fatal("扫描任务应可查询")
+		}
+		if job.FinishedAt != nil {
+			if job.Status != ScanJobCompleted || job.Counts.New != 1 || job.Files != 1 {
+				t.Errorf("扫描任务结果不符: %+v", job)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("扫描任务未在预期时间内完成")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := scanner.CancelScanJob(started[0].ID); err != ErrScanJobFinished {
+		t.Errorf("已结束的任务不能取消: %v", err)
+	}
+	if err := scanner.CancelScanJob(999); err != ErrScanJobNotFound {
+		t.Errorf("不存在的任务应返回 ErrScanJobNotFound: %v", err)
+	}
+	if jobs := scanner.ListScanJobs(); len(jobs) != 2 || jobs[0].ID != started[0].ID {
+		t.Errorf("任务列表应按时间倒序: %+v", jobs)
+	}
+}
+
+func TestCancelScanJob(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	video := filepath.Join(inputDir, "video.mp4")
+	os.WriteFile(video, []byte("v"), 0644)
+
+	jobs, _, deep, err := scanner.prepareJobs(ScanOptions{}, TriggerManual)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("登记扫描任务失败: %v", err)
+	}
+	if err := scanner.CancelScanJob(jobs[0].Info().ID); err != nil {
+		t.Fatalf("取消排队中的任务失败: %v", err)
+	}
+	scanner.runJobs(context.Background(), jobs, ScanOptions{}, deep)
+
+	if info := jobs[0].Info(); info.Status != ScanJobCancelled {
+		t.Errorf("任务状态应为 cancelled，实际 %s", info.Status)
+	}
+	if task, _ := db.GetTaskByPath(video); task != nil {
+		t.Error("已取消的扫描不应写入任务")
+	}
+	if !scanner.lastDeepScan.IsZero() {
+		t.Error("取消的完整扫描不应更新完整扫描时间")
+	}
+	if len(scanner.jobs.active) != 0 {
+		t.Error("任务结束后应释放配对")
+	}
+}
+
+func TestShutdownCancelsScanJobs(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	os.WriteFile(filepath.Join(inputDir, "video.mp4"), []byte("v"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scanner.SetContext(ctx)
+
+	jobs, _, _, err := scanner.prepareJobs(ScanOptions{}, TriggerManual)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("登记扫描任务失败: %v", err)
+	}
+	cancel()
+	if jobs[0].ctx.Err() == nil {
+		t.Fatal("关闭时应取消未结束的扫描任务")
+	}
+
+	// 关闭后手动触发的扫描立即以取消结束，不写入数据库
+	scanner.jobs.release(jobs[0])
+	started, _, err := scanner.StartScan(ScanOptions{})
+	if err != nil || len(started) != 1 {
+		t.Fatalf("启动扫描失败: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, _ := scanner.GetScanJob(started[0].ID)
+		if info.FinishedAt != nil {
+			if info.Status != ScanJobCancelled {
+				t.Errorf("关闭后的扫描应为 cancelled，实际 %s", info.Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("扫描任务未结束")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if task, _ := db.GetTaskByPath(filepath.Join(inputDir, "video.mp4")); task != nil {
+		t.Error("关闭后的扫描不应写入任务")
+	}
+}
+
+func TestDryRunMatchesRenameAndStability(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+
+	oldPath := filepath.Join(inputDir, "a.mkv")
+	os.WriteFile(oldPath, []byte("movie content"), 0644)
+	scanner.Scan(context.Background())
+	os.MkdirAll(filepath.Join(inputDir, "Movies"), 0755)
+	os.Rename(oldPath, filepath.Join(inputDir, "Movies", "b.mkv"))
+
+	report, err := scanner.DryRun(context.Background(), inputDir)
+	if err != nil {
+		t.Fatalf("试运行失败: %v", err)
+	}
+	if report.Renamed != 1 || report.New != 0 || report.PendingBytes != 0 {
+		t.Fatalf("重命名的文件应沿用已有任务: %+v", report)
+	}
+
+	// 启用稳定性检测时新文件先进入观察期
+	scanner.config.Scanner.StableScans = 1
+	os.WriteFile(filepath.Join(inputDir, "c.mp4"), []byte("new"), 0644)
+	report, err = scanner.DryRun(context.Background(), inputDir)
+	if err != nil {
+		t.Fatalf("试运行失败: %v", err)
+	}
+	if report.Settling != 1 || report.New != 0 || report.PendingBytes != 3 {
+		t.Errorf("新文件应等待稳定: %+v", report)
+	}
+	if task, _ := db.GetTaskByPath(filepath.Join(inputDir, "Movies", "b.mkv")); task != nil {
+		t.Error("试运行不应迁移任务")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	scanner.config.Filter.MinSizeMB = 1
+
+	bigFile := func(path string) {
+		os.WriteFile(path, nil, 0644)
+		os.Truncate(path, 2*1024*1024)
+	}
+	done := filepath.Join(inputDir, "done.mp4")
+	bigFile(done)
+	scanner.Scan(context.Background())
+
+	// 已完成任务：输出存在，压缩比 0.25
+	task, _ := db.GetTaskByPath(done)
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+	db.UpdateTaskOutputSize(task.ID, task.SourceSize/4)
+	outputDir := scanner.config.GetPairs()[0].Output
+	os.WriteFile(filepath.Join(outputDir, "done.mp4"), []byte("out"), 0644)
+
+	newFile := filepath.Join(inputDir, "sub", "new.mkv")
+	os.MkdirAll(filepath.Dir(newFile), 0755)
+	bigFile(newFile)
+	os.WriteFile(filepath.Join(inputDir, "tiny.mp4"), []byte("tiny"), 0644)
+
+	// 被排除的目录：其中的视频文件应记为命中目录规则
+	scanner.config.Filter.Exclude = []string{"Samples/"}
+	sample := filepath.Join(inputDir, "Samples", "clip.mkv")
+	os.MkdirAll(filepath.Dir(sample), 0755)
+	bigFile(sample)
+
+	report, err := scanner.DryRun(context.Background(), inputDir)
+	if err != nil {
+		t.Fatalf("试运行失败: %v", err)
+	}
+	if !report.Configured || report.New != 1 || report.Skip != 1 || report.Excluded != 2 || report.Update != 0 {
+		t.Fatalf("试运行计数错误: %+v", report)
+	}
+	if report.RatioSamples != 1 || report.EstimatedOutputBytes != report.PendingBytes/4 {
+		t.Errorf("预计输出大小应按历史压缩比估算: ratio=%.2f estimated=%d", report.OutputRatio, report.EstimatedOutputBytes)
+	}
+	for _, item := range report.Items {
+		if item.Action == DryRunExcluded && item.Rule == "" {
+			t.Error("排除的文件应给出命中的规则")
+		}
+		if item.Path == sample && (item.Action != DryRunExcluded || item.Rule != "exclude:Samples/") {
+			t.Errorf("排除目录中的文件应记为命中目录规则: %+v", item)
+		}
+	}
+	if task, _ := db.GetTaskByPath(newFile); task != nil {
+		t.Error("试运行不应写入数据库")
+	}
+
+	var buf strings.Builder
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("输出 CSV 失败: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 5 {
+		t.Errorf("CSV 应包含表头和 4 个文件，实际 %d 行", lines)
+	}
+
+	// 尚未配置的目录使用全局规则
+	other := t.TempDir()
+	bigFile(filepath.Join(other, "a.mp4"))
+	report, err = scanner.DryRun(context.Background(), other)
+	if err != nil || report.Configured || report.New != 1 {
+		t.Errorf("未配置目录的试运行结果错误: %+v, %v", report, err)
+	}
+
+	// 没有数据库时（命令行试运行且数据库尚未创建）全部按新文件处理
+	report, err = New(scanner.config, nil).DryRun(context.Background(), other)
+	if err != nil || report.New != 1 || report.RatioSamples != 0 {
+		t.Errorf("无数据库的试运行结果错误: %+v, %v", report, err)
+	}
+}
+
+func TestScanAdoptExistingOutput(t *testing.T) {
+	scanner, db, inputDir := setupTestScanner(t)
+	defer db.Close()
+	outputDir := scanner.config.Path.Pairs[0].Output
+	ctx := context.Background()
+
+	// 无法通过校验的输出（非视频内容）：按新文件排队
+	os.WriteFile(filepath.Join(inputDir, "broken.mp4"), []byte("source"), 0644)
+	os.WriteFile(filepath.Join(outputDir, "broken.mp4"), []byte("not a video"), 0644)
+	if err := scanner.ScanWithOptions(ctx, ScanOptions{Deep: true, Adopt: true}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	task, _ := db.GetTaskByPath(filepath.Join(inputDir, "broken.mp4"))
+	if task == nil || task.Status != database.StatusPending {
+		t.Fatalf("未通过校验的输出不应被收养: %+v", task)
+	}
+
+	// 已通过校验的输出：直接记为已完成，记录输出大小与来源
+	source := filepath.Join(inputDir, "movie.mkv")
+	output := filepath.Join(outputDir, "movie.mkv")
+	os.WriteFile(source, []byte("source"), 0644)
+	info, _ := os.Stat(source)
+	entry := &scanEntry{
+		fullPath: source,
+		relPath:  "movie.mkv",
+		mtime:    info.ModTime(),
+		size:     info.Size(),
+		adopted:  &adoption{outputPath: output, size: 1234},
+	}
+	if action := scanner.processFile(db, scanner.config.Path.Pairs[0], entry, scanner.loadLegacyIndex()); action != "adopted" {
+		t.Fatalf("processFile() = %s, want adopted", action)
+	}
+	task, _ = db.GetTaskByPath(source)
+	if task == nil || task.Status != database.StatusCompleted || task.OutputSize != 1234 ||
+		task.CompletedAt == nil || !strings.Contains(task.GetLog(), output) {
+		t.Errorf("收养的任务错误: %+v", task)
+	}
+}
@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+// checkSettling 检查观察期中的文件是否已稳定，稳定后转为待处理
+// openForWriting 为并行阶段检查的写入进程结果（check_open_writers 关闭时恒为 false）
+func (s *Scanner) checkSettling(store taskStore, task *database.Task, mtime time.Time, size int64, openForWriting bool) string {
+	now := time.Now()
+
+	// 大小或mtime仍在变化：重新开始计时
+	if !task.SourceMtime.Equal(mtime) || task.SourceSize != size {
+		if err := store.UpdateSettlingState(task.ID, mtime, size, 0, now); err != nil {
+			log.Printf("[Scanner] 更新观察状态失败 %s: %v", task.SourcePath, err)
+			return "error"
+		}
+		return "settling"
+	}
+
+	since := now
+	if task.StableSince != nil {
+		since = *task.StableSince
+	}
+	stableScans := task.StableScans + 1
+
+	stable := s.isStable(since, stableScans, now)
+	if stable && openForWriting {
+		log.Printf("[Scanner] 文件仍被其他进程写入，继续等待: %s", task.SourcePath)
+		stable = false
+	}
+
+	if !stable {
+		if err := store.UpdateSettlingState(task.ID, mtime, size, stableScans, since); err != nil {
+			log.Printf("[Scanner] 更新观察状态失败 %s: %v", task.SourcePath, err)
+			return "error"
+		}
+		return "settling"
+	}
+
+	if err := store.PromoteSettledTask(task.ID); err != nil {
+		log.Printf("[Scanner] 文件稳定后入队失败 %s: %v", task.SourcePath, err)
+		return "error"
+	}
+	log.Printf("[Scanner] 文件已稳定，加入队列: %s (观察 %v, %d 次扫描)",
+		task.SourcePath, now.Sub(since).Round(time.Second), stableScans)
+	return "new"
+}
+
+// isStable 静默期或连续扫描次数任一条件满足即视为稳定
+func (s *Scanner) isStable(since time.Time, stableScans int, now time.Time) bool {
+	cfg := s.config.Scanner
+	if cfg.StableSeconds <= 0 && cfg.StableScans <= 0 {
+		// 仅启用了写入进程检测
+		return true
+	}
+	if cfg.StableSeconds > 0 && now.Sub(since) >= time.Duration(cfg.StableSeconds)*time.Second {
+		return true
+	}
+	if cfg.StableScans > 0 && stableScans >= cfg.StableScans {
+		return true
+	}
+	return false
+}
+
+// isFileOpenForWriting 通过 /proc 检查是否有进程以写模式打开该文件
+// 非 Linux 系统或无权限读取时返回 false
+func isFileOpenForWriting(path string) bool {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false
+	}
+
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || target != path {
+				continue
+			}
+			if fdOpenedForWrite(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name())) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// fdOpenedForWrite 解析 fdinfo 中的 flags（八进制），判断访问模式是否包含写
+func fdOpenedForWrite(fdinfoPath string) bool {
+	data, err := os.ReadFile(fdinfoPath)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "flags:") {
+			continue
+		}
+		flags, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64)
+		if err != nil {
+			return false
+		}
+		accMode := flags & int64(os.O_WRONLY|os.O_RDWR)
+		return accMode == int64(os.O_WRONLY) || accMode == int64(os.O_RDWR)
+	}
+
+	return false
+}
@@ -0,0 +1,320 @@
+package scanner
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/filter"
+)
+
+// dirQueue 并行遍历的目录队列，pending 为已入队但尚未处理完的目录数
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	dirs    []string
+	pending int
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(dir string) {
+	q.mu.Lock()
+	q.dirs = append(q.dirs, dir)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop 取出一个目录，所有目录处理完毕时返回 false
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.dirs) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return "", false
+	}
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dir, true
+}
+
+// done 标记一个目录处理完毕（其子目录已入队）
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	finished := q.pending == 0
+	q.mu.Unlock()
+	if finished {
+		q.cond.Broadcast()
+	}
+}
+
+// walkParallel 以有限并发遍历目录树
+// processDir 处理单个目录并返回需要继续遍历的子目录，会被多个协程并发调用
+// 根目录无法访问时返回错误，其余目录的错误由 processDir 自行记录
+func walkParallel(ctx context.Context, root string, workers int, processDir func(dir string) []string) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	queue := newDirQueue()
+	queue.push(root)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := queue.pop()
+				if !ok {
+					return
+				}
+				if ctx.Err() == nil {
+					for _, sub := range processDir(dir) {
+						queue.push(sub)
+					}
+				}
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// dirMtimeSettle 刚修改过的目录不记录 mtime：同一时间粒度内的后续修改无法通过 mtime 发现
+const dirMtimeSettle = 2 * time.Second
+
+// pairWalk 单个配对的一次遍历
+type pairWalk struct {
+	s      *Scanner
+	job    *ScanJob
+	ctx    context.Context
+	pair   config.InputOutputPair
+	rules  *filter.Filter
+	index  map[string]*database.Task
+	legacy *legacyIndex
+	out    chan<- *scanEntry
+	adopt  bool // 收养模式
+
+	// 增量扫描状态（遍历期间只读）
+	incremental bool
+	known       map[string]*database.ScanDir // 上次记录的目录状态
+	children    map[string][]string          // 上次记录的子目录
+	settling    map[string][]*database.Task  // 观察期中的任务（按所在目录），目录未变化时也需检查
+
+	mu        sync.Mutex
+	visited   map[string]struct{} // 本次访问（读取或跳过）的目录
+	unchanged map[string]struct{} // mtime 未变化、未读取的目录
+	updated   []*database.ScanDir // 本次读取的目录，遍历结束后写入
+}
+
+// newPairWalk 创建遍历状态，增量模式下载入上次记录的目录 mtime
+func (s *Scanner) newPairWalk(job *ScanJob, rules *filter.Filter, index map[string]*database.Task,
+	legacy *legacyIndex, out chan<- *scanEntry, incremental bool) *pairWalk {
+
+	w := &pairWalk{
+		s:           s,
+		job:         job,
+		ctx:         job.ctx,
+		pair:        job.pair,
+		rules:       rules,
+		index:       index,
+		legacy:      legacy,
+		out:         out,
+		adopt:       job.Info().Adopt,
+		incremental: incremental,
+		known:       make(map[string]*database.ScanDir),
+		children:    make(map[string][]string),
+		settling:    make(map[string][]*database.Task),
+		visited:     make(map[string]struct{}),
+		unchanged:   make(map[string]struct{}),
+	}
+
+	dirs, err := s.db.GetScanDirs(job.root)
+	if err != nil {
+		log.Printf("[Scanner] 读取目录记录失败，执行完整扫描 %s: %v", job.root, err)
+		w.incremental = false
+		return w
+	}
+	for _, dir := range dirs {
+		w.known[dir.Path] = dir
+		w.children[dir.Parent] = append(w.children[dir.Parent], dir.Path)
+	}
+	for _, task := range index {
+		if task.Status == database.StatusSettling {
+			dir := filepath.Dir(task.SourcePath)
+			w.settling[dir] = append(w.settling[dir], task)
+		}
+	}
+	return w
+}
+
+// processDir 处理单个目录：mtime 未变化时只检查已知子目录，否则读取目录内容
+func (w *pairWalk) processDir(dir string) []string {
+	info, err := os.Stat(dir)
+	if err != nil {
+		log.Printf("[Scanner] 访问路径失败 %s: %v", dir, err)
+		return nil
+	}
+
+	w.mu.Lock()
+	w.visited[dir] = struct{}{}
+	w.mu.Unlock()
+	w.job.enterDir(dir)
+
+	if w.incremental {
+		if rec := w.known[dir]; rec != nil && !rec.Mtime.IsZero() && rec.Mtime.Equal(info.ModTime()) {
+			w.mu.Lock()
+			w.unchanged[dir] = struct{}{}
+			w.mu.Unlock()
+
+			w.emitSettling(dir)
+
+			var subdirs []string
+			for _, child := range w.children[dir] {
+				if relPath, err := filepath.Rel(w.pair.Input, child); err == nil && w.enterDir(child, relPath) {
+					subdirs = append(subdirs, child)
+				}
+			}
+			return subdirs
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("[Scanner] 访问路径失败 %s: %v", dir, err)
+		return nil
+	}
+
+	var subdirs []string
+	files := 0
+	for _, d := range entries {
+		path := filepath.Join(dir, d.Name())
+		relPath, err := filepath.Rel(w.pair.Input, path)
+		if err != nil {
+			log.Printf("[Scanner] 计算相对路径失败 %s: %v", path, err)
+			continue
+		}
+
+		if d.IsDir() {
+			if w.enterDir(path, relPath) {
+				subdirs = append(subdirs, path)
+			}
+			continue
+		}
+		files++
+		w.visitFile(path, relPath, d)
+	}
+
+	now := time.Now()
+	mtime := info.ModTime()
+	if now.Sub(mtime) < dirMtimeSettle {
+		mtime = time.Time{}
+	}
+	w.mu.Lock()
+	w.updated = append(w.updated, &database.ScanDir{
+		Path:      dir,
+		Parent:    filepath.Dir(dir),
+		Mtime:     mtime,
+		FileCount: files,
+		ScannedAt: now,
+	})
+	w.mu.Unlock()
+
+	return subdirs
+}
+
+// enterDir 检查是否需要进入该子目录
+func (w *pairWalk) enterDir(path, relPath string) bool {
+	if decision := w.rules.CheckDir(relPath); !decision.Accepted {
+		log.Printf("[Scanner] 跳过目录: %s (%s)", path, decision.Rule)
+		return false
+	}
+	return true
+}
+
+// visitFile 过滤并准备单个文件，交给写入协程
+func (w *pairWalk) visitFile(path, relPath string, d fs.DirEntry) {
+	// 检查是否为视频文件
+	if !w.s.config.IsVideoFile(path) {
+		return
+	}
+
+	// 获取文件信息
+	info, err := d.Info()
+	if err != nil {
+		log.Printf("[Scanner] 获取文件信息失败 %s: %v", path, err)
+		return
+	}
+	w.emit(path, relPath, info)
+}
+
+// emitSettling 目录未变化时仍需检查观察期中的文件（写入中的文件不会改变目录 mtime）
+func (w *pairWalk) emitSettling(dir string) {
+	for _, task := range w.settling[dir] {
+		info, err := os.Stat(task.SourcePath)
+		if err != nil {
+			continue // 已删除：由孤立检测处理
+		}
+		relPath, err := filepath.Rel(w.pair.Input, task.SourcePath)
+		if err != nil {
+			continue
+		}
+		w.emit(task.SourcePath, relPath, info)
+	}
+}
+
+// emit 过滤文件并完成并行阶段的准备工作
+func (w *pairWalk) emit(path, relPath string, info os.FileInfo) {
+	entry := &scanEntry{
+		fullPath: path,
+		relPath:  relPath,
+		mtime:    info.ModTime(),
+		size:     info.Size(),
+	}
+
+	// 文件过滤
+	if decision := w.rules.CheckFile(relPath, info.Size()); !decision.Accepted {
+		entry.excluded = true
+	} else {
+		w.s.prepareEntry(w.pair, entry, w.rules, w.index, w.legacy, w.adopt)
+	}
+
+	select {
+	case w.out <- entry:
+	case <-w.ctx.Done():
+	}
+}
+
+// saveDirs 遍历完成后保存目录状态，删除本次未访问到的旧记录
+func (w *pairWalk) saveDirs() {
+	var removed []string
+	for path := range w.known {
+		if _, ok := w.visited[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	if err := w.s.db.SaveScanDirs(w.updated, removed); err != nil {
+		log.Printf("[Scanner] 保存目录状态失败 %s: %v", w.pair.Input, err)
+	}
+}
@@ -0,0 +1,506 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// ErrRunning 已有校验任务在运行
+var ErrRunning = errors.New("输出校验正在运行")
+
+// RunSummary 一轮校验的统计
+type RunSummary struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Checked    int        `json:"checked"`
+	OK         int        `json:"ok"`
+	Missing    int        `json:"missing"`
+	Corrupt    int        `json:"corrupt"`
+	Mismatch   int        `json:"mismatch"`
+	Errors     int        `json:"errors"`
+}
+
+func (r *RunSummary) add(result database.VerifyResult) {
+	r.Checked++
+	switch result {
+	case database.VerifyOK:
+		r.OK++
+	case database.VerifyMissing:
+		r.Missing++
+	case database.VerifyCorrupt:
+		r.Corrupt++
+	case database.VerifyMismatch:
+		r.Mismatch++
+	default:
+		r.Errors++
+	}
+}
+
+// Verifier 已完成任务输出文件的定期校验
+// 按 id 游标分页读取到期的任务，有限并发探测，损坏的输出移入隔离目录而不是删除
+type Verifier struct {
+	config *config.Config
+	db     *database.DB
+
+	idle func() bool // 是否没有转码任务（用于决定是否完整解码）
+
+	mu      sync.Mutex
+	current *RunSummary // 进行中的一轮
+	last    *RunSummary // 最近完成的一轮
+}
+
+// New 创建校验器实例
+func New(cfg *config.Config, db *database.DB) *Verifier {
+	return &Verifier{
+		config: cfg,
+		db:     db,
+	}
+}
+
+// SetIdleCheck 设置空闲判断，未设置时不做完整解码
+func (v *Verifier) SetIdleCheck(idle func() bool) {
+	v.idle = idle
+}
+
+// Run 周期性执行校验
+func (v *Verifier) Run(ctx context.Context) {
+	if !v.config.FFmpeg.StrictCheck {
+		log.Println("[Verifier] strict_check 未开启，不执行输出校验")
+		return
+	}
+
+	interval := time.Duration(v.config.Verify.IntervalMinutes) * time.Minute
+	log.Printf("[Verifier] 输出校验启动，间隔: %v，复检周期: %d 天，并发: %d",
+		interval, v.config.Verify.ReverifyDays, v.config.Verify.Workers)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := v.RunOnce(ctx); err != nil && !errors.Is(err, ErrRunning) && ctx.Err() == nil {
+			log.Printf("[Verifier] 输出校验失败: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("[Verifier] 收到停止信号，停止输出校验")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status 返回进行中的一轮（如有）或最近完成的一轮
+func (v *Verifier) Status() *RunSummary {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch {
+	case v.current != nil:
+		summary := *v.current
+		return &summary
+	case v.last != nil:
+		summary := *v.last
+		return &summary
+	}
+	return nil
+}
+
+// RunOnce 校验所有到期的输出，已有一轮在运行时返回 ErrRunning
+func (v *Verifier) RunOnce(ctx context.Context) (*RunSummary, error) {
+	v.mu.Lock()
+	if v.current != nil {
+		v.mu.Unlock()
+		return nil, ErrRunning
+	}
+	v.current = &RunSummary{Running: true, StartedAt: time.Now()}
+	v.mu.Unlock()
+
+	err := v.verifyDue(ctx)
+
+	v.mu.Lock()
+	now := time.Now()
+	summary := v.current
+	summary.Running = false
+	summary.FinishedAt = &now
+	v.current = nil
+	v.last = summary
+	v.mu.Unlock()
+
+	if summary.Checked > 0 {
+		log.Printf("[Verifier] 输出校验完成: checked=%d, ok=%d, missing=%d, corrupt=%d, mismatch=%d, errors=%d, 耗时 %v",
+			summary.Checked, summary.OK, summary.Missing, summary.Corrupt, summary.Mismatch, summary.Errors,
+			now.Sub(summary.StartedAt).Round(time.Second))
+	}
+
+	v.pruneHistory()
+	return summary, err
+}
+
+// verifyDue 按 id 游标分页读取到期任务并交给固定数量的协程校验
+// 游标不受校验过程中任务状态变化（重新入队）的影响
+func (v *Verifier) verifyDue(ctx context.Context) error {
+	cutoff := time.Now().AddDate(0, 0, -v.config.Verify.ReverifyDays)
+	tasks := make(chan *database.Task)
+
+	var wg sync.WaitGroup
+	for i := 0; i < v.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				result := v.verifyTask(task)
+				v.mu.Lock()
+				v.current.add(result)
+				v.mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	var afterID int64
+produce:
+	for {
+		var batch []*database.Task
+		batch, err = v.db.GetTasksToVerify(afterID, cutoff, v.batchSize())
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		for _, task := range batch {
+			select {
+			case tasks <- task:
+			case <-ctx.Done():
+				err = ctx.Err()
+				break produce
+			}
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+	close(tasks)
+	wg.Wait()
+	return err
+}
+
+// verifyTask 校验单个任务的输出并记录结果
+func (v *Verifier) verifyTask(task *database.Task) database.VerifyResult {
+	start := time.Now()
+	record := &database.Verification{
+		TaskID:     task.ID,
+		SourcePath: task.SourcePath,
+		VerifiedAt: start,
+	}
+	record.Result = v.check(task, record)
+	record.DurationMs = time.Since(start).Milliseconds()
+
+	// 除校验出错（下次重试）外都记录校验时间：任务无法重新入队时（如源文件已移除）
+	// 在复检周期内不再重复校验，每轮的工作量不会累积
+	if record.Result != database.VerifyError {
+		if err := v.db.MarkTaskVerified(task.ID, record.VerifiedAt); err != nil {
+			log.Printf("[Verifier] 记录校验时间失败 %s: %v", task.SourcePath, err)
+		}
+	}
+
+	if err := v.db.AddVerification(record); err != nil {
+		log.Printf("[Verifier] 保存校验记录失败 %s: %v", task.SourcePath, err)
+	}
+	return record.Result
+}
+
+// check 执行校验，结果细节写入 record
+func (v *Verifier) check(task *database.Task, record *database.Verification) database.VerifyResult {
+	outputPath, err := v.locateOutput(task)
+	record.OutputPath = outputPath
+	if err != nil {
+		if !os.IsNotExist(err) {
+			record.Error = err.Error()
+			return database.VerifyError
+		}
+
+		if err := v.resetTaskForRecode(task, "输出文件缺失，重新转码"); err != nil {
+			log.Printf("[Verifier] 重置任务失败 %s: %v", task.SourcePath, err)
+			record.Error = err.Error()
+		} else {
+			log.Printf("[Verifier] 输出文件缺失，重新转码: %s", task.SourcePath)
+		}
+		return database.VerifyMissing
+	}
+
+	if err := v.probe(outputPath); err != nil {
+		// ffprobe 不可用或超时（如存储繁忙）无法说明文件损坏，下次重试
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("[Verifier] 无法校验输出文件 %s: %v", outputPath, err)
+			record.Error = err.Error()
+			return database.VerifyError
+		}
+
+		log.Printf("[Verifier] 输出文件损坏: %s, err=%v", outputPath, err)
+		record.Error = err.Error()
+		v.handleCorrupt(task, outputPath, record)
+		return database.VerifyCorrupt
+	}
+
+	if err := v.checkParity(task, outputPath); err != nil {
+		record.Error = err.Error()
+		if !errors.Is(err, media.ErrParity) {
+			log.Printf("[Verifier] 无法检查输出一致性 %s: %v", outputPath, err)
+			return database.VerifyError
+		}
+
+		// 输出可以播放但被截断或丢轨：保留文件，任务标记为失败等待人工处理
+		log.Printf("[Verifier] 输出与源文件不一致: %s, err=%v", outputPath, err)
+		if err := v.db.UpdateTaskStatus(task.ID, database.StatusFailed, record.Error); err != nil {
+			log.Printf("[Verifier] 更新任务状态失败 %s: %v", task.SourcePath, err)
+		}
+		return database.VerifyMismatch
+	}
+
+	return database.VerifyOK
+}
+
+// handleCorrupt 隔离损坏的输出并重新入队
+// 源文件已被清理模块移走时先从垃圾桶恢复再隔离；无法恢复时输出可能是唯一的副本，保留原文件，
+// 并阻止垃圾桶中的源文件被自动删除。这两种情况都告警并将任务标记为失败，等待人工处理
+func (v *Verifier) handleCorrupt(task *database.Task, outputPath string, record *database.Verification) {
+	_, statErr := os.Stat(task.SourcePath)
+	sourceGone := task.SourceRemovedAt != nil || os.IsNotExist(statErr)
+	if sourceGone {
+		if err := v.restoreSource(task); err != nil {
+			log.Printf("[Verifier] 恢复源文件失败，保留损坏的输出 %s: %v", outputPath, err)
+			v.failCorrupt(task, outputPath, record, "输出文件损坏且源文件无法恢复，已保留输出文件: "+err.Error())
+			return
+		}
+		log.Printf("[Verifier] 源文件已从垃圾桶恢复: %s", task.SourcePath)
+	}
+
+	// 先隔离再重新入队：隔离失败时保留原文件，避免重新转码覆盖
+	quarantined, err := v.quarantine(task, outputPath)
+	if err != nil {
+		log.Printf("[Verifier] 隔离损坏输出失败 %s: %v", outputPath, err)
+		record.Error += "; 隔离失败: " + err.Error()
+		if sourceGone {
+			v.failCorrupt(task, outputPath, record, "输出文件损坏，源文件已从垃圾桶恢复，隔离输出失败: "+err.Error())
+		}
+		return
+	}
+	record.QuarantinePath = quarantined
+	log.Printf("[Verifier] 损坏输出已隔离: %s -> %s", outputPath, quarantined)
+
+	if sourceGone {
+		v.failCorrupt(task, outputPath, record, "输出文件损坏，已隔离，源文件已从垃圾桶恢复")
+		return
+	}
+	if err := v.resetTaskForRecode(task, "输出文件损坏，已隔离并重新转码"); err != nil {
+		log.Printf("[Verifier] 重置任务失败 %s: %v", task.SourcePath, err)
+		record.Error += "; " + err.Error()
+	}
+}
+
+// restoreSource 将清理模块移入垃圾桶的源文件移回原位置，无法恢复时阻止该文件被自动彻底删除
+func (v *Verifier) restoreSource(task *database.Task) error {
+	if _, err := os.Stat(task.SourcePath); err == nil {
+		return fmt.Errorf("原位置已有文件: %s", task.SourcePath)
+	}
+
+	items, err := v.db.GetTrashedItemsByTask(task.ID, database.TrashReasonCleanup)
+	if err != nil {
+		return fmt.Errorf("查询垃圾桶清单失败: %w", err)
+	}
+	var item *database.TrashItem
+	for _, it := range items {
+		if it.OriginalPath == task.SourcePath {
+			item = it
+			break
+		}
+	}
+	if item == nil {
+		return fmt.Errorf("垃圾桶中没有源文件（可能已归档或彻底删除）")
+	}
+
+	err = os.MkdirAll(filepath.Dir(task.SourcePath), 0755)
+	if err == nil {
+		opts := fileutil.Options{BytesPerSecond: int64(v.config.Cleaning.MoveBandwidthMB * 1024 * 1024)}
+		_, err = fileutil.Move(item.TrashPath, task.SourcePath, opts)
+	}
+	if err != nil {
+		if hErr := v.db.HoldTrashItem(item.ID, "对应任务的输出文件损坏，源文件恢复失败"); hErr != nil {
+			log.Printf("[Verifier] 保留垃圾桶文件失败 %s: %v", item.TrashPath, hErr)
+		}
+		return fmt.Errorf("从垃圾桶恢复失败（已阻止自动删除 %s）: %w", item.TrashPath, err)
+	}
+
+	if err := v.db.ResolveTrashItem(item.ID, database.TrashRestored); err != nil {
+		log.Printf("[Verifier] 更新垃圾桶清单失败 %s: %v", item.TrashPath, err)
+	}
+	if err := v.db.ClearSourceRemoved(task.ID); err != nil {
+		log.Printf("[Verifier] 清除源文件移除标记失败 %s: %v", task.SourcePath, err)
+	}
+	return nil
+}
+
+// failCorrupt 损坏输出需要人工处理：告警并将任务标记为失败
+func (v *Verifier) failCorrupt(task *database.Task, outputPath string, record *database.Verification, reason string) {
+	if err := v.db.RaiseAlert(database.AlertCorruptOutput, task.ID, outputPath, reason); err != nil {
+		log.Printf("[Verifier] 记录告警失败 %s: %v", outputPath, err)
+	}
+	if err := v.db.UpdateTaskStatus(task.ID, database.StatusFailed, reason); err != nil {
+		log.Printf("[Verifier] 更新任务状态失败 %s: %v", task.SourcePath, err)
+	}
+	record.Error += "; " + reason
+}
+
+// checkParity 比较输出与源文件的时长和流数量，源文件已不存在或无法读取时跳过
+func (v *Verifier) checkParity(task *database.Task, outputPath string) error {
+	if _, err := os.Stat(task.SourcePath); err != nil {
+		return nil // 源文件已被清理模块移除
+	}
+
+	probeTimeout := time.Duration(v.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	sourceInfo, err := media.ProbeInfo(task.SourcePath, probeTimeout)
+	if err != nil {
+		log.Printf("[Verifier] 读取源文件信息失败，跳过一致性检查 %s: %v", task.SourcePath, err)
+		return nil
+	}
+	outputInfo, err := media.ProbeInfo(outputPath, probeTimeout)
+	if err != nil {
+		return err
+	}
+
+	encode, _ := v.config.ResolveProfile(task.Profile)
+	return outputInfo.CheckParity(v.config.Expectation(encode, sourceInfo))
+}
+
+// locateOutput 查找任务的输出文件（优先统一扩展名后的路径），不存在时返回 os.ErrNotExist
+func (v *Verifier) locateOutput(task *database.Task) (string, error) {
+	basePath, ok := v.config.ResolveOutputBase(task.SourcePath, task.OutputPath)
+	if !ok {
+		return "", fmt.Errorf("无法确定输出路径（源文件不属于任何监控目录）")
+	}
+
+	primaryPath := v.config.ApplyOutputExtension(basePath)
+	candidates := []string{primaryPath}
+	if basePath != primaryPath {
+		candidates = append(candidates, basePath)
+	}
+	for _, path := range candidates {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return path, fmt.Errorf("输出文件访问失败: %w", err)
+		}
+	}
+	return primaryPath, os.ErrNotExist
+}
+
+// probe 探测输出文件并抽样解码首尾片段
+func (v *Verifier) probe(path string) error {
+	probeTimeout := time.Duration(v.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	if err := media.ProbeFile(path, probeTimeout, 0); err != nil {
+		return err
+	}
+
+	decodeSeconds := v.config.FFmpeg.VerifyDecodeSeconds
+	if decodeSeconds <= 0 {
+		return nil
+	}
+	if err := media.DecodeSegmentStrict(path, probeTimeout, 0, decodeSeconds); err != nil {
+		return err
+	}
+	if v.config.FFmpeg.VerifyTailSeekSeconds > 0 {
+		if err := media.DecodeSegmentStrict(path, probeTimeout, v.config.FFmpeg.VerifyTailSeekSeconds, decodeSeconds); err != nil {
+			return err
+		}
+	}
+
+	// 完整解码耗时与视频时长相当，只在没有转码任务时进行
+	if v.config.Verify.FullDecodeWhenIdle && v.idle != nil && v.idle() {
+		timeout := probeTimeout
+		if info, err := media.ProbeInfo(path, probeTimeout); err == nil {
+			timeout += time.Duration(info.Duration * float64(time.Second))
+		}
+		return media.DecodeFull(path, timeout)
+	}
+	return nil
+}
+
+// quarantine 将损坏的输出移入配对输出目录下的隔离目录，保留相对路径
+func (v *Verifier) quarantine(task *database.Task, outputPath string) (string, error) {
+	dest := filepath.Join(filepath.Dir(outputPath), v.config.Verify.QuarantineDir, filepath.Base(outputPath))
+	if pair, _, ok := v.config.FindPair(task.SourcePath); ok {
+		if rel, err := filepath.Rel(pair.Output, outputPath); err == nil && !strings.HasPrefix(rel, "..") {
+			dest = filepath.Join(pair.Output, v.config.Verify.QuarantineDir, rel)
+		}
+	}
+
+	// 同名文件已在隔离区时追加时间戳
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = strings.TrimSuffix(dest, ext) + "." + time.Now().Format("20060102-150405") + ext
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(outputPath, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// resetTaskForRecode 源文件仍存在时将任务重新入队
+func (v *Verifier) resetTaskForRecode(task *database.Task, reason string) error {
+	info, err := os.Stat(task.SourcePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("源文件不存在，无法重新转码（由孤立检测处理）: %w", err)
+		}
+		return err
+	}
+
+	if err := v.db.ResetTaskToPending(task.SourcePath, info.ModTime(), info.Size()); err != nil {
+		return err
+	}
+	return v.db.UpdateTaskStatus(task.ID, database.StatusPending, reason)
+}
+
+// pruneHistory 删除超过保留期的校验记录
+func (v *Verifier) pruneHistory() {
+	if v.config.Verify.HistoryDays <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -v.config.Verify.HistoryDays)
+	if n, err := v.db.DeleteVerificationsBefore(cutoff); err != nil {
+		log.Printf("[Verifier] 清理校验记录失败: %v", err)
+	} else if n > 0 {
+		log.Printf("[Verifier] 已清理 %d 条过期校验记录", n)
+	}
+}
+
+func (v *Verifier) workers() int {
+	if v.config.Verify.Workers > 0 {
+		return v.config.Verify.Workers
+	}
+	return 2
+}
+
+func (v *Verifier) batchSize() int {
+	if v.config.Verify.BatchSize > 0 {
+		return v.config.Verify.BatchSize
+	}
+	return 100
+}
@@ -0,0 +1,243 @@
+package verifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+)
+
+func setupTestVerifier(t *testing.T) (*Verifier, *database.DB, config.InputOutputPair) {
+	tmpDir := t.TempDir()
+	pair := config.InputOutputPair{
+		Input:  filepath.Join(tmpDir, "input"),
+		Output: filepath.Join(tmpDir, "output"),
+	}
+	os.MkdirAll(pair.Input, 0755)
+	os.MkdirAll(pair.Output, 0755)
+
+	cfg := &config.Config{
+		Path:   config.PathConfig{Pairs: []config.InputOutputPair{pair}},
+		FFmpeg: config.FFmpegConfig{StrictCheck: true, ProbeTimeoutSeconds: 5},
+		Verify: config.VerifyConfig{
+			ReverifyDays:  30,
+			Workers:       2,
+			BatchSize:     1, // 每页一条，覆盖游标分页
+			QuarantineDir: ".stm_quarantine",
+			HistoryDays:   90,
+		},
+	}
+
+	db, err := database.Init(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	return New(cfg, db), db, pair
+}
+
+// createCompleted 创建源文件与已完成任务，output 非空时写入输出文件
+func createCompleted(t *testing.T, db *database.DB, pair config.InputOutputPair, name, output string) *database.Task {
+	source := filepath.Join(pair.Input, name)
+	os.WriteFile(source, []byte("source"), 0644)
+	info, _ := os.Stat(source)
+
+	task := &database.Task{SourcePath: source, SourceMtime: info.ModTime(), SourceSize: info.Size()}
+	if err := db.CreateTask(task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	db.UpdateTaskStatus(task.ID, database.StatusCompleted, "")
+	if output != "" {
+		os.WriteFile(filepath.Join(pair.Output, name), []byte(output), 0644)
+	}
+	return task
+}
+
+func TestRunOnce(t *testing.T) {
+	v, db, pair := setupTestVerifier(t)
+	defer db.Close()
+
+	missing := createCompleted(t, db, pair, "missing.mp4", "")
+	broken := createCompleted(t, db, pair, "broken.mp4", "not a video")
+	recent := createCompleted(t, db, pair, "recent.mp4", "")
+	db.MarkTaskVerified(recent.ID, time.Now())
+
+	summary, err := v.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if summary.Checked != 2 || summary.Missing != 1 {
+		t.Fatalf("校验统计错误: %+v", summary)
+	}
+
+	task, _ := db.GetTaskByPath(missing.SourcePath)
+	if task.Status != database.StatusPending {
+		t.Errorf("输出缺失的任务应重新入队，实际 %s", task.Status)
+	}
+
+	// 损坏的输出不会被删除：损坏时移入隔离区，无法判断时（如缺少 ffprobe）保持原样
+	task, _ = db.GetTaskByPath(broken.SourcePath)
+	list, _ := db.GetVerifications("", broken.ID, 10, 0)
+	if len(list) != 1 {
+		t.Fatalf("应记录一条校验结果，实际 %d", len(list))
+	}
+	switch list[0].Result {
+	case database.VerifyCorrupt:
+		if _, err := os.Stat(list[0].QuarantinePath); err != nil {
+			t.Errorf("损坏输出应移入隔离区: %v", err)
+		}
+		if task.Status != database.StatusPending {
+			t.Errorf("隔离后应重新入队，实际 %s", task.Status)
+		}
+	case database.VerifyError:
+		if _, err := os.Stat(filepath.Join(pair.Output, "broken.mp4")); err != nil {
+			t.Error("无法校验时不应移动输出文件")
+		}
+		if task.Status != database.StatusCompleted || task.LastVerifiedAt != nil {
+			t.Error("无法校验时任务应保持不变，下次重试")
+		}
+	default:
+		t.Errorf("损坏输出的校验结果错误: %s", list[0].Result)
+	}
+
+	if list, _ := db.GetVerifications("", recent.ID, 10, 0); len(list) != 0 {
+		t.Error("复检周期内的任务不应再次校验")
+	}
+}
+
+func TestQuarantineKeepsRelativePath(t *testing.T) {
+	v, db, pair := setupTestVerifier(t)
+	defer db.Close()
+
+	os.MkdirAll(filepath.Join(pair.Input, "show"), 0755)
+	os.MkdirAll(filepath.Join(pair.Output, "show"), 0755)
+	task := createCompleted(t, db, pair, filepath.Join("show", "ep1.mp4"), "bad")
+	output := filepath.Join(pair.Output, "show", "ep1.mp4")
+
+	dest, err := v.quarantine(task, output)
+	if err != nil {
+		t.Fatalf("隔离失败: %v", err)
+	}
+	if want := filepath.Join(pair.Output, ".stm_quarantine", "show", "ep1.mp4"); dest != want {
+		t.Errorf("隔离路径 = %s, want %s", dest, want)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("原输出应已移走")
+	}
+
+	// 同名文件再次隔离时不覆盖
+	os.WriteFile(output, []byte("bad again"), 0644)
+	second, err := v.quarantine(task, output)
+	if err != nil || second == dest {
+		t.Errorf("重复隔离应使用新文件名: %s, %v", second, err)
+	}
+}
+
+func TestRunOnceRejectsConcurrentRuns(t *testing.T) {
+	v, db, _ := setupTestVerifier(t)
+	defer db.Close()
+
+	v.current = &RunSummary{Running: true}
+	if _, err := v.RunOnce(context.Background()); err != ErrRunning {
+		t.Errorf("已有校验运行时应返回 ErrRunning: %v", err)
+	}
+	if status := v.Status(); status == nil || !status.Running {
+		t.Error("Status 应返回进行中的一轮")
+	}
+}
+
+func TestMissingOutputWithRemovedSource(t *testing.T) {
+	v, db, pair := setupTestVerifier(t)
+	defer db.Close()
+
+	task := createCompleted(t, db, pair, "gone.mp4", "")
+	os.Remove(task.SourcePath)
+
+	if _, err := v.RunOnce(context.Background()); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	// 无法重新入队时记录校验时间，复检周期内不再重复校验
+	got, _ := db.GetTaskByPath(task.SourcePath)
+	if got.Status != database.StatusCompleted || got.LastVerifiedAt == nil {
+		t.Errorf("源文件缺失时应记录校验时间: status=%s verified=%v", got.Status, got.LastVerifiedAt)
+	}
+	if summary, _ := v.RunOnce(context.Background()); summary.Checked != 0 {
+		t.Errorf("复检周期内不应再次校验: %+v", summary)
+	}
+}
+
+// trashSource 模拟清理模块将源文件移入垃圾桶
+func trashSource(t *testing.T, db *database.DB, task *database.Task) *database.TrashItem {
+	trashPath := task.SourcePath + "_del_20260101_000000"
+	if err := os.Rename(task.SourcePath, trashPath); err != nil {
+		t.Fatalf("移动源文件失败: %v", err)
+	}
+	item := &database.TrashItem{TaskID: task.ID, OriginalPath: task.SourcePath, TrashPath: trashPath,
+		Reason: database.TrashReasonCleanup, DeletedAt: time.Now()}
+	db.AddTrashItem(item)
+	db.MarkSourceRemoved(task.ID)
+	return item
+}
+
+func TestCorruptOutputRestoresTrashedSource(t *testing.T) {
+	v, db, pair := setupTestVerifier(t)
+	defer db.Close()
+
+	task := createCompleted(t, db, pair, "movie.mp4", "bad")
+	item := trashSource(t, db, task)
+	task, _ = db.GetTaskByPath(task.SourcePath)
+
+	output := filepath.Join(pair.Output, "movie.mp4")
+	record := &database.Verification{}
+	v.handleCorrupt(task, output, record)
+
+	if _, err := os.Stat(task.SourcePath); err != nil {
+		t.Errorf("源文件应从垃圾桶恢复: %v", err)
+	}
+	if restored, _ := db.GetTrashItem(item.ID); restored.Status != database.TrashRestored {
+		t.Errorf("垃圾桶记录应标记为已恢复: %s", restored.Status)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) || record.QuarantinePath == "" {
+		t.Error("源文件恢复后应隔离损坏的输出")
+	}
+
+	got, _ := db.GetTaskByPath(task.SourcePath)
+	if got.Status != database.StatusFailed || got.SourceRemovedAt != nil {
+		t.Errorf("任务应标记为失败并清除移除标记: status=%s removed=%v", got.Status, got.SourceRemovedAt)
+	}
+	if alerts, _ := db.GetActiveAlerts(); len(alerts) != 1 || alerts[0].Kind != database.AlertCorruptOutput {
+		t.Errorf("应记录损坏输出告警: %+v", alerts)
+	}
+}
+
+func TestCorruptOutputKeptWhenSourceUnrecoverable(t *testing.T) {
+	v, db, pair := setupTestVerifier(t)
+	defer db.Close()
+
+	task := createCompleted(t, db, pair, "movie.mp4", "bad")
+	item := trashSource(t, db, task)
+	os.Remove(item.TrashPath) // 垃圾桶中的文件无法移回
+	task, _ = db.GetTaskByPath(task.SourcePath)
+
+	output := filepath.Join(pair.Output, "movie.mp4")
+	record := &database.Verification{}
+	v.handleCorrupt(task, output, record)
+
+	if _, err := os.Stat(output); err != nil || record.QuarantinePath != "" {
+		t.Error("源文件无法恢复时应保留输出文件")
+	}
+	if held, _ := db.GetTrashItem(item.ID); held.HoldReason == "" {
+		t.Error("垃圾桶中的源文件应阻止自动删除")
+	}
+
+	got, _ := db.GetTaskByPath(task.SourcePath)
+	if got.Status != database.StatusFailed || !got.Log.Valid || got.Log.String == "" {
+		t.Errorf("任务应标记为失败并记录原因: status=%s log=%q", got.Status, got.Log.String)
+	}
+	if alerts, _ := db.GetActiveAlerts(); len(alerts) != 1 || alerts[0].Kind != database.AlertCorruptOutput {
+		t.Errorf("应记录损坏输出告警: %+v", alerts)
+	}
+}
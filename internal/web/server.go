@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -16,21 +17,24 @@ import (
 	"github.com/stm/video-transcoder/internal/database"
 	"github.com/stm/video-transcoder/internal/metrics"
 	"github.com/stm/video-transcoder/internal/scanner"
+	"github.com/stm/video-transcoder/internal/verifier"
 	"github.com/stm/video-transcoder/internal/worker"
 )
 
 // Server Web服务器
 type Server struct {
-	config  *config.Config
-	db      *database.DB
-	scanner *scanner.Scanner
-	worker  *worker.Worker
-	cleaner *cleaner.Cleaner
-	router  *gin.Engine
+	config   *config.Config
+	db       *database.DB
+	scanner  *scanner.Scanner
+	worker   *worker.Worker
+	cleaner  *cleaner.Cleaner
+	verifier *verifier.Verifier
+	router   *gin.Engine
 }
 
 // New 创建Web服务器实例
-func New(cfg *config.Config, db *database.DB, scan *scanner.Scanner, work *worker.Worker, clean *cleaner.Cleaner) *Server {
+func New(cfg *config.Config, db *database.DB, scan *scanner.Scanner, work *worker.Worker, clean *cleaner.Cleaner,
+	verify *verifier.Verifier) *Server {
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -40,12 +44,13 @@ func New(cfg *config.Config, db *database.DB, scan *scanner.Scanner, work *worke
 	router.LoadHTMLGlob("/app/templates/*.html")
 
 	s := &Server{
-		config:  cfg,
-		db:      db,
-		scanner: scan,
-		worker:  work,
-		cleaner: clean,
-		router:  router,
+		config:   cfg,
+		db:       db,
+		scanner:  scan,
+		worker:   work,
+		cleaner:  clean,
+		verifier: verify,
+		router:   router,
 	}
 
 	s.setupRoutes()
@@ -62,6 +67,10 @@ func (s *Server) setupRoutes() {
 		api.POST("/tasks/retry-failed", s.handleRetryFailedTasks)
 		api.POST("/tasks/retry-processing", s.handleRetryProcessingTasks)
 		api.POST("/scan", s.handleTriggerScan)
+		api.GET("/scan/dry-run", s.handleDryRunScan) // 试运行扫描，?format=csv 下载文件列表
+		api.GET("/scans", s.handleGetScans)
+		api.GET("/scans/:id", s.handleGetScan)
+		api.DELETE("/scans/:id", s.handleCancelScan)
 		api.POST("/tasks/:id/retry", s.handleRetryTask)
 		api.DELETE("/tasks/:id", s.handleDeleteTask)
 		api.GET("/worker/status", s.handleWorkerStatus)
@@ -72,8 +81,26 @@ func (s *Server) setupRoutes() {
 		api.POST("/directories", s.handleAddDirectory)          // 添加监控目录
 		api.DELETE("/directories", s.handleRemoveDirectory)     // 删除监控目录
 		api.GET("/directories/browse", s.handleBrowseDirectory) // 新增：浏览目录
+		api.GET("/filters/test", s.handleTestFilter)            // 解释路径命中的过滤规则
+		api.GET("/orphans", s.handleGetOrphans)                 // 源文件已在外部删除的任务
+		api.GET("/quarantine", s.handleGetQuarantined)          // 反复检查失败而被隔离的源文件
+		api.POST("/quarantine/:id/restore", s.handleRestoreQuarantined)
+		api.DELETE("/quarantine/:id", s.handleDeleteQuarantined)
+		api.GET("/verifications", s.handleGetVerifications) // 输出校验记录
+		api.GET("/verify/status", s.handleVerifyStatus)
+		api.POST("/verify/run", s.handleRunVerify)
 		api.GET("/trash", s.handleGetTrash)
 		api.DELETE("/trash/:filename", s.handleDeleteTrash)
+		api.POST("/trash/:id/restore", s.handleRestoreTrash)
+		api.GET("/archive", s.handleGetArchive)      // 归档清单（source_policy=archive 的源文件去向）
+		api.POST("/cleaner/run", s.handleRunCleaner) // 立即清理，dry_run=true 时只返回将要执行的操作
+		api.GET("/cleaner/runs", s.handleGetCleanerRuns)
+		api.GET("/orphan-outputs", s.handleGetOrphanOutputs) // 输出目录中没有对应任务的文件
+		api.POST("/orphan-outputs/scan", s.handleReconcileOutputs)
+		api.POST("/orphan-outputs/delete", s.handleDeleteOrphanOutputs)
+		api.POST("/orphan-outputs/adopt", s.handleAdoptOrphanOutputs)
+		api.GET("/alerts", s.handleGetAlerts) // 未处理的告警（如移入垃圾桶前输出检查失败）
+		api.POST("/alerts/:id/dismiss", s.handleDismissAlert)
 		api.GET("/health", s.handleHealth)
 	}
 
@@ -103,11 +130,14 @@ func (s *Server) handleGetStats(c *gin.Context) {
 	)
 
 	c.JSON(http.StatusOK, gin.H{
-		"pending":    stats.PendingCount,
-		"processing": stats.ProcessingCount,
-		"completed":  stats.CompletedCount,
-		"failed":     stats.FailedCount,
-		"saved_gb":   float64(stats.TotalSaved) / 1024 / 1024 / 1024,
+		"pending":     stats.PendingCount,
+		"processing":  stats.ProcessingCount,
+		"completed":   stats.CompletedCount,
+		"failed":      stats.FailedCount,
+		"settling":    stats.SettlingCount,
+		"orphaned":    stats.OrphanedCount,
+		"quarantined": stats.QuarantinedCount,
+		"saved_gb":    float64(stats.TotalSaved) / 1024 / 1024 / 1024,
 	})
 }
 
@@ -140,20 +170,107 @@ func (s *Server) handleGetTasks(c *gin.Context) {
 }
 
 // handleTriggerScan 手动触发扫描
+// 可选 JSON 请求体 {"pair": "...", "path": "...", "deep": true} 指定配对或子目录，?deep=true 仍然有效
 func (s *Server) handleTriggerScan(c *gin.Context) {
-	log.Printf("[API] 收到手动扫描请求，来自: %s", c.ClientIP())
+	var req struct {
+		Pair  string `json:"pair"`
+		Path  string `json:"path"`
+		Deep  bool   `json:"deep"`
+		Adopt bool   `json:"adopt"` // 已有通过校验的输出时直接记为已完成
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	}
+	deep := req.Deep || c.Query("deep") == "true" || c.Query("deep") == "1"
+	adopt := req.Adopt || c.Query("adopt") == "true" || c.Query("adopt") == "1"
+	log.Printf("[API] 收到手动扫描请求，来自: %s, 完整扫描: %v, 收养: %v, 配对: %q, 目录: %q", c.ClientIP(), deep, adopt, req.Pair, req.Path)
 
-	go func() {
-		// 使用独立的 context，不绑定到 HTTP 请求生命周期
-		ctx := context.Background()
-		log.Printf("[API] 启动扫描 goroutine，context 类型: %T, 已取消: %v", ctx, ctx.Err() != nil)
+	started, busy, err := s.scanner.StartScan(scanner.ScanOptions{Deep: deep, Pair: req.Pair, Path: req.Path, Adopt: adopt})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(started) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "目标配对正在扫描中", "busy": busy})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "扫描已启动", "deep": deep, "adopt": adopt, "jobs": started, "busy": busy})
+}
 
-		if err := s.scanner.Scan(ctx); err != nil {
-			log.Printf("手动扫描失败: %v", err)
+// handleDryRunScan 试运行扫描指定目录，不写入数据库
+// ?format=csv 时以附件形式下载文件列表
+func (s *Server) handleDryRunScan(c *gin.Context) {
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 path 参数"})
+		return
+	}
+
+	report, err := s.scanner.DryRun(c.Request.Context(), path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		filename := "stm-dry-run-" + report.StartedAt.Format("20060102-150405") + ".csv"
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		if err := report.WriteCSV(c.Writer); err != nil {
+			log.Printf("[API] 输出试运行报告失败: %v", err)
 		}
-	}()
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "扫描已启动"})
+// handleGetScans 列出扫描任务
+func (s *Server) handleGetScans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"scans": s.scanner.ListScanJobs()})
+}
+
+// handleGetScan 查询单个扫描任务
+func (s *Server) handleGetScan(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的扫描任务ID"})
+		return
+	}
+
+	job, ok := s.scanner.GetScanJob(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": scanner.ErrScanJobNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// handleCancelScan 取消扫描任务
+func (s *Server) handleCancelScan(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的扫描任务ID"})
+		return
+	}
+
+	switch err := s.scanner.CancelScanJob(id); {
+	case errors.Is(err, scanner.ErrScanJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, scanner.ErrScanJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 扫描任务 #%d 已请求取消，来自: %s", id, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "扫描任务已取消"})
 }
 
 // handleRetryTask 重试失败任务
@@ -374,6 +491,184 @@ func (s *Server) handleBrowseDirectory(c *gin.Context) {
 	})
 }
 
+// handleTestFilter 测试路径会被哪条过滤规则接受或拒绝
+func (s *Server) handleTestFilter(c *gin.Context) {
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 path 参数"})
+		return
+	}
+
+	result, err := s.scanner.ExplainPath(path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// orphanItem 孤立任务及其输出文件状态
+type orphanItem struct {
+	*database.Task
+	Output       string `json:"output"`        // 当前存在的输出文件路径
+	OutputExists bool   `json:"output_exists"` // 输出文件是否仍存在
+}
+
+// handleGetOrphans 列出孤立任务，供人工审核
+func (s *Server) handleGetOrphans(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	tasks, err := s.db.GetAllTasks(string(database.StatusOrphaned), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]orphanItem, 0, len(tasks))
+	for _, task := range tasks {
+		output := s.config.ExistingOutputPath(task.SourcePath, task.OutputPath)
+		items = append(items, orphanItem{
+			Task:         task,
+			Output:       output,
+			OutputExists: output != "",
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orphans":     items,
+		"policy":      s.config.Cleaning.OrphanPolicy,
+		"grace_hours": s.config.Cleaning.OrphanGraceHours,
+	})
+}
+
+// handleGetQuarantined 列出隔离的源文件
+func (s *Server) handleGetQuarantined(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	tasks, err := s.db.GetAllTasks(string(database.StatusQuarantined), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks":          tasks,
+		"enabled":        s.config.Quarantine.Enabled,
+		"after_failures": s.config.Quarantine.AfterFailures,
+	})
+}
+
+// handleRestoreQuarantined 将隔离的源文件移回原位置并重新入队
+func (s *Server) handleRestoreQuarantined(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+
+	if err := s.worker.RestoreQuarantined(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, worker.ErrNotQuarantined) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 隔离任务 #%d 已恢复，来自: %s", id, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "源文件已恢复并重新加入队列"})
+}
+
+// handleDeleteQuarantined 彻底删除隔离的源文件
+func (s *Server) handleDeleteQuarantined(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+
+	if err := s.worker.DeleteQuarantined(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, worker.ErrNotQuarantined) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 隔离任务 #%d 已彻底删除，来自: %s", id, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "隔离的源文件已删除"})
+}
+
+// handleGetVerifications 查询输出校验记录，支持按结果和任务筛选
+func (s *Server) handleGetVerifications(c *gin.Context) {
+	result := c.Query("result")
+	taskID, _ := strconv.ParseInt(c.Query("task_id"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	list, err := s.db.GetVerifications(result, taskID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"verifications": list, "status": s.verifier.Status()})
+}
+
+// handleVerifyStatus 查询当前或最近一轮输出校验
+func (s *Server) handleVerifyStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":       s.config.FFmpeg.StrictCheck,
+		"reverify_days": s.config.Verify.ReverifyDays,
+		"status":        s.verifier.Status(),
+	})
+}
+
+// handleRunVerify 立即执行一轮输出校验
+func (s *Server) handleRunVerify(c *gin.Context) {
+	if !s.config.FFmpeg.StrictCheck {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "strict_check 未开启"})
+		return
+	}
+	if status := s.verifier.Status(); status != nil && status.Running {
+		c.JSON(http.StatusConflict, gin.H{"error": verifier.ErrRunning.Error()})
+		return
+	}
+
+	log.Printf("[API] 收到手动校验请求，来自: %s", c.ClientIP())
+	go func() {
+		if _, err := s.verifier.RunOnce(context.Background()); err != nil {
+			log.Printf("[API] 输出校验失败: %v", err)
+		}
+	}()
+	c.JSON(http.StatusOK, gin.H{"message": "输出校验已启动"})
+}
+
 // handleGetTrash 获取垃圾桶文件列表
 func (s *Server) handleGetTrash(c *gin.Context) {
 	files, err := s.cleaner.ListTrashFiles()
@@ -388,15 +683,235 @@ func (s *Server) handleGetTrash(c *gin.Context) {
 		totalSize += f.Size
 	}
 
+	// 各配对的当前与预计用量（含容量上限）
+	usage, err := s.cleaner.TrashUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"files":      files,
 		"total_size": totalSize,
+		"usage":      usage,
 	})
 }
 
+// handleGetArchive 查询归档清单，支持按任务筛选
+func (s *Server) handleGetArchive(c *gin.Context) {
+	taskID, _ := strconv.ParseInt(c.Query("task_id"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	items, err := s.db.GetArchiveItems(taskID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if items == nil {
+		items = []*database.ArchiveItem{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleRunCleaner 立即执行清理；试运行同步返回将要移入垃圾桶和彻底删除的文件
+func (s *Server) handleRunCleaner(c *gin.Context) {
+	var req struct {
+		DryRun bool   `json:"dry_run"`
+		Phase  string `json:"phase"` // soft/hard/temp/all，默认 all
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数: " + err.Error()})
+			return
+		}
+	}
+	if c.Query("dry_run") == "true" {
+		req.DryRun = true
+	}
+
+	if req.DryRun {
+		report, err := s.cleaner.RunOnce(req.Phase, cleaner.TriggerManual, true)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, cleaner.ErrRunning) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	if s.cleaner.Running() {
+		c.JSON(http.StatusConflict, gin.H{"error": cleaner.ErrRunning.Error()})
+		return
+	}
+	switch req.Phase {
+	case "", cleaner.PhaseSoft, cleaner.PhaseHard, cleaner.PhaseTemp, cleaner.PhaseAll:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "清理阶段无效: " + req.Phase})
+		return
+	}
+
+	log.Printf("[API] 收到手动清理请求（阶段: %s），来自: %s", req.Phase, c.ClientIP())
+	go func() {
+		if _, err := s.cleaner.RunOnce(req.Phase, cleaner.TriggerManual, false); err != nil {
+			log.Printf("[API] 清理失败: %v", err)
+		}
+	}()
+	c.JSON(http.StatusOK, gin.H{"message": "清理任务已启动"})
+}
+
+// handleGetOrphanOutputs 查询最近一次核对得到的无主输出
+func (s *Server) handleGetOrphanOutputs(c *gin.Context) {
+	items, err := s.db.GetOrphanOutputs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if items == nil {
+		items = []*database.OrphanOutput{}
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "size": size})
+}
+
+// handleReconcileOutputs 立即核对输出目录，返回无主输出报告
+func (s *Server) handleReconcileOutputs(c *gin.Context) {
+	log.Printf("[API] 收到核对输出目录请求，来自: %s", c.ClientIP())
+	report, err := s.cleaner.ReconcileOutputs()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, cleaner.ErrRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// handleDeleteOrphanOutputs 将选中的无主输出移入垃圾桶
+func (s *Server) handleDeleteOrphanOutputs(c *gin.Context) {
+	s.handleOrphanOutputAction(c, "移入垃圾桶", s.cleaner.DeleteOrphanOutputs)
+}
+
+// handleAdoptOrphanOutputs 为选中的无主输出创建已完成的任务
+func (s *Server) handleAdoptOrphanOutputs(c *gin.Context) {
+	s.handleOrphanOutputAction(c, "收养", s.cleaner.AdoptOrphanOutputs)
+}
+
+// handleOrphanOutputAction 批量处理无主输出，请求体 {"ids": [...]}
+func (s *Server) handleOrphanOutputAction(c *gin.Context, name string, fn func([]int64) ([]cleaner.OrphanOutputResult, error)) {
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要处理的文件"})
+		return
+	}
+
+	log.Printf("[API] 收到无主输出%s请求（%d 个），来自: %s", name, len(req.IDs), c.ClientIP())
+	results, err := fn(req.IDs)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, cleaner.ErrRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	done := 0
+	for _, r := range results {
+		if r.Error == "" {
+			done++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"done": done, "results": results})
+}
+
+// handleGetCleanerRuns 查询清理记录
+func (s *Server) handleGetCleanerRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	runs, err := s.db.GetCleanerRuns(limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if runs == nil {
+		runs = []*database.CleanerRun{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"runs":    runs,
+		"running": s.cleaner.Running(),
+		"schedule": gin.H{
+			"soft_delete_cron": s.config.Cleaning.SoftDeleteCron,
+			"hard_delete_cron": s.config.Cleaning.HardDeleteCron,
+		},
+	})
+}
+
+// handleGetAlerts 获取未处理的告警
+func (s *Server) handleGetAlerts(c *gin.Context) {
+	alerts, err := s.db.GetActiveAlerts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if alerts == nil {
+		alerts = []*database.Alert{}
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+// handleDismissAlert 手动关闭告警（问题未解决时下次清理会重新告警）
+func (s *Server) handleDismissAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
+		return
+	}
+
+	found, err := s.db.DismissAlert(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "告警不存在或已关闭"})
+		return
+	}
+
+	log.Printf("[API] 告警 #%d 已关闭，来自: %s", id, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "告警已关闭"})
+}
+
 // handleDeleteTrash 删除垃圾桶文件
 func (s *Server) handleDeleteTrash(c *gin.Context) {
-	filename := c.Param("filename")
+	// 多配对时文件名可能重复，优先使用 ?path= 指定的完整路径
+	filename := c.Query("path")
+	if filename == "" {
+		filename = c.Param("filename")
+	}
 
 	if err := s.cleaner.DeleteTrashFile(filename); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -406,6 +921,38 @@ func (s *Server) handleDeleteTrash(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "文件已删除"})
 }
 
+// handleRestoreTrash 将垃圾桶中的文件移回原位置，可选 {"reset_task": true} 重新转码
+func (s *Server) handleRestoreTrash(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的记录ID"})
+		return
+	}
+
+	var req struct {
+		ResetTask bool `json:"reset_task"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	path, err := s.cleaner.RestoreTrashItem(id, req.ResetTask)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, cleaner.ErrTrashItemNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 垃圾桶文件 #%d 已恢复到 %s，来自: %s", id, path, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "文件已恢复", "path": path})
+}
+
 // handleHealth 健康检查
 func (s *Server) handleHealth(c *gin.Context) {
 	// 检查数据库连接
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// errSourceCorrupt 源文件未通过转码前的 ffprobe 检查
+var errSourceCorrupt = errors.New("文件检查失败")
+
+// ErrNotQuarantined 任务不存在或不在隔离区
+var ErrNotQuarantined = errors.New("任务不在隔离区")
+
+// QuarantineReport 与隔离文件一起保存的诊断报告（<文件名>.json）
+type QuarantineReport struct {
+	TaskID         int64     `json:"task_id"`
+	SourcePath     string    `json:"source_path"`
+	QuarantinePath string    `json:"quarantine_path"`
+	SourceSize     int64     `json:"source_size"`
+	Failures       int       `json:"failures"`
+	DecodeError    string    `json:"decode_error"` // 最近一次检查的错误输出
+	PreviousLog    string    `json:"previous_log"` // 隔离前任务记录的日志
+	Probe          string    `json:"probe"`        // ffprobe 的格式与流信息
+	QuarantinedAt  time.Time `json:"quarantined_at"`
+}
+
+// quarantineIfRepeated 记录一次源文件检查失败，达到次数时移入隔离区，已隔离返回 true
+func (w *Worker) quarantineIfRepeated(task *database.Task, errMsg string, workerID int) bool {
+	failures, err := w.db.IncrementCorruptCount(task.ID)
+	if err != nil {
+		log.Printf("[Worker-%d] 记录源文件检查失败次数失败: %v", workerID, err)
+		return false
+	}
+	if !w.config.Quarantine.Enabled || failures < w.config.Quarantine.AfterFailures {
+		return false
+	}
+
+	dest, err := w.quarantineSource(task, failures, errMsg)
+	if err != nil {
+		log.Printf("[Worker-%d] 隔离源文件失败 %s: %v", workerID, task.SourcePath, err)
+		return false
+	}
+	log.Printf("[Worker-%d] 🚧 源文件已累计 %d 次检查失败，移入隔离区: %s", workerID, failures, dest)
+	return true
+}
+
+// quarantineSource 将源文件移到 <配对输入目录>/<隔离目录>/<相对路径>，并写入诊断报告
+func (w *Worker) quarantineSource(task *database.Task, failures int, errMsg string) (string, error) {
+	pair, rel, ok := w.config.FindPair(task.SourcePath)
+	if !ok {
+		return "", fmt.Errorf("无法找到源文件对应的输入输出配对: %s", task.SourcePath)
+	}
+	dest := filepath.Join(pair.Input, w.config.Quarantine.Dir, rel)
+
+	// 同名文件已在隔离区时追加时间戳
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = strings.TrimSuffix(dest, ext) + "." + time.Now().Format("20060102-150405") + ext
+	}
+
+	// 报告需要在移动前读取源文件
+	probeTimeout := time.Duration(w.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	report := QuarantineReport{
+		TaskID:         task.ID,
+		SourcePath:     task.SourcePath,
+		QuarantinePath: dest,
+		SourceSize:     task.SourceSize,
+		Failures:       failures,
+		DecodeError:    errMsg,
+		PreviousLog:    task.GetLog(),
+		Probe:          media.ProbeReport(task.SourcePath, probeTimeout),
+		QuarantinedAt:  time.Now(),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(task.SourcePath, dest); err != nil {
+		return "", err
+	}
+
+	logMsg := fmt.Sprintf("源文件累计 %d 次检查失败，已移入隔离区: %s\n%s", failures, dest, errMsg)
+	if err := w.db.MarkTaskQuarantined(task.ID, dest, logMsg); err != nil {
+		// 数据库未记录隔离位置时移回原处，避免文件“消失”
+		if rerr := os.Rename(dest, task.SourcePath); rerr != nil {
+			log.Printf("[Worker] 移回源文件失败 %s: %v", dest, rerr)
+		}
+		return "", err
+	}
+
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		if err := os.WriteFile(reportPath(dest), data, 0644); err != nil {
+			log.Printf("[Worker] 写入隔离报告失败 %s: %v", dest, err)
+		}
+	}
+	return dest, nil
+}
+
+// RestoreQuarantined 将隔离的源文件移回原位置并重新加入队列
+func (w *Worker) RestoreQuarantined(id int64) error {
+	task, err := w.quarantinedTask(id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(task.SourcePath); err == nil {
+		return fmt.Errorf("原位置已存在同名文件: %s", task.SourcePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(task.SourcePath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(task.QuarantinePath, task.SourcePath); err != nil {
+		return err
+	}
+	info, err := os.Stat(task.SourcePath)
+	if err != nil {
+		return err
+	}
+	if err := w.db.RestoreQuarantinedTask(task.ID, info.ModTime(), info.Size()); err != nil {
+		return err
+	}
+
+	if err := os.Remove(reportPath(task.QuarantinePath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Worker] 删除隔离报告失败 %s: %v", task.QuarantinePath, err)
+	}
+	log.Printf("[Worker] 源文件已从隔离区恢复: %s", task.SourcePath)
+	return nil
+}
+
+// DeleteQuarantined 彻底删除隔离的源文件、报告与任务记录
+func (w *Worker) DeleteQuarantined(id int64) error {
+	task, err := w.quarantinedTask(id)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{task.QuarantinePath, reportPath(task.QuarantinePath)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := w.db.DeleteTask(task.ID); err != nil {
+		return err
+	}
+
+	log.Printf("[Worker] 已彻底删除隔离的源文件: %s", task.QuarantinePath)
+	return nil
+}
+
+// quarantinedTask 查询处于隔离状态的任务
+func (w *Worker) quarantinedTask(id int64) (*database.Task, error) {
+	task, err := w.db.GetTaskByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil || task.Status != database.StatusQuarantined || task.QuarantinePath == "" {
+		return nil, ErrNotQuarantined
+	}
+	return task, nil
+}
+
+// reportPath 隔离报告的路径
+func reportPath(quarantinePath string) string {
+	return quarantinePath + ".json"
+}
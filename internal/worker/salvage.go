@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// 抢救步骤，按代价从低到高依次尝试
+const (
+	salvageRemux   = "remux"   // 流复制重新封装，重建索引/moov
+	salvageGenPTS  = "genpts"  // 重新封装并重建时间戳
+	salvageSegment = "segment" // 分段复制，跳过无法读取的区段
+)
+
+// salvageSource 源文件无法通过检查时尝试抢救，成功时返回可用于转码的中间文件
+// 执行的步骤与丢弃的时长记录到任务中
+func (w *Worker) salvageSource(task *database.Task, outputPath string, workerID int) (string, error) {
+	inputPath := task.SourcePath
+	dst := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".stm_tmp.salvage.mkv"
+
+	probeTimeout := time.Duration(w.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	duration, err := media.ProbeDuration(inputPath, probeTimeout)
+	if err != nil {
+		duration = 0 // 索引损坏时常读不到时长，分段抢救会因此跳过
+	}
+	copyTimeout := computeFfmpegTimeout(duration, w.config)
+	segmentSeconds := w.config.FFmpeg.SalvageSegmentSeconds
+	segmentTimeout := probeTimeout + time.Duration(segmentSeconds)*time.Second
+
+	attempts := []struct {
+		name string
+		run  func() (float64, error)
+	}{
+		{salvageRemux, func() (float64, error) { return 0, media.Remux(inputPath, dst, copyTimeout, false) }},
+		{salvageGenPTS, func() (float64, error) { return 0, media.Remux(inputPath, dst, copyTimeout, true) }},
+		{salvageSegment, func() (float64, error) {
+			return media.SalvageSegments(inputPath, dst, duration, segmentSeconds, segmentTimeout, copyTimeout)
+		}},
+	}
+
+	var steps []string
+	for _, attempt := range attempts {
+		lost, err := attempt.run()
+		if err == nil {
+			err = media.ProbeFile(dst, probeTimeout, 2)
+		}
+		if err != nil {
+			os.Remove(dst)
+			steps = append(steps, attempt.name+"=failed")
+			log.Printf("[Worker-%d] 抢救步骤 %s 失败: %v", workerID, attempt.name, err)
+			continue
+		}
+
+		// 重新封装丢弃的内容按前后时长差计算
+		if attempt.name != salvageSegment && duration > 0 {
+			if salvaged, err := media.ProbeDuration(dst, probeTimeout); err == nil && salvaged < duration {
+				lost = duration - salvaged
+			}
+		}
+		steps = append(steps, attempt.name+"=ok")
+		w.recordSalvage(task.ID, steps, lost)
+		log.Printf("[Worker-%d] 🩹 源文件抢救成功（%s），丢弃 %.1f 秒: %s",
+			workerID, strings.Join(steps, ", "), lost, inputPath)
+		return dst, nil
+	}
+
+	w.recordSalvage(task.ID, steps, 0)
+	return "", fmt.Errorf("抢救失败（%s）", strings.Join(steps, ", "))
+}
+
+// recordSalvage 将抢救步骤写入任务
+func (w *Worker) recordSalvage(id int64, steps []string, lost float64) {
+	if err := w.db.UpdateTaskSalvage(id, strings.Join(steps, ", "), lost); err != nil {
+		log.Printf("[Worker] 记录抢救步骤失败 #%d: %v", id, err)
+	}
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/fileutil"
+	"github.com/stm/video-transcoder/internal/media"
+)
+
+// copySidecars 将源文件的伴随文件复制到输出文件旁边，字幕按配置转换格式
+// 伴随文件失败不影响转码结果，只记录日志
+func (w *Worker) copySidecars(task *database.Task, outputPath string, workerID int) {
+	if !w.config.Sidecar.Enabled {
+		return
+	}
+	sidecars, err := fileutil.Sidecars(task.SourcePath, w.config.Sidecar.Patterns)
+	if err != nil {
+		log.Printf("[Worker-%d] 查找伴随文件失败 %s: %v", workerID, task.SourcePath, err)
+		return
+	}
+
+	timeout := time.Duration(w.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
+	for _, sidecar := range sidecars {
+		dest := fileutil.SidecarFor(sidecar, task.SourcePath, outputPath)
+		if format := w.config.Sidecar.SubtitleFormat; format != "" && media.IsSubtitle(sidecar) &&
+			!strings.EqualFold(filepath.Ext(sidecar), "."+format) {
+			converted := strings.TrimSuffix(dest, filepath.Ext(dest)) + "." + format
+			err := media.ConvertSubtitle(sidecar, converted, timeout)
+			if err == nil {
+				log.Printf("[Worker-%d] 字幕已转换: %s", workerID, converted)
+				continue
+			}
+			os.Remove(converted)
+			log.Printf("[Worker-%d] %v，改为原样复制: %s", workerID, err, sidecar)
+		}
+		// 输出与源文件同目录同名时伴随文件已在原位
+		if dest == sidecar {
+			continue
+		}
+		if err := fileutil.Copy(sidecar, dest); err != nil {
+			log.Printf("[Worker-%d] 复制伴随文件失败 %s: %v", workerID, sidecar, err)
+			continue
+		}
+		log.Printf("[Worker-%d] 伴随文件已复制: %s", workerID, dest)
+	}
+}
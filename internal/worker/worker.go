@@ -154,6 +154,11 @@ func (w *Worker) getActiveTasks() int64 {
 	return atomic.LoadInt64(&w.activeTasks)
 }
 
+// IsIdle 当前是否没有正在转码的任务
+func (w *Worker) IsIdle() bool {
+	return w.getActiveTasks() == 0
+}
+
 // SetMaxWorkers 设置最大Worker数量（运行时动态调整）
 func (w *Worker) SetMaxWorkers(count int) {
 	w.mu.Lock()
@@ -389,6 +394,12 @@ func (w *Worker) processWorker(ctx context.Context, workerID int) {
 						log.Printf("[Worker-%d] 📋 错误详情: %s", workerID, errMsg)
 					}
 
+					// 源文件反复检查失败时移入隔离区，不再与普通失败混在一起
+					if errors.Is(err, errSourceCorrupt) && !transient && w.quarantineIfRepeated(task, errMsg, workerID) {
+						metrics.TranscodeFailed.Inc()
+						return
+					}
+
 					nextRetry := task.RetryCount + 1
 					w.db.IncrementRetryCount(task.ID)
 
@@ -409,19 +420,9 @@ func (w *Worker) processWorker(ctx context.Context, workerID int) {
 				} else {
 					log.Printf("[Worker-%d] ✅ 转码成功 #%d: %s", workerID, task.ID, task.SourcePath)
 
-					// 更新输出文件大小 - 单次遍历获取输出路径
-					var outputDir, relPath string
-					pairs := w.config.GetPairs()
-					for _, pair := range pairs {
-						if rel, err := filepath.Rel(pair.Input, task.SourcePath); err == nil && !strings.HasPrefix(rel, "..") {
-							outputDir = pair.Output
-							relPath = rel
-							break
-						}
-					}
-
-					if outputDir != "" && relPath != "" {
-						outputPath := w.config.ApplyOutputExtension(filepath.Join(outputDir, relPath))
+					// 更新输出文件大小
+					if basePath, ok := w.config.ResolveOutputBase(task.SourcePath, task.OutputPath); ok {
+						outputPath := w.config.ApplyOutputExtension(basePath)
 						if info, err := os.Stat(outputPath); err == nil {
 							w.db.UpdateTaskOutputSize(task.ID, info.Size())
 
@@ -437,6 +438,10 @@ func (w *Worker) processWorker(ctx context.Context, workerID int) {
 
 					// 更新状态为完成
 					w.db.UpdateTaskStatus(task.ID, database.StatusCompleted, "转码成功")
+					if w.config.FFmpeg.StrictCheck {
+						// 输出在转码结束时已校验，下一次定期校验按复检周期进行
+						w.db.MarkTaskVerified(task.ID, time.Now())
+					}
 
 					// 更新 Prometheus metrics
 					metrics.TranscodeSuccess.Inc()
@@ -455,26 +460,20 @@ func (w *Worker) transcode(ctx context.Context, task *database.Task, workerID in
 	// 源文件的完整路径就是task.SourcePath
 	inputPath := task.SourcePath
 
-	// 单次遍历找到匹配的输入目录，同时获取输出目录和相对路径
-	var (
-		outputDir string
-		relPath   string
-	)
-	pairs := w.config.GetPairs()
-	for _, pair := range pairs {
-		if rel, err := filepath.Rel(pair.Input, inputPath); err == nil && !strings.HasPrefix(rel, "..") {
-			outputDir = pair.Output
-			relPath = rel
-			break
-		}
-	}
-
-	if outputDir == "" || relPath == "" {
+	// 查找输出路径（.stm.yaml 覆盖优先，否则按配对映射）
+	basePath, ok := w.config.ResolveOutputBase(inputPath, task.OutputPath)
+	if !ok {
 		return fmt.Errorf("无法找到源文件对应的输入输出配对: %s", inputPath)
 	}
 
 	// 构建输出路径（保持目录结构，必要时统一扩展名）
-	outputPath := w.config.ApplyOutputExtension(filepath.Join(outputDir, relPath))
+	outputPath := w.config.ApplyOutputExtension(basePath)
+
+	// 转码参数（目录指定的 profile 覆盖默认值）
+	encode, ok := w.config.ResolveProfile(task.Profile)
+	if !ok {
+		log.Printf("[Worker-%d] 未知的转码配置 %q，使用默认参数", workerID, task.Profile)
+	}
 
 	// 确保输出目录存在
 	outputPathDir := filepath.Dir(outputPath)
@@ -490,14 +489,26 @@ func (w *Worker) transcode(ctx context.Context, task *database.Task, workerID in
 	// 使用ffprobe检查文件完整性
 	probeTimeout := time.Duration(w.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
 	if err := media.ProbeFile(inputPath, probeTimeout, 2); err != nil {
-		return fmt.Errorf("文件检查失败: %w", err)
+		// 超时多为IO问题，不做抢救
+		if !w.config.FFmpeg.Salvage || errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %w", errSourceCorrupt, err)
+		}
+		log.Printf("[Worker-%d] 源文件检查失败，尝试抢救: %v", workerID, err)
+		salvaged, salvageErr := w.salvageSource(task, outputPath, workerID)
+		if salvageErr != nil {
+			return fmt.Errorf("%w: %w; %v", errSourceCorrupt, err, salvageErr)
+		}
+		defer os.Remove(salvaged)
+		inputPath = salvaged
 	}
 
-	// 获取视频总时长
-	duration, err := w.getDuration(inputPath)
+	// 获取视频总时长与流信息（用于输出一致性检查）
+	duration := 0.0
+	sourceInfo, err := media.ProbeInfo(inputPath, probeTimeout)
 	if err != nil {
 		log.Printf("[Worker-%d] 获取视频时长失败: %v", workerID, err)
-		duration = 0
+	} else {
+		duration = sourceInfo.Duration
 	}
 
 	repairMode := w.selectCorruptStrategy(inputPath, workerID)
@@ -530,13 +541,14 @@ func (w *Worker) transcode(ctx context.Context, task *database.Task, workerID in
 	}
 	args = append(args,
 		"-i", inputPath, // 输入文件
-		"-c:v", w.config.FFmpeg.Codec, // 视频编码器
-		"-preset", w.config.FFmpeg.Preset, // 预设
-		"-crf", strconv.Itoa(w.config.FFmpeg.CRF), // CRF质量
+		"-c:v", encode.Codec, // 视频编码器
+		"-preset", encode.Preset, // 预设
+		"-crf", strconv.Itoa(encode.CRF), // CRF质量
 		"-pix_fmt", "yuv420p", // 提高兼容性
-		"-c:a", w.config.FFmpeg.Audio, // 音频编码器
-		"-b:a", w.config.FFmpeg.AudioBitrate, // 音频比特率
+		"-c:a", encode.Audio, // 音频编码器
+		"-b:a", encode.AudioBitrate, // 音频比特率
 	)
+	args = append(args, streamArgs(encode, outputPath)...)
 	if repairMode == "cfr" {
 		fps := w.config.FFmpeg.OutputFPS
 		if fps <= 0 {
@@ -645,6 +657,17 @@ func (w *Worker) transcode(ctx context.Context, task *database.Task, workerID in
 				}
 			}
 		}
+
+		// 时长与流数量需与源文件及转码配置一致，避免截断或丢轨的输出通过校验
+		if sourceInfo != nil {
+			outputInfo, err := media.ProbeInfo(outputTempPath, probeTimeout)
+			if err != nil {
+				return fmt.Errorf("输出文件验证失败: %w", err)
+			}
+			if err := outputInfo.CheckParity(w.config.Expectation(encode, sourceInfo)); err != nil {
+				return err
+			}
+		}
 	}
 
 	if err := os.Rename(outputTempPath, outputPath); err != nil {
@@ -653,39 +676,45 @@ func (w *Worker) transcode(ctx context.Context, task *database.Task, workerID in
 			return fmt.Errorf("移动输出文件失败: %w", renameErr)
 		}
 	}
+	w.copySidecars(task, outputPath, workerID)
 
 	success = true
 	return nil
 }
 
-// getDuration 获取视频时长（秒）
-func (w *Worker) getDuration(path string) (float64, error) {
-	probeTimeout := time.Duration(w.config.FFmpeg.ProbeTimeoutSeconds) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "ffprobe",
-		"-v", "error",
-		"-show_entries", "format=duration",
-		"-of", "default=noprint_wrappers=1:nokey=1",
-		path,
-	)
-
-	output, err := cmd.CombinedOutput()
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		return 0, fmt.Errorf("ffprobe超时(%s): %w", probeTimeout, ctx.Err())
-	}
-	if err != nil {
-		return 0, err
+// streamArgs 按音轨与字幕设置生成流映射参数，均为默认时沿用 ffmpeg 的自动选择
+func streamArgs(encode config.EncodeSettings, outputPath string) []string {
+	var args []string
+	if encode.AudioTracks == config.AudioTracksAll || encode.Subtitles == config.SubtitlesAll {
+		args = append(args, "-map", "0:v:0")
+		switch encode.AudioTracks {
+		case config.AudioTracksAll:
+			args = append(args, "-map", "0:a?")
+		case config.AudioTracksNone:
+		default:
+			args = append(args, "-map", "0:a:0?")
+		}
+		if encode.Subtitles == config.SubtitlesAll {
+			args = append(args, "-map", "0:s?")
+		}
 	}
 
-	durationStr := strings.TrimSpace(string(output))
-	duration, err := strconv.ParseFloat(durationStr, 64)
-	if err != nil {
-		return 0, err
+	if encode.AudioTracks == config.AudioTracksNone {
+		args = append(args, "-an")
 	}
-
-	return duration, nil
+	switch encode.Subtitles {
+	case config.SubtitlesNone:
+		args = append(args, "-sn")
+	case config.SubtitlesAll:
+		// MP4 容器只支持 mov_text 文本字幕
+		switch strings.ToLower(filepath.Ext(outputPath)) {
+		case ".mp4", ".m4v", ".mov":
+			args = append(args, "-c:s", "mov_text")
+		default:
+			args = append(args, "-c:s", "copy")
+		}
+	}
+	return args
 }
 
 func computeFfmpegTimeout(duration float64, cfg *config.Config) time.Duration {
@@ -801,6 +830,9 @@ func classifyError(errMsg string) (string, bool) {
 	if strings.Contains(errMsg, "进度超过") || strings.Contains(errMsg, "FFmpeg超时") || strings.Contains(errMsg, "ffprobe超时") {
 		return "疑似IO卡住或进程超时", true
 	}
+	if strings.Contains(errMsg, media.ErrParity.Error()) {
+		return "输出时长或流数量与源文件不一致", false
+	}
 	if strings.Contains(errMsg, "输出文件验证失败") {
 		return "输出文件损坏，自动重试", true
 	}
@@ -1,9 +1,16 @@
 package worker
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stm/video-transcoder/internal/config"
+	"github.com/stm/video-transcoder/internal/database"
+	"github.com/stm/video-transcoder/internal/media"
 )
 
 func TestIsWorkingHours(t *testing.T) {
@@ -88,7 +95,7 @@ func TestIsWorkingHours(t *testing.T) {
 }
 
 func TestGetForceRun(t *testing.T) {
-	w := &Worker{forceRun: false}
+	w := &Worker{config: &config.Config{}, forceRun: false}
 	if w.GetForceRun() {
 		t.Error("初始状态 GetForceRun() 应该为 false")
 	}
@@ -135,3 +142,153 @@ func TestNew(t *testing.T) {
 		t.Error("初始 forceRun 应该为 false")
 	}
 }
+
+func TestStreamArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode config.EncodeSettings
+		output string
+		want   string
+	}{
+		{"默认", config.EncodeSettings{}, "a.mp4", ""},
+		{"全部音轨", config.EncodeSettings{AudioTracks: config.AudioTracksAll}, "a.mkv", "-map 0:v:0 -map 0:a?"},
+		{"MP4 保留字幕", config.EncodeSettings{Subtitles: config.SubtitlesAll}, "a.mp4", "-map 0:v:0 -map 0:a:0? -map 0:s? -c:s mov_text"},
+		{"MKV 保留字幕", config.EncodeSettings{Subtitles: config.SubtitlesAll}, "a.mkv", "-map 0:v:0 -map 0:a:0? -map 0:s? -c:s copy"},
+		{"去掉音轨和字幕", config.EncodeSettings{AudioTracks: config.AudioTracksNone, Subtitles: config.SubtitlesNone}, "a.mp4", "-an -sn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(streamArgs(tt.encode, tt.output), " "); got != tt.want {
+				t.Errorf("streamArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectationParity(t *testing.T) {
+	cfg := &config.Config{FFmpeg: config.FFmpegConfig{DurationToleranceSeconds: 2, DurationTolerancePercent: 1}}
+	source := &media.Info{Duration: 3600, Video: 1, Audio: 3, Subtitle: 2}
+
+	exp := cfg.Expectation(config.EncodeSettings{AudioTracks: config.AudioTracksAll, Subtitles: config.SubtitlesNone}, source)
+	if exp.Audio != 3 || exp.Subtitle != 0 || !exp.CheckSubtitle || exp.Tolerance != 36 {
+		t.Fatalf("Expectation() = %+v", exp)
+	}
+
+	good := &media.Info{Duration: 3590, Video: 1, Audio: 3}
+	if err := good.CheckParity(exp); err != nil {
+		t.Errorf("误差范围内不应报错: %v", err)
+	}
+
+	truncated := &media.Info{Duration: 1800, Video: 1, Audio: 1}
+	err := truncated.CheckParity(exp)
+	if !errors.Is(err, media.ErrParity) {
+		t.Fatalf("截断的输出应返回 ErrParity: %v", err)
+	}
+	if category, retry := classifyError(err.Error()); retry || !strings.Contains(category, "不一致") {
+		t.Errorf("classifyError() = %s, %v", category, retry)
+	}
+}
+
+func TestQuarantineSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	pair := config.InputOutputPair{Input: filepath.Join(tmpDir, "input"), Output: filepath.Join(tmpDir, "output")}
+	os.MkdirAll(filepath.Join(pair.Input, "show"), 0755)
+
+	cfg := &config.Config{
+		Path:       config.PathConfig{Pairs: []config.InputOutputPair{pair}},
+		FFmpeg:     config.FFmpegConfig{ProbeTimeoutSeconds: 5},
+		Quarantine: config.QuarantineConfig{Enabled: true, AfterFailures: 2, Dir: ".stm_quarantine"},
+	}
+	db, err := database.Init(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	w := New(cfg, db)
+
+	source := filepath.Join(pair.Input, "show", "broken.mkv")
+	os.WriteFile(source, []byte("not a video"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 11}
+	if err := db.CreateTask(task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	if w.quarantineIfRepeated(task, "文件检查失败: moov atom not found", 1) {
+		t.Fatal("未达到失败次数时不应隔离")
+	}
+	if !w.quarantineIfRepeated(task, "文件检查失败: moov atom not found", 1) {
+		t.Fatal("达到失败次数后应隔离")
+	}
+
+	dest := filepath.Join(pair.Input, ".stm_quarantine", "show", "broken.mkv")
+	got, _ := db.GetTaskByID(task.ID)
+	if got.Status != database.StatusQuarantined || got.QuarantinePath != dest {
+		t.Fatalf("隔离状态错误: status=%s path=%s", got.Status, got.QuarantinePath)
+	}
+	if _, err := os.Stat(reportPath(dest)); err != nil {
+		t.Errorf("应写入隔离报告: %v", err)
+	}
+
+	if err := w.RestoreQuarantined(task.ID); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	got, _ = db.GetTaskByID(task.ID)
+	if got.Status != database.StatusPending || got.CorruptCount != 0 {
+		t.Errorf("恢复后应重新入队并清零失败次数: status=%s count=%d", got.Status, got.CorruptCount)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("源文件应移回原位置: %v", err)
+	}
+	if err := w.RestoreQuarantined(task.ID); !errors.Is(err, ErrNotQuarantined) {
+		t.Errorf("未隔离的任务应返回 ErrNotQuarantined: %v", err)
+	}
+
+	// 再次隔离后彻底删除
+	w.quarantineIfRepeated(task, "文件检查失败", 1)
+	if !w.quarantineIfRepeated(task, "文件检查失败", 1) {
+		t.Fatal("再次达到失败次数后应隔离")
+	}
+	if err := w.DeleteQuarantined(task.ID); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("隔离文件应已删除")
+	}
+	if got, _ := db.GetTaskByID(task.ID); got != nil {
+		t.Error("任务记录应已删除")
+	}
+}
+
+func TestSalvageSourceRecordsSteps(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		FFmpeg: config.FFmpegConfig{ProbeTimeoutSeconds: 5, MaxDurationHours: 1, SalvageSegmentSeconds: 30},
+	}
+	db, err := database.Init(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer db.Close()
+	w := New(cfg, db)
+
+	source := filepath.Join(tmpDir, "garbage.mp4")
+	os.WriteFile(source, []byte("definitely not a video"), 0644)
+	task := &database.Task{SourcePath: source, SourceMtime: time.Now(), SourceSize: 22}
+	if err := db.CreateTask(task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	output := filepath.Join(tmpDir, "out", "garbage.mp4")
+	os.MkdirAll(filepath.Dir(output), 0755)
+	if _, err := w.salvageSource(task, output, 1); err == nil {
+		t.Fatal("无法抢救的文件应返回错误")
+	}
+
+	got, _ := db.GetTaskByID(task.ID)
+	if want := "remux=failed, genpts=failed, segment=failed"; got.SalvageSteps != want {
+		t.Errorf("SalvageSteps = %q, want %q", got.SalvageSteps, want)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(output)); len(entries) != 0 {
+		t.Errorf("抢救失败后不应留下中间文件: %v", entries)
+	}
+}